@@ -0,0 +1,117 @@
+/**
+ * Reed-Solomon 编码库 - AONT-RS
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+)
+
+// AONT-RS（Resch–Plank）的数据包格式:
+//
+//	AES-256-CTR_K(data || canary) | K ⊕ SHA-256(密文)
+//
+// K 为每个对象随机生成的密钥，canary 为16个0字节。只有得到完整的密文才能算出 K，
+// 因此数据包经纠删编码后，少于 k 个分片不会泄露数据的有用信息，也无需管理密钥。
+const (
+	aontKeyLen    = 32
+	aontCanaryLen = 16
+
+	// AONTOverhead 是全有全无变换增加的字节数
+	AONTOverhead = aontKeyLen + aontCanaryLen
+)
+
+// AONT 在纠删编码前对对象做全有全无变换，提供不依赖密钥管理的保密性
+// Split 和 Join 与编解码器的同名方法对应，分片的重建仍使用编解码器的 Reconstruct/ReconstructData。
+type AONT struct {
+	enc ReedSolomon
+}
+
+// NewAONT 创建使用 enc 编码的 AONT-RS 编解码器
+func NewAONT(enc ReedSolomon) *AONT {
+	return &AONT{enc: enc}
+}
+
+// aontStream 返回密钥 key 的 AES-256-CTR 密钥流
+// 每个对象使用新的随机密钥，因此固定的初始向量是安全的。
+func aontStream(key []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	var iv [aes.BlockSize]byte
+	return cipher.NewCTR(block, iv[:]), nil
+}
+
+// Split 对 data 做全有全无变换后拆分并编码，返回包括校验分片在内的全部分片
+// 恢复时需要原始数据的长度 len(data)。
+func (a *AONT) Split(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrShortData
+	}
+	key := make([]byte, aontKeyLen)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	stream, err := aontStream(key)
+	if err != nil {
+		return nil, err
+	}
+	pkg := make([]byte, len(data)+AONTOverhead)
+	n := len(data) + aontCanaryLen
+	copy(pkg, data)
+	stream.XORKeyStream(pkg[:n], pkg[:n])
+	h := sha256.Sum256(pkg[:n])
+	subtle.XORBytes(pkg[n:], key, h[:])
+
+	shards, err := a.enc.Split(pkg)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.enc.Encode(shards); err != nil {
+		return nil, err
+	}
+	return shards, nil
+}
+
+// Join 合并数据分片并还原原始数据，outSize 为原始数据的长度
+// 与编解码器的 Join 相同，数据分片必须齐全，否则返回 ErrReconstructRequired；
+// 分片被篡改或 outSize 不正确时 canary 校验失败，返回 ErrAONTIntegrity。
+func (a *AONT) Join(dst io.Writer, shards [][]byte, outSize int) error {
+	if outSize <= 0 {
+		return ErrSize
+	}
+	var buf bytes.Buffer
+	buf.Grow(outSize + AONTOverhead)
+	if err := a.enc.Join(&buf, shards, outSize+AONTOverhead); err != nil {
+		return err
+	}
+	pkg := buf.Bytes()
+	n := outSize + aontCanaryLen
+	h := sha256.Sum256(pkg[:n])
+	key := make([]byte, aontKeyLen)
+	defer clear(key)
+	subtle.XORBytes(key, pkg[n:], h[:])
+	stream, err := aontStream(key)
+	if err != nil {
+		return err
+	}
+	stream.XORKeyStream(pkg[:n], pkg[:n])
+	defer clear(pkg)
+	var canary [aontCanaryLen]byte
+	if subtle.ConstantTimeCompare(pkg[outSize:n], canary[:]) != 1 {
+		return ErrAONTIntegrity
+	}
+	_, err = dst.Write(pkg[:outSize])
+	return err
+}
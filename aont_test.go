@@ -0,0 +1,86 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试 AONT-RS 拆分、丢失分片后重建并还原
+func TestAONT(t *testing.T) {
+	testAONT(t, 10, 4, false)
+	testAONT(t, 10, 4, true)
+	testAONT(t, 300, 30, true)
+}
+
+func testAONT(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAONT(enc)
+	for _, size := range []int{1, 1000, 123457} {
+		// 可压缩的数据，明文不应出现在任何分片中
+		data := bytes.Repeat([]byte("secret-"), size/7+1)[:size]
+		shards, err := a.Split(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shards) != dataShards+parityShards {
+			t.Fatalf("分片数 %d", len(shards))
+		}
+		if size >= 1000 {
+			for i, s := range shards {
+				if bytes.Contains(s, []byte("secret-secret-")) {
+					t.Fatalf("分片 %d 包含明文", i)
+				}
+			}
+		}
+
+		var out bytes.Buffer
+		if err := a.Join(&out, shards, size); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("大小 %d: 还原的数据不一致", size)
+		}
+
+		// 丢失数据分片时与 Join 相同，需要先重建
+		rng := rand.New(rand.NewSource(int64(size)))
+		for _, i := range rng.Perm(len(shards))[:parityShards] {
+			shards[i] = nil
+		}
+		out.Reset()
+		if err := a.Join(&out, shards, size); err != ErrReconstructRequired && err != nil {
+			t.Fatalf("期望 ErrReconstructRequired，实际 %v", err)
+		}
+		if err := enc.ReconstructData(shards); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		if err := a.Join(&out, shards, size); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("大小 %d: 重建后还原的数据不一致", size)
+		}
+
+		// 长度不正确或分片被篡改
+		if err := a.Join(&out, shards, size+1); err != ErrAONTIntegrity {
+			t.Fatalf("长度不正确: 期望 ErrAONTIntegrity，实际 %v", err)
+		}
+		shards[0][0] ^= 1
+		if err := a.Join(&out, shards, size); err != ErrAONTIntegrity {
+			t.Fatalf("篡改后期望 ErrAONTIntegrity，实际 %v", err)
+		}
+	}
+	if _, err := a.Split(nil); err != ErrShortData {
+		t.Fatalf("期望 ErrShortData，实际 %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+/**
+ * Reed-Solomon 编码库 - 流式操作检查点
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"io"
+)
+
+// Checkpoint 是流式编码或重建的可序列化进度令牌
+// 它记录已经完成的块数以及每个输入、输出流在块边界处的字节偏移。
+type Checkpoint struct {
+	Op        string  `json:"op"`         // 操作类型：StreamOpEncode 或 StreamOpReconstruct
+	BlockSize int     `json:"block_size"` // 流处理块大小，恢复时必须一致
+	Block     int64   `json:"block"`      // 已完成的块数
+	Inputs    []int64 `json:"inputs"`     // 每个输入流已读取的字节数
+	Outputs   []int64 `json:"outputs"`    // 每个输出流已写入的字节数
+}
+
+// snapshot 返回当前进度的快照
+func (t *streamTracker) snapshot() *Checkpoint {
+	cp := &Checkpoint{
+		Op:        t.op,
+		BlockSize: t.blockSize,
+		Block:     t.block,
+		Inputs:    make([]int64, len(t.in)),
+		Outputs:   make([]int64, len(t.out)),
+	}
+	for i, c := range t.in {
+		if c != nil {
+			cp.Inputs[i] = c.n
+		}
+	}
+	for i, c := range t.out {
+		if c != nil {
+			cp.Outputs[i] = c.n
+		}
+	}
+	return cp
+}
+
+// seekToCheckpoint 检查检查点并把输入输出流定位到检查点记录的偏移
+func seekToCheckpoint(cp *Checkpoint, op string, blockSize int, inputs []io.ReadSeeker, outputs []io.WriteSeeker) ([]io.Reader, []io.Writer, error) {
+	if cp == nil || cp.Op != op || cp.BlockSize != blockSize || cp.Block < 0 {
+		return nil, nil, ErrInvalidCheckpoint
+	}
+	if len(cp.Inputs) != len(inputs) || len(cp.Outputs) != len(outputs) {
+		return nil, nil, ErrInvalidCheckpoint
+	}
+
+	in := make([]io.Reader, len(inputs))
+	for i, r := range inputs {
+		if r == nil {
+			if cp.Inputs[i] != 0 {
+				return nil, nil, ErrInvalidCheckpoint
+			}
+			continue
+		}
+		if _, err := r.Seek(cp.Inputs[i], io.SeekStart); err != nil {
+			return nil, nil, StreamReadError{Err: err, Stream: i}
+		}
+		in[i] = r
+	}
+	out := make([]io.Writer, len(outputs))
+	for i, w := range outputs {
+		if w == nil {
+			if cp.Outputs[i] != 0 {
+				return nil, nil, ErrInvalidCheckpoint
+			}
+			continue
+		}
+		if _, err := w.Seek(cp.Outputs[i], io.SeekStart); err != nil {
+			return nil, nil, StreamWriteError{Err: err, Stream: i}
+		}
+		out[i] = w
+	}
+	return in, out, nil
+}
@@ -0,0 +1,179 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// seekBuffer 是一个支持 Seek 的内存写入器
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (s *seekBuffer) Write(p []byte) (int, error) {
+	if need := s.pos + len(p); need > len(s.buf) {
+		s.buf = append(s.buf, make([]byte, need-len(s.buf))...)
+	}
+	copy(s.buf[s.pos:], p)
+	s.pos += len(p)
+	return len(p), nil
+}
+
+func (s *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart || offset < 0 {
+		return 0, errors.New("不支持的定位方式")
+	}
+	s.pos = int(offset)
+	return offset, nil
+}
+
+var errTestAbort = errors.New("模拟中断")
+
+// 测试流式编码和重建在中断后从检查点恢复，输出与不中断时一致
+func TestStreamCheckpointResume(t *testing.T) {
+	testStreamCheckpointResume(t, 6, 3, false)
+	testStreamCheckpointResume(t, 6, 3, true)
+	testStreamCheckpointResume(t, 300, 20, true)
+}
+
+func testStreamCheckpointResume(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	const blockSize = 4096
+	newEnc := func(opts ...Option) ReedSolomon {
+		opts = append(opts, WithStreamBlockSize(blockSize))
+		var enc ReedSolomon
+		var err error
+		if useFF16 {
+			enc, err = New16(dataShards, parityShards, opts...)
+		} else {
+			enc, err = New8(dataShards, parityShards, opts...)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return enc
+	}
+
+	// 每个分片 7 个完整块加一个不完整块
+	perShard := blockSize*7 + 640
+	data := make([]byte, perShard*dataShards)
+	rand.New(rand.NewSource(1)).Read(data)
+	ref := newEnc()
+	shards, err := ref.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ref.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// 在第4个块之后中断，并把检查点序列化保存
+	var saved []byte
+	interrupt := newEnc(WithCheckpoint(2, func(cp *Checkpoint) error {
+		b, err := json.Marshal(cp)
+		if err != nil {
+			return err
+		}
+		saved = b
+		if cp.Block == 4 {
+			return errTestAbort
+		}
+		return nil
+	}))
+	load := func() *Checkpoint {
+		var cp Checkpoint
+		if err := json.Unmarshal(saved, &cp); err != nil {
+			t.Fatal(err)
+		}
+		if cp.Block != 4 {
+			t.Fatalf("期望在第4块中断，实际 %d", cp.Block)
+		}
+		return &cp
+	}
+
+	// 编码
+	outputs := make([]*seekBuffer, parityShards)
+	writers := make([]io.Writer, parityShards)
+	for i := range outputs {
+		outputs[i] = &seekBuffer{}
+		writers[i] = outputs[i]
+	}
+	readers := make([]io.Reader, dataShards)
+	for i := range readers {
+		readers[i] = bytes.NewReader(shards[i])
+	}
+	if err := interrupt.StreamEncode(readers, writers); err != errTestAbort {
+		t.Fatalf("期望中断错误，实际 %v", err)
+	}
+
+	seekReaders := make([]io.ReadSeeker, dataShards)
+	for i := range seekReaders {
+		seekReaders[i] = bytes.NewReader(shards[i])
+	}
+	seekWriters := make([]io.WriteSeeker, parityShards)
+	for i := range seekWriters {
+		seekWriters[i] = outputs[i]
+	}
+	if err := newEnc().StreamEncodeResume(seekReaders, seekWriters, load()); err != nil {
+		t.Fatal(err)
+	}
+	for i := range outputs {
+		if !bytes.Equal(outputs[i].buf, shards[dataShards+i]) {
+			t.Fatalf("恢复后的校验分片 %d 不一致", i)
+		}
+	}
+
+	// 重建：丢失一个数据分片和一个校验分片，并同时重建两者
+	lost := []int{1, dataShards}
+	testResume := func(rebuild []int) {
+		recovered := make([]*seekBuffer, len(shards))
+		inputs := make([]io.Reader, len(shards))
+		outs := make([]io.Writer, len(shards))
+		for i := range shards {
+			inputs[i] = bytes.NewReader(shards[i])
+		}
+		for _, i := range lost {
+			inputs[i] = nil
+		}
+		for _, i := range rebuild {
+			recovered[i] = &seekBuffer{}
+			outs[i] = recovered[i]
+		}
+		if err := interrupt.StreamReconstruct(inputs, outs); err != errTestAbort {
+			t.Fatalf("期望中断错误，实际 %v", err)
+		}
+
+		seekIn := make([]io.ReadSeeker, len(shards))
+		seekOut := make([]io.WriteSeeker, len(shards))
+		for i := range shards {
+			if inputs[i] != nil {
+				seekIn[i] = bytes.NewReader(shards[i])
+			}
+			if recovered[i] != nil {
+				seekOut[i] = recovered[i]
+			}
+		}
+		if err := newEnc().StreamReconstructResume(seekIn, seekOut, load()); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range rebuild {
+			if !bytes.Equal(recovered[i].buf, shards[i]) {
+				t.Fatalf("恢复后重建的分片 %d 不一致 (%d/%d 字节)", i, len(recovered[i].buf), len(shards[i]))
+			}
+		}
+	}
+	testResume(lost)
+	// 只重建数据分片，丢失的校验分片不输出
+	testResume(lost[:1])
+
+	// 检查点与操作不匹配时应拒绝
+	cp := load()
+	cp.Op = StreamOpEncode
+	if err := newEnc().StreamReconstructResume(make([]io.ReadSeeker, len(shards)), make([]io.WriteSeeker, len(shards)), cp); err != ErrInvalidCheckpoint {
+		t.Fatalf("期望 ErrInvalidCheckpoint，实际 %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+/**
+ * rs16 - bench/selftest 子命令
+ *
+ * Copyright 2024
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	rs "github.com/bpfs/reedsolomon16"
+	"github.com/klauspost/cpuid/v2"
+)
+
+// runBench 在每条可用的内核路径上测量编码和重建的吞吐量
+func runBench(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("bench", "", stderr)
+	ks := fs.String("k", "10,50,200", "数据分片数量列表")
+	ms := fs.String("m", "4,20", "校验分片数量列表")
+	sizes := fs.String("size", "64k,1m", "分片大小列表，可使用 k/m 后缀")
+	kernels := fs.String("kernel", "", "只测试这些内核路径，默认全部")
+	dur := fs.Duration("time", 500*time.Millisecond, "每个用例的最短运行时间")
+	if code := parseNoArgs(fs, args); code >= 0 {
+		return code
+	}
+
+	kList, err := parseList(*ks)
+	if err == nil && len(kList) == 0 {
+		err = errors.New("-k 不能为空")
+	}
+	var mList, sizeList []int
+	if err == nil {
+		mList, err = parseList(*ms)
+	}
+	if err == nil {
+		sizeList, err = parseList(*sizes)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "rs16 bench: %v\n", err)
+		return exitUsage
+	}
+	paths, err := selectKernels(*kernels)
+	if err != nil {
+		fmt.Fprintf(stderr, "rs16 bench: %v\n", err)
+		return exitUsage
+	}
+
+	defer rs.UseKernel(rs.ActiveKernel())
+	fmt.Fprintf(stdout, "CPU: %s (%s/%s)\n", cpuid.CPU.BrandName, runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(stdout, "默认内核: %s\n\n", rs.ActiveKernel())
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "内核\t域\tk\tm\t分片大小\t编码 GB/s\t重建 GB/s")
+	for _, p := range paths {
+		if err := rs.UseKernel(p); err != nil {
+			return fail(stderr, "bench", err)
+		}
+		for _, k := range kList {
+			for _, m := range mList {
+				for _, size := range sizeList {
+					for _, field := range []int{8, 16} {
+						if field == 8 && k+m > 256 {
+							continue
+						}
+						enc, dec, err := benchCase(k, m, size, field, *dur)
+						if err != nil {
+							return fail(stderr, "bench", fmt.Errorf("%s GF(2^%d) %d+%d: %w", p, field, k, m, err))
+						}
+						fmt.Fprintf(tw, "%s\tGF(2^%d)\t%d\t%d\t%d\t%.2f\t%.2f\n", p, field, k, m, size, enc, dec)
+					}
+				}
+			}
+		}
+	}
+	tw.Flush()
+	return exitOK
+}
+
+// benchCase 返回一个用例的编码和重建吞吐量（按数据分片字节计算）
+// 重建时丢失 m 个分片，优先丢失数据分片。
+func benchCase(k, m, size, field int, d time.Duration) (float64, float64, error) {
+	var enc rs.ReedSolomon
+	var err error
+	if field == 8 {
+		enc, err = rs.New8(k, m)
+	} else {
+		enc, err = rs.New16(k, m)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	shards := make([][]byte, k+m)
+	rng := rand.New(rand.NewSource(1))
+	for i := range shards {
+		shards[i] = make([]byte, size)
+		if i < k {
+			rng.Read(shards[i])
+		}
+	}
+
+	n := float64(k * size)
+	encRate, err := measure(n, d, func() error {
+		return enc.Encode(shards)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	saved := slices.Clone(shards)
+	decRate, err := measure(n, d, func() error {
+		copy(shards, saved)
+		for i := 0; i < m; i++ {
+			shards[i] = saved[i][:0]
+		}
+		return enc.Reconstruct(shards)
+	})
+	return encRate, decRate, err
+}
+
+// measure 重复运行 fn 至少 d，返回 GB/s
+func measure(size float64, d time.Duration, fn func() error) (float64, error) {
+	var runs int
+	start := time.Now()
+	for runs == 0 || time.Since(start) < d {
+		if err := fn(); err != nil {
+			return 0, err
+		}
+		runs++
+	}
+	return size * float64(runs) / time.Since(start).Seconds() / 1e9, nil
+}
+
+// parseList 解析逗号分隔的正整数，支持 k/m 后缀
+func parseList(s string) ([]int, error) {
+	var list []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		mul := 1
+		switch f[len(f)-1] {
+		case 'k', 'K':
+			mul, f = 1<<10, f[:len(f)-1]
+		case 'm', 'M':
+			mul, f = 1<<20, f[:len(f)-1]
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("无效的数值 %q", f)
+		}
+		list = append(list, n*mul)
+	}
+	return list, nil
+}
+
+// selectKernels 返回要测试的内核路径，空字符串表示全部可用路径
+func selectKernels(s string) ([]rs.KernelPath, error) {
+	avail := rs.AvailableKernels()
+	if s == "" {
+		return avail, nil
+	}
+	var paths []rs.KernelPath
+	for _, f := range strings.Split(s, ",") {
+		p := rs.KernelPath(strings.TrimSpace(f))
+		if !slices.Contains(avail, p) {
+			return nil, fmt.Errorf("内核 %q 不可用，可用: %v", p, avail)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// checkKernel 测试一条内核路径，测试中可替换
+var checkKernel = rs.CheckKernel
+
+// runSelfTest 对当前 CPU 支持的每条内核路径运行已知答案测试
+// 被启动自检禁用的路径同样会被测试，并报告禁用的原因。
+func runSelfTest(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("selftest", "", stderr)
+	if code := parseNoArgs(fs, args); code >= 0 {
+		return code
+	}
+
+	info := rs.SelectedKernel()
+	code := exitOK
+	for _, p := range rs.SupportedKernels() {
+		status := "通过"
+		if err := checkKernel(p); err != nil {
+			status = fmt.Sprintf("失败: %v", err)
+			code = exitSelfTest
+		}
+		for _, e := range info.Disabled {
+			if e.Path == p {
+				status += fmt.Sprintf("（启动自检已禁用: %v）", e)
+				code = exitSelfTest
+			}
+		}
+		fmt.Fprintf(stdout, "%-10s %s\n", p, status)
+	}
+	fmt.Fprintf(stdout, "当前内核: %s\n", info.Path)
+	return code
+}
@@ -0,0 +1,271 @@
+/**
+ * rs16 - encode/decode/verify/repair 子命令
+ *
+ * Copyright 2024
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	rs "github.com/bpfs/reedsolomon16"
+)
+
+// runEncode 把文件拆分成 k 个数据分片并生成 m 个校验分片
+func runEncode(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("encode", "文件", stderr)
+	k := fs.Int("k", 10, "数据分片数量")
+	m := fs.Int("m", 4, "校验分片数量")
+	dir := fs.String("dir", "", "分片输出目录，默认与输入文件相同")
+	block := fs.Int("block", 0, "流处理块大小（字节），0 表示默认值")
+	in, code := parseArgs(fs, args)
+	if code >= 0 {
+		return code
+	}
+
+	enc, err := rs.New(*k, *m, rs.WithStreamBlockSize(*block))
+	if err != nil {
+		fmt.Fprintf(stderr, "rs16 encode: %v\n", err)
+		return exitUsage
+	}
+	prefix := in
+	if *dir != "" {
+		prefix = filepath.Join(*dir, filepath.Base(in))
+	}
+	if err := encodeFile(enc, in, prefix); err != nil {
+		return fail(stderr, "encode", err)
+	}
+	fmt.Fprintf(stdout, "%s: %d+%d 个分片已写入 %s.0 ... %s.%d\n",
+		in, *k, *m, prefix, prefix, enc.TotalShards()-1)
+	return exitOK
+}
+
+// encodeFile 流式拆分和编码文件，同时生成清单
+func encodeFile(enc rs.ReedSolomon, in, prefix string) (err error) {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		return errors.New("不能编码空文件")
+	}
+
+	b, err := rs.NewManifestBuilder(enc, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, enc.TotalShards())
+	writers := make([]io.Writer, len(files))
+	defer func() {
+		for i, f := range files {
+			if f == nil {
+				continue
+			}
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(shardPath(prefix, i))
+			}
+		}
+	}()
+	for i := range files {
+		f, err := os.Create(shardPath(prefix, i))
+		if err != nil {
+			return err
+		}
+		files[i] = f
+		writers[i] = f
+	}
+
+	k := enc.DataShards()
+	if err := enc.StreamSplit(b.Object(src), b.DataWriters(writers[:k]), fi.Size()); err != nil {
+		return err
+	}
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		if _, err := files[i].Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		readers[i] = files[i]
+	}
+	if err := enc.StreamEncode(readers, b.ParityWriters(writers[k:])); err != nil {
+		return err
+	}
+
+	m, err := b.Manifest()
+	if err != nil {
+		return err
+	}
+	return writeManifest(prefix, m)
+}
+
+// runDecode 从任意 k 个完好的分片恢复原文件
+func runDecode(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("decode", "前缀", stderr)
+	out := fs.String("o", "", "输出文件，默认为前缀本身")
+	force := fs.Bool("f", false, "覆盖已存在的输出文件")
+	block := fs.Int("block", 0, "流处理块大小（字节），0 表示默认值")
+	prefix, code := parseArgs(fs, args)
+	if code >= 0 {
+		return code
+	}
+	if *out == "" {
+		*out = prefix
+	}
+	if _, err := os.Stat(*out); err == nil && !*force {
+		fmt.Fprintf(stderr, "rs16 decode: %s 已存在，使用 -f 覆盖\n", *out)
+		return exitUsage
+	}
+
+	s, err := openShardSet(prefix, rs.WithStreamBlockSize(*block))
+	if err != nil {
+		return fail(stderr, "decode", err)
+	}
+	states, err := s.check()
+	if err != nil {
+		return fail(stderr, "decode", err)
+	}
+	if err := decodeFile(s, states, *out); err != nil {
+		return fail(stderr, "decode", err)
+	}
+	fmt.Fprintf(stdout, "%s: 已恢复 %d 字节\n", *out, s.m.ObjectSize)
+	return exitOK
+}
+
+// decodeFile 重建丢失或损坏的数据分片（只写入临时文件），然后合并输出
+func decodeFile(s *shardSet, states []shardState, out string) (err error) {
+	var targets []int
+	for i := 0; i < s.m.DataShards; i++ {
+		if states[i] != shardOK {
+			targets = append(targets, i)
+		}
+	}
+	replaced := make(map[int]string)
+	if len(targets) > 0 {
+		tmps, err := s.rebuild(states, targets)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			for _, p := range tmps {
+				os.Remove(p)
+			}
+		}()
+		for n, i := range targets {
+			replaced[i] = tmps[n]
+		}
+	}
+
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return
+		}
+		err = os.Rename(tmp, out)
+	}()
+	return s.join(f, replaced)
+}
+
+// runVerify 检查分片集中每个分片的长度和摘要
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("verify", "前缀", stderr)
+	quiet := fs.Bool("q", false, "只输出有问题的分片")
+	prefix, code := parseArgs(fs, args)
+	if code >= 0 {
+		return code
+	}
+
+	s, err := openShardSet(prefix)
+	if err != nil {
+		return fail(stderr, "verify", err)
+	}
+	states, err := s.check()
+	if err != nil {
+		return fail(stderr, "verify", err)
+	}
+
+	bad := 0
+	for i, st := range states {
+		if st != shardOK {
+			bad++
+		}
+		if st != shardOK || !*quiet {
+			fmt.Fprintf(stdout, "%s: %s\n", shardPath(prefix, i), st)
+		}
+	}
+	switch {
+	case bad == 0:
+		fmt.Fprintf(stdout, "%d 个分片全部完好\n", len(states))
+		return exitOK
+	case s.enc.CanReconstruct(intact(states)):
+		fmt.Fprintf(stdout, "%d 个分片丢失或损坏，可以修复\n", bad)
+		return exitDamaged
+	default:
+		fmt.Fprintf(stdout, "%d 个分片丢失或损坏，%v\n", bad, errUnrecoverable)
+		return exitUnrecoverable
+	}
+}
+
+// runRepair 重新生成丢失或损坏的分片并原地替换
+func runRepair(args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("repair", "前缀", stderr)
+	block := fs.Int("block", 0, "流处理块大小（字节），0 表示默认值")
+	prefix, code := parseArgs(fs, args)
+	if code >= 0 {
+		return code
+	}
+
+	s, err := openShardSet(prefix, rs.WithStreamBlockSize(*block))
+	if err != nil {
+		return fail(stderr, "repair", err)
+	}
+	states, err := s.check()
+	if err != nil {
+		return fail(stderr, "repair", err)
+	}
+	var targets []int
+	for i, st := range states {
+		if st != shardOK {
+			targets = append(targets, i)
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Fprintf(stdout, "%d 个分片全部完好，无需修复\n", len(states))
+		return exitOK
+	}
+
+	tmps, err := s.rebuild(states, targets)
+	if err != nil {
+		return fail(stderr, "repair", err)
+	}
+	for n, i := range targets {
+		if err := os.Rename(tmps[n], shardPath(prefix, i)); err != nil {
+			for _, p := range tmps[n:] {
+				os.Remove(p)
+			}
+			return fail(stderr, "repair", err)
+		}
+		fmt.Fprintf(stdout, "%s: 已修复（原状态: %s）\n", shardPath(prefix, i), states[i])
+	}
+	return exitOK
+}
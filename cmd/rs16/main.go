@@ -0,0 +1,141 @@
+/**
+ * rs16 - Reed-Solomon 分片命令行工具
+ *
+ * Copyright 2024
+ */
+
+// rs16 把文件拆分成 k+m 个分片文件，并从任意 k 个分片恢复原文件
+//
+// 用法:
+//
+//	rs16 encode [-k 10] [-m 4] [-dir 目录] 文件   生成 文件.0 ... 文件.N 和 文件.manifest
+//	rs16 decode [-o 输出] 前缀                    从任意 k 个完好的分片恢复原文件
+//	rs16 verify 前缀                              检查分片集
+//	rs16 repair 前缀                              重新生成丢失或损坏的分片
+//	rs16 bench [-k 10,50] [-m 4,20] [-size 64k]   测量每条内核路径的编码和重建吞吐量
+//	rs16 selftest                                 对每条内核路径运行已知答案测试
+//
+// 分片总数不超过256时使用 GF(2^8)，否则使用 GF(2^16)，与 reedsolomon.New 一致。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 退出码
+const (
+	exitOK            = 0 // 成功
+	exitError         = 1 // 运行错误，例如读写失败
+	exitUsage         = 2 // 参数错误
+	exitDamaged       = 3 // 分片集有丢失或损坏，但可以修复
+	exitUnrecoverable = 4 // 完好的分片不足，无法恢复
+	exitSelfTest      = 5 // 内核自检失败
+)
+
+// command 是一个子命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"encode", "把文件拆分成 k+m 个分片", runEncode},
+		{"decode", "从任意 k 个分片恢复文件", runDecode},
+		{"verify", "检查分片集", runVerify},
+		{"repair", "重新生成丢失或损坏的分片", runRepair},
+		{"bench", "测量编码和重建吞吐量", runBench},
+		{"selftest", "检查 SIMD 内核的计算结果", runSelfTest},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run 执行子命令并返回退出码
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:], stdout, stderr)
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "rs16: 未知命令 %q\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "用法: rs16 <命令> [参数]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "退出码: 0 成功, 1 运行错误, 2 参数错误, 3 分片丢失或损坏但可修复, 4 无法恢复, 5 内核自检失败")
+}
+
+// newFlagSet 创建子命令的参数解析器
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "用法: rs16 %s [参数] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs 解析参数并要求恰好一个位置参数
+func parseArgs(fs *flag.FlagSet, args []string) (string, int) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return "", exitOK
+		}
+		return "", exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", exitUsage
+	}
+	return fs.Arg(0), -1
+}
+
+// parseNoArgs 解析参数并要求没有位置参数
+func parseNoArgs(fs *flag.FlagSet, args []string) int {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	return -1
+}
+
+// fail 打印错误并返回对应的退出码
+func fail(stderr io.Writer, cmd string, err error) int {
+	fmt.Fprintf(stderr, "rs16 %s: %v\n", cmd, err)
+	if errors.Is(err, errUnrecoverable) {
+		return exitUnrecoverable
+	}
+	return exitError
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rs "github.com/bpfs/reedsolomon16"
+)
+
+// 测试 encode/verify/repair/decode 的完整流程和退出码
+func TestCommands(t *testing.T) {
+	// 10+4 使用 GF(2^8)，200+60 使用 GF(2^16)
+	testCommands(t, "10", "4", 100000)
+	testCommands(t, "200", "60", 300000)
+}
+
+func testCommands(t *testing.T, k, m string, size int) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "data.bin")
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	if err := os.WriteFile(in, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	expect := func(want int, args ...string) {
+		t.Helper()
+		stdout.Reset()
+		stderr.Reset()
+		if got := run(args, &stdout, &stderr); got != want {
+			t.Fatalf("rs16 %v: 期望退出码 %d，实际 %d\n%s%s", args, want, got, stdout.String(), stderr.String())
+		}
+	}
+
+	out := filepath.Join(dir, "shards")
+	if err := os.Mkdir(out, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	prefix := filepath.Join(out, "data.bin")
+	expect(exitOK, "encode", "-k", k, "-m", m, "-block", "4096", "-dir", out, in)
+	expect(exitOK, "verify", "-q", prefix)
+
+	// 删除一个数据分片、损坏最后一个数据分片和一个校验分片
+	if err := os.Remove(shardPath(prefix, 0)); err != nil {
+		t.Fatal(err)
+	}
+	s, err := openShardSet(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k0 := s.m.DataShards
+	for _, i := range []int{k0 - 1, k0 + 1} {
+		p := shardPath(prefix, i)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[len(b)/2] ^= 0xff
+		if err := os.WriteFile(p, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(exitDamaged, "verify", "-q", prefix)
+
+	// 分片损坏时仍能恢复原文件
+	restored := filepath.Join(dir, "restored.bin")
+	expect(exitOK, "decode", "-o", restored, prefix)
+	got, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("恢复的文件不一致")
+	}
+	expect(exitUsage, "decode", "-o", restored, prefix)
+
+	expect(exitOK, "repair", prefix)
+	expect(exitOK, "verify", "-q", prefix)
+
+	// 删除过多分片后无法恢复
+	for i := 0; i <= s.m.ParityShards; i++ {
+		if err := os.Remove(shardPath(prefix, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(exitUnrecoverable, "verify", "-q", prefix)
+	expect(exitUnrecoverable, "repair", prefix)
+	expect(exitUnrecoverable, "decode", "-f", "-o", restored, prefix)
+
+	expect(exitUsage, "encode", "-k", "0", in)
+	expect(exitUsage, "bogus")
+	expect(exitError, "verify", filepath.Join(dir, "missing"))
+}
+
+// 测试 selftest 和 bench 子命令
+func TestBenchSelfTest(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"selftest"}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("selftest 退出码 %d\n%s%s", code, stdout.String(), stderr.String())
+	}
+	for _, p := range rs.SupportedKernels() {
+		if !strings.Contains(stdout.String(), string(p)+" ") {
+			t.Fatalf("selftest 没有报告 %s\n%s", p, stdout.String())
+		}
+	}
+
+	// 未通过测试的路径应被报告并返回 exitSelfTest
+	failed := rs.SupportedKernels()[0]
+	checkKernel = func(p rs.KernelPath) error {
+		if p == failed {
+			return rs.KernelError{Path: p, Funcs: []string{"mulAdd"}}
+		}
+		return rs.CheckKernel(p)
+	}
+	stdout.Reset()
+	code := run([]string{"selftest"}, &stdout, &stderr)
+	checkKernel = rs.CheckKernel
+	if code != exitSelfTest || !strings.Contains(stdout.String(), fmt.Sprintf("%-10s 失败", failed)) {
+		t.Fatalf("selftest 退出码 %d\n%s", code, stdout.String())
+	}
+
+	paths := rs.AvailableKernels()
+	active := rs.ActiveKernel()
+
+	stdout.Reset()
+	args := []string{"bench", "-k", "4,300", "-m", "2", "-size", "4k", "-time", "1ms"}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("bench 退出码 %d\n%s", code, stderr.String())
+	}
+	for _, p := range paths {
+		// 4+2 测试两个域，300+2 只测试 GF(2^16)
+		if n := strings.Count(stdout.String(), "\n"+string(p)+" "); n != 3 {
+			t.Fatalf("%s 期望 3 行结果，实际 %d\n%s", p, n, stdout.String())
+		}
+	}
+	if rs.ActiveKernel() != active {
+		t.Fatalf("bench 后内核应恢复为 %s，实际 %s", active, rs.ActiveKernel())
+	}
+
+	if code := run([]string{"bench", "-kernel", "bogus"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("期望退出码 %d，实际 %d", exitUsage, code)
+	}
+	if code := run([]string{"bench", "-size", "0"}, &stdout, &stderr); code != exitUsage {
+		t.Fatalf("期望退出码 %d，实际 %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,236 @@
+/**
+ * rs16 - 分片集文件
+ *
+ * Copyright 2024
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	rs "github.com/bpfs/reedsolomon16"
+)
+
+// errUnrecoverable 表示完好的分片不足 k 个
+var errUnrecoverable = errors.New("完好的分片不足，无法恢复")
+
+// 分片状态
+type shardState int
+
+const (
+	shardOK      shardState = iota // 分片完好
+	shardMissing                   // 分片文件不存在
+	shardDamaged                   // 分片长度或摘要与清单不一致
+)
+
+func (s shardState) String() string {
+	switch s {
+	case shardOK:
+		return "完好"
+	case shardMissing:
+		return "丢失"
+	default:
+		return "损坏"
+	}
+}
+
+// shardPath 返回第 i 个分片的文件名
+func shardPath(prefix string, i int) string {
+	return fmt.Sprintf("%s.%d", prefix, i)
+}
+
+// manifestPath 返回清单的文件名
+func manifestPath(prefix string) string {
+	return prefix + ".manifest"
+}
+
+// shardSet 是磁盘上的一组分片文件及其清单
+type shardSet struct {
+	prefix string
+	m      *rs.Manifest
+	enc    rs.ReedSolomon
+}
+
+// openShardSet 读取清单并创建对应的编解码器
+func openShardSet(prefix string, opts ...rs.Option) (*shardSet, error) {
+	b, err := os.ReadFile(manifestPath(prefix))
+	if err != nil {
+		return nil, err
+	}
+	var m rs.Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestPath(prefix), err)
+	}
+	enc, err := m.NewEncoder(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &shardSet{prefix: prefix, m: &m, enc: enc}, nil
+}
+
+// writeManifest 以 JSON 保存清单
+func writeManifest(prefix string, m *rs.Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(manifestPath(prefix), append(b, '\n'))
+}
+
+// writeFileAtomic 先写临时文件再重命名，避免留下写了一半的文件
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// check 根据清单检查每个分片
+func (s *shardSet) check() ([]shardState, error) {
+	states := make([]shardState, s.m.TotalShards())
+	for i := range states {
+		f, err := os.Open(shardPath(s.prefix, i))
+		if errors.Is(err, os.ErrNotExist) {
+			states[i] = shardMissing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = s.m.CheckShard(i, f)
+		f.Close()
+		switch {
+		case err == nil:
+			states[i] = shardOK
+		case errors.Is(err, rs.ErrShardHashMismatch):
+			states[i] = shardDamaged
+		default:
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// intact 返回完好分片的标记
+func intact(states []shardState) []bool {
+	present := make([]bool, len(states))
+	for i, st := range states {
+		present[i] = st == shardOK
+	}
+	return present
+}
+
+// zeroReader 无限输出0
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// rebuild 从完好的分片重建 targets 中的分片，写入 分片名.tmp 并校验摘要
+// 返回临时文件名，调用方负责重命名或删除。出错时已生成的临时文件会被删除。
+func (s *shardSet) rebuild(states []shardState, targets []int) (tmps []string, err error) {
+	present := intact(states)
+	if !s.enc.CanReconstruct(present) {
+		return nil, errUnrecoverable
+	}
+
+	total := s.m.TotalShards()
+	inputs := make([]io.Reader, total)
+	outputs := make([]io.Writer, total)
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			for _, p := range tmps {
+				os.Remove(p)
+			}
+			tmps = nil
+		}
+	}()
+
+	// 只打开计划选出的 k 个分片，较短的分片补零到 ShardSize
+	sel, err := rs.NewPlanner(s.enc, nil).Select(present)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range sel {
+		f, err := os.Open(shardPath(s.prefix, i))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		pad := s.m.ShardSize - s.m.ShardLen(i)
+		inputs[i] = io.MultiReader(f, io.LimitReader(zeroReader{}, pad))
+	}
+	for _, i := range targets {
+		p := shardPath(s.prefix, i) + ".tmp"
+		f, err := os.Create(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		tmps = append(tmps, p)
+		outputs[i] = f
+	}
+
+	if err := s.enc.StreamReconstruct(inputs, outputs); err != nil {
+		return nil, err
+	}
+
+	// 重建结果按 ShardSize 输出，截断到清单记录的长度后校验
+	for n, i := range targets {
+		f := outputs[i].(*os.File)
+		if err := f.Truncate(s.m.ShardLen(i)); err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if err := s.m.CheckShard(i, f); err != nil {
+			return nil, fmt.Errorf("%s: 重建结果校验失败: %w", tmps[n], err)
+		}
+	}
+	return tmps, nil
+}
+
+// join 从数据分片恢复原文件并校验对象摘要
+// replaced 中的分片从给定的文件读取，用于使用重建出的临时分片。
+func (s *shardSet) join(dst io.Writer, replaced map[int]string) (err error) {
+	readers := make([]io.Reader, s.m.DataShards)
+	for i := range readers {
+		p, ok := replaced[i]
+		if !ok {
+			p = shardPath(s.prefix, i)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers[i] = f
+	}
+
+	h := sha256.New()
+	if err := s.enc.StreamJoin(io.MultiWriter(dst, h), readers, s.m.ObjectSize); err != nil {
+		return err
+	}
+	var sum rs.Digest
+	h.Sum(sum[:0])
+	if sum != s.m.ObjectHash {
+		return fmt.Errorf("恢复的文件与清单中的摘要不一致: %w", rs.ErrShardHashMismatch)
+	}
+	return nil
+}
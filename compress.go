@@ -0,0 +1,322 @@
+/**
+ * Reed-Solomon 编码库 - 压缩
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// Compressor 是拆分前对数据进行压缩的算法
+// Name 记录在清单中，恢复时通过 LookupCompressor 找到同名的算法解压。
+type Compressor interface {
+	Name() string                                  // 算法名称，不超过255字节
+	NewWriter(w io.Writer) (io.WriteCloser, error) // 压缩写入 w，Close 时写出剩余数据
+	NewReader(r io.Reader) (io.ReadCloser, error)  // 解压从 r 读取的数据
+}
+
+// 内置压缩算法的名称
+const (
+	CompressionFlate = "flate"
+	CompressionGzip  = "gzip"
+)
+
+// flateCompressor 使用 compress/flate
+type flateCompressor struct {
+	level int
+}
+
+// NewFlateCompressor 创建 compress/flate 压缩算法，level 与 flate.NewWriter 相同
+func NewFlateCompressor(level int) Compressor {
+	return flateCompressor{level: level}
+}
+
+func (c flateCompressor) Name() string { return CompressionFlate }
+
+func (c flateCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, c.level)
+}
+
+func (c flateCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+// gzipCompressor 使用 compress/gzip
+type gzipCompressor struct {
+	level int
+}
+
+// NewGzipCompressor 创建 compress/gzip 压缩算法，level 与 gzip.NewWriterLevel 相同
+func NewGzipCompressor(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+func (c gzipCompressor) Name() string { return CompressionGzip }
+
+func (c gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (c gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// 已注册的压缩算法
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[string]Compressor{
+		CompressionFlate: NewFlateCompressor(flate.DefaultCompression),
+		CompressionGzip:  NewGzipCompressor(gzip.DefaultCompression),
+	}
+)
+
+// RegisterCompressor 注册压缩算法，同名的算法被替换
+// 解压只使用 NewReader，因此同一算法的不同压缩级别无需分别注册。
+func RegisterCompressor(c Compressor) error {
+	if n := len(c.Name()); n == 0 || n > 255 {
+		return ErrUnknownCompressor
+	}
+	compressorsMu.Lock()
+	compressors[c.Name()] = c
+	compressorsMu.Unlock()
+	return nil
+}
+
+// LookupCompressor 按名称查找已注册的压缩算法
+func LookupCompressor(name string) (Compressor, error) {
+	compressorsMu.RLock()
+	c, ok := compressors[name]
+	compressorsMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownCompressor
+	}
+	return c, nil
+}
+
+// 压缩后的数据以自描述的头开始：magic(3)|version(1)|原始大小(8)|len(name)(1)|name，
+// 恢复时只凭数据本身就能找到压缩算法并检查解压出的大小。
+const (
+	compressMagic     = "RSZ"
+	compressVersion   = 1
+	compressHeaderLen = 13 // 不含算法名称
+)
+
+// appendCompressHeader 追加压缩数据头
+func appendCompressHeader(b []byte, name string, raw int64) []byte {
+	b = append(b, compressMagic...)
+	b = append(b, compressVersion)
+	b = binary.BigEndian.AppendUint64(b, uint64(raw))
+	b = append(b, byte(len(name)))
+	return append(b, name...)
+}
+
+// readCompressHeader 读取压缩数据头，返回压缩算法名称和原始大小
+func readCompressHeader(r io.Reader) (string, int64, error) {
+	var h [compressHeaderLen]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrCompressHeader
+		}
+		return "", 0, err
+	}
+	raw := binary.BigEndian.Uint64(h[4:12])
+	if string(h[:3]) != compressMagic || h[3] != compressVersion || raw > 1<<62 || h[12] == 0 {
+		return "", 0, ErrCompressHeader
+	}
+	name := make([]byte, h[12])
+	if _, err := io.ReadFull(r, name); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrCompressHeader
+		}
+		return "", 0, err
+	}
+	return string(name), int64(raw), nil
+}
+
+// compressedSpool 是暂存在临时文件中的压缩结果（包括压缩数据头）
+// StreamSplit 需要事先知道数据大小，而压缩后的大小只有压缩完成后才知道。
+type compressedSpool struct {
+	f    *os.File
+	raw  int64 // 原始数据大小
+	size int64 // 压缩数据头加压缩后的大小
+}
+
+// compressToTemp 压缩 r 的全部内容到临时文件，返回定位到开头的暂存文件
+func compressToTemp(c Compressor, r io.Reader) (*compressedSpool, error) {
+	if n := len(c.Name()); n == 0 || n > 255 {
+		return nil, ErrUnknownCompressor
+	}
+	f, err := os.CreateTemp("", "reedsolomon-compress-*")
+	if err != nil {
+		return nil, err
+	}
+	s := &compressedSpool{f: f}
+	if err := s.fill(c, r); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *compressedSpool) fill(c Compressor, r io.Reader) error {
+	// 原始大小在压缩完成后才知道，先写入0再回填
+	if _, err := s.f.Write(appendCompressHeader(nil, c.Name(), 0)); err != nil {
+		return err
+	}
+	zw, err := c.NewWriter(s.f)
+	if err != nil {
+		return err
+	}
+	if s.raw, err = io.Copy(zw, r); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if _, err := s.f.WriteAt(binary.BigEndian.AppendUint64(nil, uint64(s.raw)), 4); err != nil {
+		return err
+	}
+	if s.size, err = s.f.Seek(0, io.SeekCurrent); err != nil {
+		return err
+	}
+	_, err = s.f.Seek(0, io.SeekStart)
+	return err
+}
+
+// Read 读取压缩后的数据
+func (s *compressedSpool) Read(p []byte) (int, error) {
+	return s.f.Read(p)
+}
+
+// Close 删除临时文件
+func (s *compressedSpool) Close() error {
+	s.f.Close()
+	return os.Remove(s.f.Name())
+}
+
+// filterWriter 把写入的数据通过管道交给在另一个协程中运行的 filter
+// filter 从管道读取数据并把结果写入最终的目标；Close 等待 filter 结束并返回它的错误。
+type filterWriter struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// newFilterWriter 启动 filter 并返回向它写入数据的写入器
+func newFilterWriter(filter func(r io.Reader) error) *filterWriter {
+	pr, pw := io.Pipe()
+	f := &filterWriter{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := filter(pr)
+		// filter 提前结束时让写入端返回错误，而不是阻塞
+		pr.CloseWithError(err)
+		f.done <- err
+	}()
+	return f
+}
+
+// Write 实现 io.Writer
+func (f *filterWriter) Write(p []byte) (int, error) {
+	return f.pw.Write(p)
+}
+
+// Close 结束写入并等待 filter 完成
+func (f *filterWriter) Close() error {
+	return f.CloseWithError(nil)
+}
+
+// CloseWithError 结束写入并等待 filter 完成；err 不为nil时中止 filter 并返回 err
+func (f *filterWriter) CloseWithError(err error) error {
+	f.pw.CloseWithError(err)
+	ferr := <-f.done
+	if err != nil {
+		return err
+	}
+	return ferr
+}
+
+// newDecompressWriter 创建按压缩数据头记录的算法解压并写入 w 的写入器
+// m 不为nil时数据头必须与清单记录的压缩算法和原始大小一致，否则 Close 返回 ErrShardHashMismatch；
+// 解压出的大小与原始大小不一致时同样返回 ErrShardHashMismatch。
+func newDecompressWriter(m *Manifest, w io.Writer) *filterWriter {
+	return newFilterWriter(func(r io.Reader) error {
+		return decompressTo(m, r, w)
+	})
+}
+
+// decompressTo 读取压缩数据头，解压 r 的其余部分并写入 w，检查原始大小
+func decompressTo(m *Manifest, r io.Reader, w io.Writer) error {
+	name, raw, err := readCompressHeader(r)
+	if err != nil {
+		return err
+	}
+	if m != nil && (name != m.Compression || raw != m.RawSize) {
+		return ErrShardHashMismatch
+	}
+	c, err := LookupCompressor(name)
+	if err != nil {
+		return err
+	}
+	zr, err := c.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if _, err := io.CopyN(w, zr, raw); err != nil {
+		if err == io.EOF {
+			err = ErrShardHashMismatch
+		}
+		return err
+	}
+	// 解压出的数据不应比清单记录的更长
+	var one [1]byte
+	if _, err := io.ReadFull(zr, one[:]); err != io.EOF {
+		if err == nil {
+			err = ErrShardHashMismatch
+		}
+		return err
+	}
+	// 读完剩余的数据，使写入端不会阻塞
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StreamSplitCompressed 用 c 压缩 data 后流式拆分到 dst
+// 拆分的数据以记录压缩算法和原始大小的数据头开始，恢复时不需要其他信息。
+// 压缩结果先暂存到临时文件，因为 StreamSplit 需要事先知道大小。返回的清单构建器同样记录了
+// 压缩算法、原始大小和拆分的数据大小（ObjectSize）；用它的 ParityWriters 包装校验分片输出并调用
+// StreamEncode 之后，Manifest 返回完整的清单，恢复时把 ObjectSize 交给 StreamJoinCompressed。
+func StreamSplitCompressed(enc ReedSolomon, c Compressor, data io.Reader, dst []io.Writer) (*ManifestBuilder, error) {
+	s, err := compressToTemp(c, data)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	b, err := NewManifestBuilder(enc, s.size)
+	if err != nil {
+		return nil, err
+	}
+	b.m.Compression, b.m.RawSize = c.Name(), s.raw
+	if err := enc.StreamSplit(b.Object(s), b.DataWriters(dst), s.size); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// StreamJoinCompressed 合并 StreamSplitCompressed 拆分的数据分片，解压后写入 dst
+// outSize 与 StreamJoin 相同，是拆分的数据大小。压缩算法和原始大小从数据头读取，
+// 算法按名称从已注册的算法中查找；数据头无效时返回 ErrCompressHeader，
+// 解压出的大小与数据头记录的不一致时返回 ErrShardHashMismatch。
+func StreamJoinCompressed(enc ReedSolomon, dst io.Writer, shards []io.Reader, outSize int64) error {
+	d := newDecompressWriter(nil, dst)
+	return d.CloseWithError(enc.StreamJoin(d, shards, outSize))
+}
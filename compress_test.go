@@ -0,0 +1,193 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/fstest"
+)
+
+// compressibleData 生成一半可压缩、一半随机的数据
+func compressibleData(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n/2; i++ {
+		data[i] = "reed-solomon "[i%13]
+	}
+	rng.Read(data[n/2:])
+	return data
+}
+
+// 测试压缩后流式拆分、编码，丢失数据分片后重建并解压
+func TestStreamCompressed(t *testing.T) {
+	testStreamCompressed(t, 10, 4, NewFlateCompressor(flate.BestSpeed), false)
+	testStreamCompressed(t, 10, 4, NewGzipCompressor(flate.DefaultCompression), true)
+	testStreamCompressed(t, 250, 20, NewGzipCompressor(flate.BestCompression), true)
+}
+
+func testStreamCompressed(t *testing.T, dataShards, parityShards int, c Compressor, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+	data := compressibleData(200000, int64(total))
+
+	bufs := make([]bytes.Buffer, total)
+	dst := make([]io.Writer, total)
+	for i := range dst {
+		dst[i] = &bufs[i]
+	}
+	b, err := StreamSplitCompressed(enc, c, bytes.NewReader(data), dst[:dataShards])
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make([]io.Reader, dataShards)
+	for i := range in {
+		in[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	if err := enc.StreamEncode(in, b.ParityWriters(dst[dataShards:])); err != nil {
+		t.Fatal(err)
+	}
+	m, err := b.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Compression != c.Name() || m.RawSize != int64(len(data)) || m.ObjectSize >= m.RawSize {
+		t.Fatalf("清单: 压缩 %q，原始大小 %d，对象大小 %d", m.Compression, m.RawSize, m.ObjectSize)
+	}
+
+	// 恢复端只需要拆分的数据大小：重建丢失的数据分片后按数据头解压
+	inputs := make([]io.Reader, total)
+	outputs := make([]io.Writer, total)
+	rebuilt := make([]bytes.Buffer, dataShards)
+	for i := range inputs {
+		if i == 0 || i == dataShards/2 {
+			outputs[i] = &rebuilt[i]
+			continue
+		}
+		inputs[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	if err := enc.StreamReconstructData(inputs, outputs); err != nil {
+		t.Fatal(err)
+	}
+	shards := make([]io.Reader, dataShards)
+	for i := range shards {
+		if outputs[i] != nil {
+			shards[i] = bytes.NewReader(rebuilt[i].Bytes())
+		} else {
+			shards[i] = bytes.NewReader(bufs[i].Bytes())
+		}
+	}
+	var out bytes.Buffer
+	if err := StreamJoinCompressed(enc, &out, shards, m.ObjectSize); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("解压后的数据不一致")
+	}
+
+	// 数据头被破坏：magic、原始大小、算法名称
+	for _, tc := range []struct {
+		off  int
+		want error
+	}{
+		{0, ErrCompressHeader},
+		{11, ErrShardHashMismatch},
+		{compressHeaderLen, ErrUnknownCompressor},
+	} {
+		shards := make([]io.Reader, dataShards)
+		for i := range shards {
+			b := bytes.Clone(bufs[i].Bytes())
+			if i == 0 {
+				b[tc.off] ^= 1
+			}
+			shards[i] = bytes.NewReader(b)
+		}
+		if err := StreamJoinCompressed(enc, io.Discard, shards, m.ObjectSize); err != tc.want {
+			t.Fatalf("修改第 %d 字节: 期望 %v，实际 %v", tc.off, tc.want, err)
+		}
+	}
+
+	// 与数据头不一致的清单
+	for _, bad := range []Manifest{{Compression: m.Compression, RawSize: m.RawSize + 1}, {Compression: "zstd", RawSize: m.RawSize}} {
+		var joined bytes.Buffer
+		shards := make([]io.Reader, dataShards)
+		for i := range shards {
+			shards[i] = bytes.NewReader(bufs[i].Bytes())
+		}
+		if err := enc.StreamJoin(&joined, shards, m.ObjectSize); err != nil {
+			t.Fatal(err)
+		}
+		d := newDecompressWriter(&bad, io.Discard)
+		joined.WriteTo(d)
+		if err := d.Close(); err != ErrShardHashMismatch {
+			t.Fatalf("清单 %q/%d: 期望 ErrShardHashMismatch，实际 %v", bad.Compression, bad.RawSize, err)
+		}
+	}
+}
+
+// 测试压缩的对象存储：读取时按清单解压，丢失分片后仍能读取
+func TestObjectStoreCompressed(t *testing.T) {
+	enc, err := New(6, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := newTestDirStore(t, 9)
+	s := NewObjectStore(ds, enc).WithCompressor(NewGzipCompressor(flate.DefaultCompression))
+	data := compressibleData(100000, 1)
+	m, err := s.Put("obj", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Compression != CompressionGzip || m.RawSize != int64(len(data)) {
+		t.Fatalf("清单 %+v", m)
+	}
+	if _, err := s.Put("short", bytes.NewReader(data), int64(len(data))+1); err != ErrShortData {
+		t.Fatalf("期望 ErrShortData，实际 %v", err)
+	}
+
+	// 不压缩的对象存储也能读取压缩的对象
+	plain := NewObjectStore(ds, enc)
+	for _, idx := range []int{0, 4} {
+		if err := ds.Delete("obj", idx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rc, err := plain.Get("obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("读取的数据不一致")
+	}
+	st, err := plain.Stat("obj")
+	if err != nil || st.Compression != CompressionGzip {
+		t.Fatalf("Stat: %+v %v", st, err)
+	}
+
+	// 压缩的对象无法按偏移读取，不通过 ShardFS 提供
+	mj, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfs := NewShardFS(fstest.MapFS{"obj" + ManifestSuffix: {Data: mj}})
+	if _, err := sfs.Open("obj"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("期望 ErrNotSupported，实际 %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+/**
+ * Reed-Solomon 编码库 - 本地目录分片存储
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// manifestFile 是清单在每个目录中的文件名
+const manifestFile = "manifest"
+
+// DirStore 把分片存放在多个本地目录（通常是不同磁盘的挂载点）中
+// 对象 id 的第 i 个分片保存为 目录/id/i，同一对象的分片按 id 的哈希轮转放置，
+// 因此只要分片数量不超过目录数量，同一条带的任意两个分片都不会位于同一目录。
+// 清单（ManifestIndex）在每个目录中各保存一份。
+// 所有写入都先写临时文件，同步后再重命名，不会留下写了一半的分片。
+type DirStore struct {
+	dirs []string
+	devs []uint64 // 创建时各目录所在的设备，平台不支持时为nil
+}
+
+// NewDirStore 创建目录分片存储，目录必须已经存在
+// 不会自动创建目录，以免在磁盘未挂载时把分片写到挂载点下面的系统盘上；
+// 每次写入前都重新检查目录仍然存在，并且（在支持的平台上）仍位于创建时的设备上。
+func NewDirStore(dirs ...string) (*DirStore, error) {
+	if len(dirs) == 0 {
+		return nil, ErrInvalidInput
+	}
+	seen := make(map[string]bool)
+	var devs []uint64
+	for _, d := range dirs {
+		fi, err := os.Stat(d)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			return nil, fmt.Errorf("%s: 不是目录: %w", d, ErrInvalidInput)
+		}
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return nil, err
+		}
+		if seen[abs] {
+			return nil, fmt.Errorf("%s: 目录重复: %w", d, ErrInvalidInput)
+		}
+		seen[abs] = true
+		if dev, ok := dirDevice(fi); ok {
+			devs = append(devs, dev)
+		}
+	}
+	if len(devs) != len(dirs) {
+		devs = nil
+	}
+	return &DirStore{dirs: append([]string(nil), dirs...), devs: devs}, nil
+}
+
+// Dirs 返回存储使用的目录
+func (s *DirStore) Dirs() []string {
+	return append([]string(nil), s.dirs...)
+}
+
+// ShardDir 返回对象 id 的第 index 个分片所在的目录
+func (s *DirStore) ShardDir(id string, index int) (string, error) {
+	d, err := s.shardDirIndex(id, index)
+	if err != nil {
+		return "", err
+	}
+	return s.dirs[d], nil
+}
+
+// shardDirIndex 返回对象 id 的第 index 个分片所在目录的序号
+func (s *DirStore) shardDirIndex(id string, index int) (int, error) {
+	if err := validObjectID(id); err != nil {
+		return 0, err
+	}
+	if index < 0 || index >= len(s.dirs) {
+		return 0, ErrPlacement
+	}
+	h := fnv.New32a()
+	io.WriteString(h, id)
+	return (int(h.Sum32()%uint32(len(s.dirs))) + index) % len(s.dirs), nil
+}
+
+// shardPath 返回分片文件的路径
+func (s *DirStore) shardPath(id string, index int) (string, error) {
+	dir, err := s.ShardDir(id, index)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id, strconv.Itoa(index)), nil
+}
+
+// objectDir 检查第 d 个目录后返回其中对象 id 的子目录，子目录不存在时创建
+// 目录不存在或已不在创建存储时的设备上（例如磁盘被卸载，只剩下挂载点）时返回 ErrDirChanged。
+func (s *DirStore) objectDir(d int, id string) (string, error) {
+	fi, err := os.Stat(s.dirs[d])
+	if err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("%s: %w", s.dirs[d], ErrDirChanged)
+	}
+	if s.devs != nil {
+		if dev, ok := dirDevice(fi); !ok || dev != s.devs[d] {
+			return "", fmt.Errorf("%s: %w", s.dirs[d], ErrDirChanged)
+		}
+	}
+	dir := filepath.Join(s.dirs[d], id)
+	if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", err
+	}
+	return dir, nil
+}
+
+// Put 原子地写入分片，已存在的分片会被替换
+// 清单写入每个目录，任何一个目录写入失败都返回错误。
+func (s *DirStore) Put(id string, index int, r io.Reader) error {
+	return s.put(id, index, r, true)
+}
+
+// Create 与 Put 相同，但分片已存在时不替换，返回满足 errors.Is(err, fs.ErrExist) 的错误，实现 ExclusiveStore
+// 清单按目录顺序逐个创建，某个目录中已存在时删除本次已创建的副本，
+// 因此并发创建同一对象的清单时只有一个会成功。
+func (s *DirStore) Create(id string, index int, r io.Reader) error {
+	return s.put(id, index, r, false)
+}
+
+// put 写入分片，replace 为 false 时不替换已存在的分片
+func (s *DirStore) put(id string, index int, r io.Reader, replace bool) error {
+	if index == ManifestIndex {
+		if err := validObjectID(id); err != nil {
+			return err
+		}
+		// 清单很小，先读入内存以便写入多份
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var created []string
+		for d := range s.dirs {
+			dir, err := s.objectDir(d, id)
+			if err == nil {
+				p := filepath.Join(dir, manifestFile)
+				if err = writeFileAtomic(p, bytes.NewReader(b), replace); err == nil {
+					created = append(created, p)
+					continue
+				}
+			}
+			if !replace {
+				for _, p := range created {
+					os.Remove(p)
+				}
+			}
+			return err
+		}
+		return nil
+	}
+	d, err := s.shardDirIndex(id, index)
+	if err != nil {
+		return err
+	}
+	dir, err := s.objectDir(d, id)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, strconv.Itoa(index)), r, replace)
+}
+
+// Get 打开分片用于读取，分片不存在时返回的错误满足 errors.Is(err, fs.ErrNotExist)
+// 读取清单时依次尝试每个目录，返回第一份可以打开的清单。
+func (s *DirStore) Get(id string, index int) (io.ReadCloser, error) {
+	if index == ManifestIndex {
+		if err := validObjectID(id); err != nil {
+			return nil, err
+		}
+		var first error
+		for _, d := range s.dirs {
+			f, err := os.Open(filepath.Join(d, id, manifestFile))
+			if err == nil {
+				return f, nil
+			}
+			if first == nil || errors.Is(first, fs.ErrNotExist) {
+				first = err
+			}
+		}
+		return nil, first
+	}
+	p, err := s.shardPath(id, index)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete 删除分片，分片不存在时不返回错误
+// 删除清单时删除所有目录中的副本。对象目录为空时一并删除。
+func (s *DirStore) Delete(id string, index int) error {
+	var paths []string
+	if index == ManifestIndex {
+		if err := validObjectID(id); err != nil {
+			return err
+		}
+		for _, d := range s.dirs {
+			paths = append(paths, filepath.Join(d, id, manifestFile))
+		}
+	} else {
+		p, err := s.shardPath(id, index)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		// 目录非空时删除失败，忽略
+		os.Remove(filepath.Dir(p))
+	}
+	return nil
+}
+
+// List 返回对象已保存的分片序号（升序，不包括清单）
+// 无法读取的目录（例如磁盘丢失）被跳过，其中的分片视为不存在。
+func (s *DirStore) List(id string) ([]int, error) {
+	if err := validObjectID(id); err != nil {
+		return nil, err
+	}
+	var list []int
+	for _, d := range s.dirs {
+		entries, err := os.ReadDir(filepath.Join(d, id))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("跳过无法读取的目录 %s: %v", d, err)
+			}
+			continue
+		}
+		for _, e := range entries {
+			i, err := strconv.Atoi(e.Name())
+			if err != nil || i < 0 || !e.Type().IsRegular() {
+				continue
+			}
+			// 只承认位于放置位置的分片
+			if dir, err := s.ShardDir(id, i); err == nil && dir == d {
+				list = append(list, i)
+			}
+		}
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+// Objects 返回所有目录中出现过的对象 id（升序），实现 ObjectLister
+func (s *DirStore) Objects() ([]string, error) {
+	seen := make(map[string]bool)
+	for _, d := range s.dirs {
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			logger.Warn("跳过无法读取的目录 %s: %v", d, err)
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() && validObjectID(e.Name()) == nil {
+				seen[e.Name()] = true
+			}
+		}
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// validObjectID 检查对象 id 可以安全地用作目录名
+func validObjectID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`+"\x00") {
+		return fmt.Errorf("%q: %w", id, ErrInvalidObjectID)
+	}
+	return nil
+}
+
+// writeFileAtomic 把 r 的内容写入同目录下的临时文件，同步后重命名为 path，所在目录必须已经存在
+// replace 为 false 时改用硬链接，path 已存在时返回满足 errors.Is(err, fs.ErrExist) 的错误。
+func writeFileAtomic(path string, r io.Reader, replace bool) (err error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if replace {
+		return os.Rename(f.Name(), path)
+	}
+	if err := os.Link(f.Name(), path); err != nil {
+		return err
+	}
+	return os.Remove(f.Name())
+}
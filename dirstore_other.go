@@ -0,0 +1,16 @@
+//go:build !unix
+
+/**
+ * Reed-Solomon 编码库 - 本地目录分片存储（不支持设备号的平台）
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import "io/fs"
+
+// dirDevice 在不支持设备号的平台上总是返回 false，此时只检查目录是否存在
+func dirDevice(fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+/**
+ * Reed-Solomon 编码库 - 本地目录分片存储（Unix 设备号）
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// dirDevice 返回文件所在的设备号
+func dirDevice(fi fs.FileInfo) (uint64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
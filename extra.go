@@ -0,0 +1,239 @@
+/**
+ * Reed-Solomon 编码库 - 额外校验分片
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"maps"
+	"slices"
+)
+
+// ExtraEncoder 是 GF(2^16) 编解码器实现的可选接口，按需生成超出 parityShards 的额外校验分片
+// 编解码器的分片是一个多项式在域中若干点上的取值，其余未使用的点可以作为新的校验分片：
+// 它们与原有分片一起构成更长的 MDS 码，原有分片和额外分片中的任意 k 个都可以恢复数据。
+// 额外分片的序号从 TotalShards() 开始，最多 MaxExtraShards() 个，同一序号每次生成的内容相同。
+//
+// GF(2^8) 的编解码器（New 在总分片数不超过256时返回）不实现该接口，需要时使用 New16 创建。
+type ExtraEncoder interface {
+	// MaxExtraShards 返回可以生成的额外校验分片数量
+	MaxExtraShards() int
+	// EncodeExtra 用 shards 中任意 k 个可用分片生成序号为 index 的额外校验分片
+	EncodeExtra(shards [][]byte, index int) ([]byte, error)
+	// ReconstructExtra 用 shards 中的可用分片和 extra 中的额外分片（按序号）重建 shards 中丢失的分片
+	ReconstructExtra(shards [][]byte, extra map[int][]byte) error
+}
+
+var _ ExtraEncoder = &leopardFF16{}
+
+// 编解码器的分片与域中点的对应关系（m = ceilPow2(parityShards)，n = ceilPow2(m+dataShards)）:
+//
+//	校验分片 j -> j，数据分片 i -> m+i，点 [m+k, n) 上的值恒为0，
+//
+// 整个码字是一个次数小于 n-m 的多项式 P 的取值。额外分片依次使用未占用的点 [parityShards, m) 和 [n, 65536)。
+// 记 Z(x) = Π_{z∈[m+k,n)} (x-z)，则 P = Z·Q，Q 的次数小于 k，已知任意 k 个点上的值即可用拉格朗日插值求出
+// 任意点上的值。特征为2时减法即异或。
+
+// shardPoint 返回分片或额外分片 index 对应的点
+func (r *leopardFF16) shardPoint(index int) (ffe, bool) {
+	m := ceilPow2(r.parityShards)
+	switch {
+	case index < 0:
+		return 0, false
+	case index < r.dataShards:
+		return ffe(m + index), true
+	case index < r.totalShards:
+		return ffe(index - r.dataShards), true
+	}
+	t := index - r.totalShards
+	if t < m-r.parityShards {
+		return ffe(r.parityShards + t), true
+	}
+	p := ceilPow2(m+r.dataShards) + t - (m - r.parityShards)
+	if p >= order {
+		return 0, false
+	}
+	return ffe(p), true
+}
+
+// MaxExtraShards 返回可以生成的额外校验分片数量
+func (r *leopardFF16) MaxExtraShards() int {
+	m := ceilPow2(r.parityShards)
+	return m - r.parityShards + order - ceilPow2(m+r.dataShards)
+}
+
+// logZ 返回 log Z(x)，x 不能是 [m+k, n) 中的点
+func (r *leopardFF16) logZ(x ffe) uint64 {
+	m := ceilPow2(r.parityShards)
+	var sum uint64
+	for z := m + r.dataShards; z < ceilPow2(m+r.dataShards); z++ {
+		sum += uint64(logLUT[x^ffe(z)])
+	}
+	return sum
+}
+
+// interpolator 是已知 k 个点时的插值系数
+type interpolator struct {
+	r      *leopardFF16
+	points []ffe
+	denom  []uint64 // log(Z(x_i)·Π_{j≠i}(x_i-x_j))，已取模
+}
+
+// newInterpolator 预先计算已知点的插值系数，计算量与 k×(n-m) 成正比
+func (r *leopardFF16) newInterpolator(points []ffe) *interpolator {
+	ip := &interpolator{r: r, points: points, denom: make([]uint64, len(points))}
+	for i, xi := range points {
+		sum := r.logZ(xi)
+		for j, xj := range points {
+			if j != i {
+				sum += uint64(logLUT[xi^xj])
+			}
+		}
+		ip.denom[i] = sum % modulus
+	}
+	return ip
+}
+
+// eval 由已知点上的分片 ys 计算点 beta 上的分片，写入 out
+// beta 不能是已知点，tmp 为与分片等长的临时空间。
+func (ip *interpolator) eval(ys [][]byte, beta ffe, out, tmp []byte) {
+	// log(Z(β)·Π_j(β-x_j))
+	num := ip.r.logZ(beta)
+	for _, x := range ip.points {
+		num += uint64(logLUT[beta^x])
+	}
+	num %= modulus
+	clear(out)
+	for i, x := range ip.points {
+		// c_i = Z(β)·Π_{j≠i}(β-x_j) / (Z(x_i)·Π_{j≠i}(x_i-x_j))
+		c := (num + 2*modulus - uint64(logLUT[beta^x]) - ip.denom[i]) % modulus
+		mulgf16(tmp, ys[i], ffe(c))
+		sliceXor(tmp, out)
+	}
+}
+
+// dataInterpolator 返回以数据分片为已知点的插值系数，只计算一次
+func (r *leopardFF16) dataInterpolator() *interpolator {
+	r.extraOnce.Do(func() {
+		points := make([]ffe, r.dataShards)
+		for i := range points {
+			points[i], _ = r.shardPoint(i)
+		}
+		r.extraData = r.newInterpolator(points)
+	})
+	return r.extraData
+}
+
+// EncodeExtra 生成序号为 index 的额外校验分片
+// 数据分片齐全时使用预先计算的插值系数，否则用任意 k 个可用分片插值；计算量与 k×分片大小成正比，
+// 另外在第一次调用或数据分片不全时需要与 k×(n-m) 成正比的预计算。
+func (r *leopardFF16) EncodeExtra(shards [][]byte, index int) ([]byte, error) {
+	if len(shards) != r.totalShards {
+		return nil, ErrTooFewShards
+	}
+	if err := checkShards(shards, true); err != nil {
+		return nil, err
+	}
+	size := shardSize(shards)
+	if size%64 != 0 {
+		return nil, ErrInvalidShardSize
+	}
+	beta, ok := r.shardPoint(index)
+	if !ok || index < r.totalShards {
+		return nil, ErrInvalidInput
+	}
+
+	var ip *interpolator
+	var ys [][]byte
+	if countMissing(shards[:r.dataShards]) == 0 {
+		ip, ys = r.dataInterpolator(), shards[:r.dataShards]
+	} else {
+		var points []ffe
+		for i, s := range shards {
+			if len(s) != 0 && len(ys) < r.dataShards {
+				p, _ := r.shardPoint(i)
+				points, ys = append(points, p), append(ys, s)
+			}
+		}
+		if len(ys) < r.dataShards {
+			return nil, ErrTooFewShards
+		}
+		ip = r.newInterpolator(points)
+	}
+	out := AllocAligned(2, size)
+	ip.eval(ys, beta, out[0], out[1])
+	return out[0], nil
+}
+
+// ReconstructExtra 用可用分片和额外分片重建丢失的数据分片和校验分片
+// 可用的原有分片不少于 k 个时等同于 Reconstruct；否则从原有分片和额外分片中取 k 个插值出丢失的数据分片，
+// 再重新生成丢失的校验分片。extra 的键为额外分片的序号。
+func (r *leopardFF16) ReconstructExtra(shards [][]byte, extra map[int][]byte) error {
+	if len(shards) != r.totalShards {
+		return ErrTooFewShards
+	}
+	present := r.totalShards - countMissing(shards)
+	if present >= r.dataShards {
+		return r.Reconstruct(shards)
+	}
+
+	size := 0
+	if present > 0 {
+		if err := checkShards(shards, true); err != nil {
+			return err
+		}
+		size = shardSize(shards)
+	}
+	var points []ffe
+	var ys [][]byte
+	for i, s := range shards {
+		if len(s) != 0 {
+			p, _ := r.shardPoint(i)
+			points, ys = append(points, p), append(ys, s)
+		}
+	}
+	for _, index := range slices.Sorted(maps.Keys(extra)) {
+		s := extra[index]
+		if len(ys) == r.dataShards {
+			break
+		}
+		if len(s) == 0 {
+			continue
+		}
+		p, ok := r.shardPoint(index)
+		if !ok || index < r.totalShards {
+			return ErrInvalidInput
+		}
+		if size == 0 {
+			size = len(s)
+		}
+		if len(s) != size {
+			return ErrShardSize
+		}
+		points, ys = append(points, p), append(ys, s)
+	}
+	if len(ys) < r.dataShards {
+		return ErrTooFewShards
+	}
+	if size%64 != 0 {
+		return ErrInvalidShardSize
+	}
+
+	ip := r.newInterpolator(points)
+	tmp := AllocAligned(1, size)[0]
+	for i := 0; i < r.dataShards; i++ {
+		if len(shards[i]) != 0 {
+			continue
+		}
+		if cap(shards[i]) >= size {
+			shards[i] = shards[i][:size]
+		} else {
+			shards[i] = AllocAligned(1, size)[0]
+		}
+		beta, _ := r.shardPoint(i)
+		ip.eval(ys, beta, shards[i], tmp)
+	}
+	return r.Reconstruct(shards)
+}
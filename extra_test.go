@@ -0,0 +1,119 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试额外校验分片：原有分片和额外分片中的任意 k 个都可以恢复数据
+func TestEncodeExtra(t *testing.T) {
+	testEncodeExtra(t, 5, 3)
+	testEncodeExtra(t, 20, 4)
+	testEncodeExtra(t, 100, 30)
+}
+
+func testEncodeExtra(t *testing.T, dataShards, parityShards int) {
+	enc, err := New16(dataShards, parityShards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex, ok := enc.(ExtraEncoder)
+	if !ok {
+		t.Fatal("GF(2^16) 编解码器没有实现 ExtraEncoder")
+	}
+	total := enc.TotalShards()
+	rng := rand.New(rand.NewSource(int64(total)))
+	shards := enc.AllocAligned(total, 64*4)
+	for i := 0; i < dataShards; i++ {
+		rng.Read(shards[i])
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// 额外分片覆盖填充位置 [parityShards, m) 和 n 之后的点，包括最后一个
+	m := ceilPow2(parityShards)
+	maxExtra := ex.MaxExtraShards()
+	indexes := []int{total, total + m - parityShards, total + maxExtra - 1}
+	for i := 0; i < dataShards; i++ {
+		indexes = append(indexes, total+1+rng.Intn(maxExtra-1))
+	}
+	indexes = uniqueInts(indexes)
+	if len(indexes) < dataShards {
+		t.Fatalf("额外分片只有 %d 个", len(indexes))
+	}
+	extra := make(map[int][]byte)
+	for _, idx := range indexes {
+		s, err := ex.EncodeExtra(shards, idx)
+		if err != nil {
+			t.Fatalf("额外分片 %d: %v", idx, err)
+		}
+		extra[idx] = s
+	}
+	if _, err := ex.EncodeExtra(shards, total+maxExtra); err != ErrInvalidInput {
+		t.Fatalf("期望 ErrInvalidInput，实际 %v", err)
+	}
+
+	// 用任意 k 个分片生成的额外分片相同
+	partial := append([][]byte(nil), shards...)
+	for i := 0; i < parityShards; i++ {
+		partial[i] = nil
+	}
+	again, err := ex.EncodeExtra(partial, indexes[len(indexes)-1])
+	if err != nil || !bytes.Equal(again, extra[indexes[len(indexes)-1]]) {
+		t.Fatalf("用不同分片生成的额外分片不一致: %v", err)
+	}
+
+	// 只保留少量原有分片，其余用额外分片补足
+	for _, keep := range []int{0, 1, dataShards / 2, dataShards - 1} {
+		work := make([][]byte, total)
+		for _, i := range rng.Perm(total)[:keep] {
+			work[i] = shards[i]
+		}
+		use := make(map[int][]byte)
+		for _, idx := range indexes[:dataShards-keep] {
+			use[idx] = extra[idx]
+		}
+		if err := ex.ReconstructExtra(work, use); err != nil {
+			t.Fatalf("保留 %d 个原有分片: %v", keep, err)
+		}
+		for i := range work {
+			if !bytes.Equal(work[i], shards[i]) {
+				t.Fatalf("保留 %d 个原有分片: 分片 %d 不一致", keep, i)
+			}
+		}
+		if keep == 0 {
+			work = make([][]byte, total)
+			delete(use, indexes[0])
+			if err := ex.ReconstructExtra(work, use); err != ErrTooFewShards {
+				t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+			}
+		}
+	}
+
+	if _, ok := mustNew8(t).(ExtraEncoder); ok {
+		t.Fatal("GF(2^8) 编解码器不应实现 ExtraEncoder")
+	}
+}
+
+// uniqueInts 去掉重复的值，保持顺序
+func uniqueInts(v []int) []int {
+	seen := make(map[int]bool)
+	out := v[:0]
+	for _, x := range v {
+		if !seen[x] {
+			seen[x] = true
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func mustNew8(t *testing.T) ReedSolomon {
+	enc, err := New8(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
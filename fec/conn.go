@@ -0,0 +1,528 @@
+/**
+ * Reed-Solomon 编码库 - 带前向纠错的 net.PacketConn
+ *
+ * Copyright 2024
+ */
+
+package fec
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	reedsolomon "github.com/bpfs/reedsolomon16"
+)
+
+// 默认参数
+const (
+	DefaultLatency    = 100 * time.Millisecond // 接收端每块等待丢失数据包的最长时间
+	DefaultFlushDelay = 20 * time.Millisecond  // 发送端不满的块在最后一个包之后多久发送修复包
+	inboxSize         = 256
+
+	peerIdle = time.Minute // 没有收发且没有未完成的块超过这一时间的对端被移除
+	maxPeers = 1024        // 收到的数据报最多创建的对端数量
+)
+
+// Config 是与一个对端通信时使用的参数
+type Config struct {
+	DataShards   int                  // 每块数据包数量 k
+	ParityShards int                  // 每块修复包数量 m
+	Latency      time.Duration        // 接收端每块等待丢失数据包的最长时间，默认 DefaultLatency
+	FlushDelay   time.Duration        // 发送端不满的块等待多久后提前结束，默认 DefaultFlushDelay
+	Options      []reedsolomon.Option // 创建编解码器时使用的选项
+}
+
+// PeerStats 是与一个对端（或所有对端合计）的收发统计
+type PeerStats struct {
+	Sent        uint64 // 发送的数据包
+	RepairsSent uint64 // 发送的修复包
+	Stats              // 接收统计
+}
+
+// add 累加统计
+func (s *PeerStats) add(o PeerStats) {
+	s.Sent += o.Sent
+	s.RepairsSent += o.RepairsSent
+	s.Packets += o.Packets
+	s.Repairs += o.Repairs
+	s.Recovered += o.Recovered
+	s.Lost += o.Lost
+	s.Late += o.Late
+	s.Invalid += o.Invalid
+}
+
+// PacketConn 在 net.PacketConn 之上透明地加入前向纠错
+// WriteTo 为每个目标地址分别分块并在数据包之间插入修复包，
+// ReadFrom 恢复丢失的数据报并按每个来源的发送顺序交付。
+// 通信双方都必须使用 PacketConn，并为对方设置相同的 DataShards 和 ParityShards；
+// 接收端丢弃参数不符的数据报。
+type PacketConn struct {
+	conn net.PacketConn
+	def  Config
+
+	mu    sync.Mutex
+	peers map[string]*peer
+	swept time.Time // 上次移除空闲对端的时间
+	gone  PeerStats // 已移除的对端的统计
+
+	in      chan inPacket
+	done    chan struct{}
+	readErr error
+	rdl     deadline
+	close   sync.Once
+}
+
+// inPacket 是等待 ReadFrom 交付的数据包
+type inPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// peer 是与一个对端通信的状态
+type peer struct {
+	addr net.Addr
+	cfg  Config
+	set  bool      // 由 SetPeer 设置，不会被移除
+	last time.Time // 最近一次查找的时间，由 c.mu 保护
+
+	emu   sync.Mutex // 保护发送状态
+	enc   *Encoder
+	flush *time.Timer
+	sent  uint64
+	fixes uint64
+
+	dmu    sync.Mutex // 保护接收状态
+	dec    *Decoder
+	expire *time.Timer
+	queue  [][]byte // 等待交给 ReadFrom 的数据包
+
+	qmu sync.Mutex // 交付 queue 时持有，保证多个调用方交付的顺序
+}
+
+// WrapPacketConn 包装 conn，默认每块 k 个数据包、m 个修复包
+// 返回的 PacketConn 接管 conn 的读取，关闭它时同时关闭 conn。
+func WrapPacketConn(conn net.PacketConn, k, m int) (*PacketConn, error) {
+	def := Config{DataShards: k, ParityShards: m}
+	if err := def.check(); err != nil {
+		return nil, err
+	}
+	c := &PacketConn{
+		conn:  conn,
+		def:   def,
+		peers: make(map[string]*peer),
+		in:    make(chan inPacket, inboxSize),
+		done:  make(chan struct{}),
+		rdl:   newDeadline(),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// check 检查参数并填入默认值
+func (cfg *Config) check() error {
+	if cfg.DataShards <= 0 || cfg.ParityShards <= 0 || cfg.DataShards+cfg.ParityShards > 65536 {
+		return ErrInvalidParams
+	}
+	if cfg.Latency <= 0 {
+		cfg.Latency = DefaultLatency
+	}
+	if cfg.FlushDelay <= 0 {
+		cfg.FlushDelay = DefaultFlushDelay
+	}
+	return nil
+}
+
+// SetPeer 设置与 addr 通信时使用的参数
+// 发送端当前不满的块会先提前结束；接收端的新延迟上限对之后收到的块生效，
+// 此后只接受按新参数编码的数据报。
+func (c *PacketConn) SetPeer(addr net.Addr, cfg Config) error {
+	if err := cfg.check(); err != nil {
+		return err
+	}
+	enc, err := NewEncoder(cfg.DataShards, cfg.ParityShards, cfg.Options...)
+	if err != nil {
+		return err
+	}
+	p := c.peer(addr, false)
+
+	p.emu.Lock()
+	if p.enc != nil {
+		c.flushPeer(p)
+		enc.block = p.enc.block
+	}
+	p.cfg, p.enc = cfg, enc
+	p.emu.Unlock()
+
+	p.dmu.Lock()
+	if p.dec != nil {
+		p.dec.k, p.dec.m, p.dec.latency = cfg.DataShards, cfg.ParityShards, cfg.Latency
+	}
+	p.dmu.Unlock()
+
+	c.mu.Lock()
+	p.set = true
+	c.mu.Unlock()
+	return nil
+}
+
+// peer 返回 addr 的状态，不存在时按默认参数创建
+// 为收到的数据报（recv 为真）创建时对端数量不超过 maxPeers，超过时返回nil。
+func (c *PacketConn) peer(addr net.Addr, recv bool) *peer {
+	key := addr.String()
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.peers[key]
+	if p == nil {
+		if now.Sub(c.swept) >= peerIdle/4 {
+			c.prune(now)
+		}
+		if recv && len(c.peers) >= maxPeers {
+			return nil
+		}
+		p = &peer{addr: addr, cfg: c.def}
+		c.peers[key] = p
+	}
+	p.last = now
+	return p
+}
+
+// prune 移除空闲超过 peerIdle 的对端，调用方持有 c.mu
+// 由 SetPeer 设置的对端，以及仍有不满的块、等待中的块或未交付数据包的对端不会被移除；
+// 被移除的对端的统计计入 Stats。
+func (c *PacketConn) prune(now time.Time) {
+	c.swept = now
+	for key, p := range c.peers {
+		if p.set || now.Sub(p.last) < peerIdle {
+			continue
+		}
+		p.emu.Lock()
+		p.dmu.Lock()
+		if (p.enc == nil || len(p.enc.pending) == 0) && (p.dec == nil || len(p.dec.blocks) == 0) && len(p.queue) == 0 {
+			c.gone.add(p.statsLocked())
+			delete(c.peers, key)
+		}
+		p.dmu.Unlock()
+		p.emu.Unlock()
+	}
+}
+
+// WriteTo 发送一个数据包，块满时接着发送修复包
+// 只有数据包本身发送失败时返回错误；此时数据包仍属于当前块，之后的修复包可能恢复它。
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	p := c.peer(addr, false)
+	p.emu.Lock()
+	defer p.emu.Unlock()
+	if p.enc == nil {
+		enc, err := NewEncoder(p.cfg.DataShards, p.cfg.ParityShards, p.cfg.Options...)
+		if err != nil {
+			return 0, err
+		}
+		p.enc = enc
+	}
+	first := len(p.enc.pending) == 0
+	dgrams, err := p.enc.Encode(b)
+	if err != nil {
+		return 0, err
+	}
+	// 数据包已经加入当前块，即使发送失败也可能由修复包恢复
+	err = c.send(p, dgrams[:1])
+	// 修复包发送失败时只是少了保护，与 flushPeer 一致
+	c.send(p, dgrams[1:])
+	if first && len(p.enc.pending) > 0 {
+		// 块在 FlushDelay 内没有填满时提前结束，使最后几个包也受到保护
+		block := p.enc.block
+		if p.flush != nil {
+			p.flush.Stop()
+		}
+		p.flush = time.AfterFunc(p.cfg.FlushDelay, func() {
+			p.emu.Lock()
+			defer p.emu.Unlock()
+			if p.enc.block == block {
+				c.flushPeer(p)
+			}
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// flushPeer 提前结束对端当前的块，调用方持有 p.emu
+func (c *PacketConn) flushPeer(p *peer) {
+	// 修复包发送失败时只是少了保护，数据包已经发出
+	if dgrams, err := p.enc.Flush(); err == nil {
+		c.send(p, dgrams)
+	}
+}
+
+// send 发送数据报并更新统计，返回第一个发送错误，调用方持有 p.emu
+// 一个数据报发送失败后仍继续发送其余的数据报，使其余的修复包仍能提供保护。
+func (c *PacketConn) send(p *peer, dgrams [][]byte) error {
+	var first error
+	for _, d := range dgrams {
+		if _, err := c.conn.WriteTo(d, p.addr); err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if isRepair(d) {
+			p.fixes++
+		} else {
+			p.sent++
+		}
+	}
+	return first
+}
+
+// isRepair 根据头部中的序号和 k 判断编码器生成的数据报是否是修复包
+func isRepair(d []byte) bool {
+	return binary.BigEndian.Uint16(d[5:]) >= binary.BigEndian.Uint16(d[7:])
+}
+
+// readLoop 读取底层连接，把恢复出的数据包按顺序放入 c.in
+func (c *PacketConn) readLoop() {
+	buf := make([]byte, 1<<16)
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			c.closeWith(err)
+			return
+		}
+		p := c.peer(addr, true)
+		if p == nil {
+			// 对端过多，丢弃来自新地址的数据报
+			continue
+		}
+		p.dmu.Lock()
+		if p.dec == nil {
+			// 参数已由 Config.check 检查，只有编解码器选项无效时失败，此时丢弃数据报
+			p.dec, err = NewDecoder(p.cfg.DataShards, p.cfg.ParityShards, p.cfg.Latency, p.cfg.Options...)
+			if err != nil {
+				p.dmu.Unlock()
+				continue
+			}
+		}
+		// 无效的数据报计入统计后丢弃
+		out, _ := p.dec.Decode(buf[:n], time.Now())
+		p.queue = append(p.queue, out...)
+		c.scheduleExpire(p)
+		p.dmu.Unlock()
+		c.deliver(p)
+	}
+}
+
+// scheduleExpire 在对端下一个块超时时交付可以交付的数据包，调用方持有 p.dmu
+func (c *PacketConn) scheduleExpire(p *peer) {
+	dl, ok := p.dec.Deadline()
+	if p.expire != nil {
+		p.expire.Stop()
+	}
+	if !ok {
+		return
+	}
+	p.expire = time.AfterFunc(time.Until(dl), func() {
+		p.dmu.Lock()
+		p.queue = append(p.queue, p.dec.Expire(time.Now())...)
+		c.scheduleExpire(p)
+		p.dmu.Unlock()
+		c.deliver(p)
+	})
+}
+
+// deliver 按顺序把对端排队的数据包交给 ReadFrom
+// 等待 ReadFrom 时不持有 p.dmu，接收和超时处理不会因为读取端缓慢而阻塞在锁上。
+func (c *PacketConn) deliver(p *peer) {
+	p.qmu.Lock()
+	defer p.qmu.Unlock()
+	for {
+		p.dmu.Lock()
+		if len(p.queue) == 0 {
+			p.dmu.Unlock()
+			return
+		}
+		data := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.dmu.Unlock()
+		select {
+		case c.in <- inPacket{data: data, addr: p.addr}:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// ReadFrom 读取一个数据包，b 不够大时多余的部分被丢弃
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		t, changed := c.rdl.get()
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if !t.IsZero() {
+			d := time.Until(t)
+			if d <= 0 {
+				return 0, nil, c.opError(os.ErrDeadlineExceeded)
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		select {
+		case pkt := <-c.in:
+			stopTimer(timer)
+			return copy(b, pkt.data), pkt.addr, nil
+		case <-c.done:
+			stopTimer(timer)
+			err := c.readErr
+			if err == nil {
+				err = net.ErrClosed
+			}
+			return 0, nil, c.opError(err)
+		case <-timeout:
+			return 0, nil, c.opError(os.ErrDeadlineExceeded)
+		case <-changed:
+			stopTimer(timer)
+		}
+	}
+}
+
+func stopTimer(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+// opError 把读取错误包装为 net.OpError
+func (c *PacketConn) opError(err error) error {
+	if _, ok := err.(*net.OpError); ok {
+		return err
+	}
+	return &net.OpError{Op: "read", Net: c.LocalAddr().Network(), Addr: c.LocalAddr(), Err: err}
+}
+
+// Close 关闭连接，不满的块不再发送修复包
+func (c *PacketConn) Close() error {
+	return c.closeWith(nil)
+}
+
+// closeWith 关闭连接，readErr 为读取底层连接时遇到的错误
+func (c *PacketConn) closeWith(readErr error) error {
+	var err error
+	c.close.Do(func() {
+		c.readErr = readErr
+		close(c.done)
+		err = c.conn.Close()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, p := range c.peers {
+			p.emu.Lock()
+			if p.flush != nil {
+				p.flush.Stop()
+			}
+			p.emu.Unlock()
+			p.dmu.Lock()
+			if p.expire != nil {
+				p.expire.Stop()
+			}
+			p.dmu.Unlock()
+		}
+	})
+	return err
+}
+
+// LocalAddr 返回本地地址
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// SetDeadline 设置读写截止时间
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	c.rdl.set(t)
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline 设置 ReadFrom 的截止时间
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	c.rdl.set(t)
+	return nil
+}
+
+// SetWriteDeadline 设置底层连接的写截止时间
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// PeerStats 返回与 addr 的收发统计，空闲后被移除的对端返回零值
+func (c *PacketConn) PeerStats(addr net.Addr) PeerStats {
+	c.mu.Lock()
+	p := c.peers[addr.String()]
+	c.mu.Unlock()
+	if p == nil {
+		return PeerStats{}
+	}
+	return p.stats()
+}
+
+// Stats 返回所有对端的统计之和，包括已移除的对端
+func (c *PacketConn) Stats() PeerStats {
+	c.mu.Lock()
+	peers := make([]*peer, 0, len(c.peers))
+	for _, p := range c.peers {
+		peers = append(peers, p)
+	}
+	s := c.gone
+	c.mu.Unlock()
+	for _, p := range peers {
+		s.add(p.stats())
+	}
+	return s
+}
+
+func (p *peer) stats() PeerStats {
+	p.emu.Lock()
+	defer p.emu.Unlock()
+	p.dmu.Lock()
+	defer p.dmu.Unlock()
+	return p.statsLocked()
+}
+
+// statsLocked 返回对端的统计，调用方持有 p.emu 和 p.dmu
+func (p *peer) statsLocked() PeerStats {
+	var s PeerStats
+	s.Sent, s.RepairsSent = p.sent, p.fixes
+	if p.dec != nil {
+		s.Stats = p.dec.Stats()
+	}
+	return s
+}
+
+// deadline 是可以在等待期间修改的截止时间
+type deadline struct {
+	mu      sync.Mutex
+	t       time.Time
+	changed chan struct{}
+}
+
+func newDeadline() deadline {
+	return deadline{changed: make(chan struct{})}
+}
+
+// get 返回截止时间和在其被修改时关闭的通道
+func (d *deadline) get() (time.Time, chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.t, d.changed
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.t = t
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
@@ -0,0 +1,354 @@
+package fec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// errWrite 是 lossyConn 模拟的发送错误
+var errWrite = errors.New("模拟的发送错误")
+
+// lossyConn 按确定的规则丢弃和重排发出的数据报
+// 第 n 个数据报在 drop(n) 为真时被丢弃，在 fail(n) 为真时返回 errWrite；
+// n%7==3 的数据报推迟到下一个数据报之后发送。
+type lossyConn struct {
+	net.PacketConn
+	drop func(n int) bool
+	fail func(n int) bool
+
+	mu       sync.Mutex
+	n        int
+	held     []byte
+	heldAddr net.Addr
+	dropped  int // 丢弃的数据包（不含修复包）
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.n
+	c.n++
+	if c.drop(n) {
+		if !isRepair(b) {
+			c.dropped++
+		}
+		return len(b), nil
+	}
+	if c.fail != nil && c.fail(n) {
+		return 0, errWrite
+	}
+	if n%7 == 3 && c.held == nil {
+		c.held, c.heldAddr = append([]byte(nil), b...), addr
+		return len(b), nil
+	}
+	if _, err := c.PacketConn.WriteTo(b, addr); err != nil {
+		return 0, err
+	}
+	if c.held != nil {
+		c.PacketConn.WriteTo(c.held, c.heldAddr)
+		c.held = nil
+	}
+	return len(b), nil
+}
+
+func (c *lossyConn) droppedData() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// listenUDP 在回环地址上监听
+func listenUDP(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// sendSeq 发送 n 个以序号开头的随机数据包，返回发送的内容
+func sendSeq(t *testing.T, c net.PacketConn, to net.Addr, n int, seed int64) [][]byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	pkts := make([][]byte, n)
+	for i := range pkts {
+		pkts[i] = make([]byte, 4+rng.Intn(1000))
+		rng.Read(pkts[i])
+		binary.BigEndian.PutUint32(pkts[i], uint32(i))
+		if _, err := c.WriteTo(pkts[i], to); err != nil {
+			t.Fatal(err)
+		}
+		// 控制速率，避免回环接口的接收缓冲区溢出
+		if i%8 == 7 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	return pkts
+}
+
+// recvAll 接收数据包直到 n 个或超时，按来源地址分组
+func recvAll(c net.PacketConn, n int, timeout time.Duration) map[string][][]byte {
+	got := make(map[string][][]byte)
+	c.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 2048)
+	for i := 0; i < n; i++ {
+		m, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		got[addr.String()] = append(got[addr.String()], append([]byte(nil), buf[:m]...))
+	}
+	return got
+}
+
+// 测试经过丢包和乱序的回环 UDP 后，两个参数不同的发送端的数据包都完整按序到达
+func TestPacketConn(t *testing.T) {
+	recvConn, err := WrapPacketConn(listenUDP(t), 10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recvConn.Close()
+
+	lossy := make([]*lossyConn, 2)
+	senders := make([]*PacketConn, 2)
+	for i := range senders {
+		lossy[i] = &lossyConn{PacketConn: listenUDP(t)}
+		if senders[i], err = WrapPacketConn(lossy[i], 10, 4); err != nil {
+			t.Fatal(err)
+		}
+		defer senders[i].Close()
+	}
+	// 发送端 0 使用默认参数，每 9 个丢 1 个；发送端 1 每块 4+4，每 4 个丢 1 个
+	lossy[0].drop = func(n int) bool { return n%9 == 4 }
+	lossy[1].drop = func(n int) bool { return n%4 == 1 }
+	if err := senders[1].SetPeer(recvConn.LocalAddr(), Config{DataShards: 4, ParityShards: 4, FlushDelay: 5 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := recvConn.SetPeer(senders[1].LocalAddr(), Config{DataShards: 4, ParityShards: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 300
+	var wg sync.WaitGroup
+	var got map[string][][]byte
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		got = recvAll(recvConn, 2*n, 10*time.Second)
+	}()
+	sent := make([][][]byte, 2)
+	var swg sync.WaitGroup
+	for i := range senders {
+		swg.Add(1)
+		go func(i int) {
+			defer swg.Done()
+			sent[i] = sendSeq(t, senders[i], recvConn.LocalAddr(), n, int64(i))
+		}(i)
+	}
+	swg.Wait()
+	wg.Wait()
+
+	for i, s := range senders {
+		addr := s.LocalAddr()
+		pkts := got[addr.String()]
+		if len(pkts) != n {
+			t.Fatalf("发送端 %d: 期望 %d 个数据包，实际 %d", i, n, len(pkts))
+		}
+		for j := range pkts {
+			if !bytes.Equal(pkts[j], sent[i][j]) {
+				t.Fatalf("发送端 %d: 第 %d 个数据包不一致", i, j)
+			}
+		}
+		st := recvConn.PeerStats(addr)
+		if st.Lost != 0 || st.Recovered < uint64(lossy[i].droppedData()) || st.Recovered == 0 {
+			t.Fatalf("发送端 %d: 接收统计 %+v，丢弃 %d", i, st, lossy[i].droppedData())
+		}
+		ss := s.Stats()
+		if ss.Sent != n || ss.RepairsSent == 0 {
+			t.Fatalf("发送端 %d: 发送统计 %+v", i, ss)
+		}
+	}
+	// 发送端 1 每块 4 个数据包、4 个修复包
+	if ss := senders[1].Stats(); ss.RepairsSent < ss.Sent {
+		t.Fatalf("发送端 1 的修复包少于数据包: %+v", ss)
+	}
+	if total := recvConn.Stats(); total.Packets+total.Recovered < 2*n {
+		t.Fatalf("合计统计 %+v", total)
+	}
+}
+
+// 测试连续丢失超过修复能力时，在延迟上限后跳过缺口并按序交付其余数据包
+func TestPacketConnBurstLoss(t *testing.T) {
+	recvConn, err := WrapPacketConn(listenUDP(t), 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recvConn.Close()
+	if err := recvConn.SetPeer(&net.UDPAddr{}, Config{DataShards: 8, ParityShards: 2}); err != nil {
+		t.Fatal(err)
+	}
+	lossy := &lossyConn{PacketConn: listenUDP(t), drop: func(n int) bool { return n >= 22 && n < 30 }}
+	sender, err := WrapPacketConn(lossy, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	if err := recvConn.SetPeer(sender.LocalAddr(), Config{DataShards: 8, ParityShards: 2, Latency: 30 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 64
+	sendSeq(t, sender, recvConn.LocalAddr(), n, 1)
+	got := recvAll(recvConn, n, 2*time.Second)[sender.LocalAddr().String()]
+	if len(got) == 0 || len(got) >= n {
+		t.Fatalf("收到 %d 个数据包", len(got))
+	}
+	last := -1
+	for _, p := range got {
+		seq := int(binary.BigEndian.Uint32(p))
+		if seq <= last {
+			t.Fatalf("交付顺序错误: %d 在 %d 之后", seq, last)
+		}
+		last = seq
+	}
+	st := recvConn.PeerStats(sender.LocalAddr())
+	if st.Lost == 0 || int(st.Lost)+len(got) != n {
+		t.Fatalf("接收统计 %+v，收到 %d", st, len(got))
+	}
+}
+
+// 测试空闲的对端被移除并保留合计统计，收到的数据报创建的对端数量有上限
+func TestPacketConnPeers(t *testing.T) {
+	recvConn, err := WrapPacketConn(listenUDP(t), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recvConn.Close()
+	sender, err := WrapPacketConn(listenUDP(t), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+	sendSeq(t, sender, recvConn.LocalAddr(), 8, 1)
+	if got := recvAll(recvConn, 8, 2*time.Second)[sender.LocalAddr().String()]; len(got) != 8 {
+		t.Fatalf("收到 %d 个数据包", len(got))
+	}
+	configured := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 1}
+	if err := recvConn.SetPeer(configured, Config{DataShards: 4, ParityShards: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 所有对端都已空闲超过 peerIdle
+	recvConn.mu.Lock()
+	for _, p := range recvConn.peers {
+		p.last = time.Now().Add(-2 * peerIdle)
+	}
+	recvConn.swept = time.Time{}
+	recvConn.mu.Unlock()
+	// 空闲的对端被移除，SetPeer 设置的对端占用一个位置
+	for i := 0; i < maxPeers-1; i++ {
+		if recvConn.peer(&net.UDPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 1}, true) == nil {
+			t.Fatalf("第 %d 个对端不应被拒绝", i)
+		}
+	}
+	recvConn.mu.Lock()
+	_, kept := recvConn.peers[configured.String()]
+	_, idle := recvConn.peers[sender.LocalAddr().String()]
+	recvConn.mu.Unlock()
+	if !kept || idle {
+		t.Fatalf("SetPeer 设置的对端保留 %v，空闲的对端保留 %v", kept, idle)
+	}
+	if recvConn.peer(&net.UDPAddr{IP: net.IPv4(10, 1, 0, 0), Port: 1}, true) != nil {
+		t.Fatal("超过 maxPeers 时应拒绝新的对端")
+	}
+	if recvConn.peer(&net.UDPAddr{IP: net.IPv4(10, 1, 0, 0), Port: 1}, false) == nil {
+		t.Fatal("发送时总是创建对端")
+	}
+	if st := recvConn.Stats(); st.Packets+st.Recovered != 8 {
+		t.Fatalf("合计统计 %+v", st)
+	}
+	if st := recvConn.PeerStats(sender.LocalAddr()); st != (PeerStats{}) {
+		t.Fatalf("已移除的对端统计 %+v", st)
+	}
+}
+
+// 测试发送失败：数据包发送失败时返回错误但仍受修复包保护，修复包发送失败不影响 WriteTo
+func TestPacketConnWriteError(t *testing.T) {
+	recvConn, err := WrapPacketConn(listenUDP(t), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recvConn.Close()
+	// 数据报 1 是第一块的数据包 1，数据报 4 是第一块的修复包，数据报 6 是第二块的第一个数据包
+	lossy := &lossyConn{
+		PacketConn: listenUDP(t),
+		drop:       func(n int) bool { return false },
+		fail:       func(n int) bool { return n == 1 || n == 4 || n == 6 },
+	}
+	sender, err := WrapPacketConn(lossy, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	pkts := make([][]byte, 5)
+	for i := range pkts {
+		pkts[i] = binary.BigEndian.AppendUint32(nil, uint32(i))
+		n, err := sender.WriteTo(pkts[i], recvConn.LocalAddr())
+		if i == 1 || i == 4 {
+			if !errors.Is(err, errWrite) || n != 0 {
+				t.Fatalf("数据包 %d: 期望 errWrite，实际 %d %v", i, n, err)
+			}
+		} else if err != nil || n != len(pkts[i]) {
+			t.Fatalf("数据包 %d: %d %v", i, n, err)
+		}
+	}
+	// 第二块只有一个发送失败的数据包，仍应在 FlushDelay 后发送修复包
+	got := recvAll(recvConn, len(pkts), 2*time.Second)[sender.LocalAddr().String()]
+	if len(got) != len(pkts) {
+		t.Fatalf("期望收到 %d 个数据包，实际 %d", len(pkts), len(got))
+	}
+	for i := range pkts {
+		if !bytes.Equal(got[i], pkts[i]) {
+			t.Fatalf("第 %d 个数据包不一致", i)
+		}
+	}
+	if st := recvConn.PeerStats(sender.LocalAddr()); st.Recovered != 2 || st.Lost != 0 {
+		t.Fatalf("接收统计 %+v", st)
+	}
+}
+
+// 测试读截止时间和关闭
+func TestPacketConnDeadline(t *testing.T) {
+	c, err := WrapPacketConn(listenUDP(t), 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, _, err := c.ReadFrom(make([]byte, 10)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("期望 os.ErrDeadlineExceeded，实际 %v", err)
+	}
+
+	c.SetReadDeadline(time.Time{})
+	errc := make(chan error)
+	go func() {
+		_, _, err := c.ReadFrom(make([]byte, 10))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+	if err := <-errc; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("期望 net.ErrClosed，实际 %v", err)
+	}
+	if _, err := WrapPacketConn(listenUDP(t), 0, 1); err != ErrInvalidParams {
+		t.Fatalf("期望 ErrInvalidParams，实际 %v", err)
+	}
+}
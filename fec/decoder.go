@@ -0,0 +1,351 @@
+/**
+ * Reed-Solomon 编码库 - 数据包前向纠错接收端
+ *
+ * Copyright 2024
+ */
+
+package fec
+
+import (
+	"sort"
+	"time"
+
+	reedsolomon "github.com/bpfs/reedsolomon16"
+)
+
+// Stats 是接收端的统计信息
+type Stats struct {
+	Packets   uint64 // 收到的数据包
+	Repairs   uint64 // 收到的修复包
+	Recovered uint64 // 通过修复包恢复的数据包
+	Lost      uint64 // 超过延迟上限仍无法恢复而放弃的数据包，整块丢失时按上一块的 k 估计；块的大小未知时只计到最后收到的数据包
+	Late      uint64 // 重复的或晚于交付位置到达而被丢弃的数据包
+	Invalid   uint64 // 无法解析、参数与接收端不符、与同一块的其他包不一致或等待中的块过多而丢弃的数据报
+}
+
+// maxPendingBlocks 是接收端同时等待的块数上限，超过时丢弃属于新块的数据报
+const maxPendingBlocks = 256
+
+// block 是接收端正在收集的一块
+type block struct {
+	k, m    int
+	full    int   // 数据包头部中的 k，提前结束的块大于实际的 k
+	sized   bool  // k 是块内实际的数据包数量，来自修复包或下一块的 prev
+	fixed   bool  // lengths 来自修复包
+	lengths []int // 数据包原始长度
+	size    int   // 修复包负载长度
+	top     int   // 收到的最大数据包序号加一，块的大小未知时只能确定到这里
+	data    [][]byte
+	repair  [][]byte
+	have    int
+	first   time.Time // 收到第一个包的时间
+}
+
+// Decoder 接收 FEC 数据报，恢复丢失的数据包并按发送顺序交付，不能并发使用
+// 每块从收到第一个包起最多等待 latency；超时后放弃这一块及之前各块中仍缺少的数据包，
+// 交付已有的包。第一个收到的包决定起始块，更早的块被视为迟到。
+// 被 Flush 提前结束的块丢失全部修复包时，由下一块头部中的 prev 得知块内的包数；
+// 下一块的包也没有到达时，后续各块要等这一块超时后才交付。
+// 只接受修复包数量为 m、数据包数量不超过 k 的块，其余数据报计为无效，
+// 防止伪造的头部使接收端创建任意大小的编解码器和块。
+type Decoder struct {
+	k, m    int
+	latency time.Duration
+	codecs  codecs
+	blocks  map[uint32]*block
+	started bool
+	next    uint32 // 下一个交付的块
+	index   int    // 块内下一个交付的序号
+	lastK   int
+	stats   Stats
+}
+
+// NewDecoder 创建与 NewEncoder(k, m) 配对的接收端，latency 为每块等待丢失数据包的最长时间
+func NewDecoder(k, m int, latency time.Duration, opts ...reedsolomon.Option) (*Decoder, error) {
+	if k <= 0 || m <= 0 || k+m > 65536 {
+		return nil, ErrInvalidParams
+	}
+	d := &Decoder{
+		k:       k,
+		m:       m,
+		latency: latency,
+		codecs:  codecs{opts: opts},
+		blocks:  make(map[uint32]*block),
+	}
+	// 提前创建完整块的编解码器，参数无效时立即报错
+	if _, err := d.codecs.get(k, m); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Stats 返回统计信息
+func (d *Decoder) Stats() Stats {
+	return d.stats
+}
+
+// before 按回绕的序列号比较块编号
+func before(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// Decode 处理收到的数据报，返回按顺序可以交付的数据包
+// now 是收到数据报的时间，用于延迟上限；返回的数据包不引用 pkt 的内存。
+// 无法解析的数据报返回 ErrInvalidPacket，此时仍可能因为超时交付数据包。
+func (d *Decoder) Decode(pkt []byte, now time.Time) ([][]byte, error) {
+	err := d.add(pkt, now)
+	if err != nil {
+		d.stats.Invalid++
+	}
+	var out [][]byte
+	d.release(&out)
+	return append(out, d.Expire(now)...), err
+}
+
+// add 把数据报加入所属的块，收到足够的包时恢复丢失的数据包
+func (d *Decoder) add(pkt []byte, now time.Time) error {
+	h, payload, err := ParsePacket(pkt)
+	if err != nil {
+		return err
+	}
+	if h.Data > d.k || h.Parity != d.m {
+		return ErrInvalidPacket
+	}
+	if h.IsRepair() {
+		d.stats.Repairs++
+	} else {
+		d.stats.Packets++
+	}
+	if !d.started {
+		d.started = true
+		d.next = h.Block
+	}
+	// 已交付的块：修复包正常地晚于数据包到达，只统计迟到的数据包
+	if before(h.Block, d.next) || h.Block == d.next && !h.IsRepair() && h.Index < d.index {
+		if !h.IsRepair() {
+			d.stats.Late++
+		}
+		return nil
+	}
+
+	if h.Prev > 0 {
+		if pb := d.blocks[h.Block-1]; pb != nil {
+			if err := pb.end(h.Prev); err != nil {
+				return err
+			}
+		}
+	}
+	b := d.blocks[h.Block]
+	if b == nil {
+		if len(d.blocks) >= maxPendingBlocks {
+			return ErrInvalidPacket
+		}
+		b = &block{k: h.Data, m: h.Parity, first: now}
+		b.data = make([][]byte, h.Data)
+		b.repair = make([][]byte, h.Parity)
+		d.blocks[h.Block] = b
+	}
+	if h.Parity != b.m {
+		return ErrInvalidPacket
+	}
+	if h.IsRepair() {
+		if err := b.addRepair(h, payload); err != nil {
+			return err
+		}
+	} else {
+		if h.Index >= b.k || h.Data < b.k || b.full != 0 && h.Data != b.full || b.fixed && len(payload) != b.lengths[h.Index] {
+			return ErrInvalidPacket
+		}
+		b.full = h.Data
+		if b.data[h.Index] != nil {
+			d.stats.Late++
+			return nil
+		}
+		// 空数据包也必须是非nil的切片
+		b.data[h.Index] = make([]byte, len(payload))
+		copy(b.data[h.Index], payload)
+		b.have++
+		b.top = max(b.top, h.Index+1)
+	}
+	return d.recover(b)
+}
+
+// addRepair 加入修复包，第一个修复包确定块的实际大小和数据包长度
+func (b *block) addRepair(h *Header, payload []byte) error {
+	if !b.fixed {
+		if b.sized && h.Data != b.k {
+			return ErrInvalidPacket
+		}
+		if h.Data > len(b.data) {
+			// 块内还没有数据包到达，或数据包头部中的 k 小于修复包中的值
+			if b.have > 0 {
+				return ErrInvalidPacket
+			}
+			b.data = make([][]byte, h.Data)
+		}
+		for i, p := range b.data {
+			if p != nil && (i >= h.Data || len(p) != h.Lengths[i]) {
+				return ErrInvalidPacket
+			}
+		}
+		b.k, b.sized, b.fixed = h.Data, true, true
+		b.data = b.data[:b.k]
+		b.lengths = h.Lengths
+		b.size = len(payload)
+	} else if h.Data != b.k || len(payload) != b.size {
+		return ErrInvalidPacket
+	}
+	i := h.Index - h.Data
+	if b.repair[i] == nil {
+		b.repair[i] = append([]byte(nil), payload...)
+		b.have++
+	}
+	return nil
+}
+
+// end 按下一块头部中的 prev 确定块内实际的数据包数量
+func (b *block) end(k int) error {
+	if b.sized {
+		if k != b.k {
+			return ErrInvalidPacket
+		}
+		return nil
+	}
+	if k > len(b.data) {
+		return ErrInvalidPacket
+	}
+	for _, p := range b.data[k:] {
+		if p != nil {
+			return ErrInvalidPacket
+		}
+	}
+	b.k, b.sized = k, true
+	b.data = b.data[:k]
+	return nil
+}
+
+// recover 在收到至少 k 个包且缺少数据包时重建
+func (d *Decoder) recover(b *block) error {
+	if !b.fixed || b.have < b.k {
+		return nil
+	}
+	missing := 0
+	for _, p := range b.data {
+		if p == nil {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return nil
+	}
+	enc, err := d.codecs.get(b.k, b.m)
+	if err != nil {
+		return err
+	}
+	shards := make([][]byte, b.k+b.m)
+	for i, p := range b.data {
+		if p != nil {
+			shards[i] = make([]byte, b.size)
+			copy(shards[i], p)
+		}
+	}
+	copy(shards[b.k:], b.repair)
+	if err := enc.ReconstructData(shards); err != nil {
+		return err
+	}
+	// 重建结果可能位于编解码器复用的内存中，需要复制
+	for i, p := range b.data {
+		if p == nil {
+			b.data[i] = make([]byte, b.lengths[i])
+			copy(b.data[i], shards[i])
+		}
+	}
+	d.stats.Recovered += uint64(missing)
+	return nil
+}
+
+// release 交付从当前位置起连续可用的数据包
+func (d *Decoder) release(out *[][]byte) {
+	for {
+		b := d.blocks[d.next]
+		if b == nil {
+			return
+		}
+		for d.index < b.k && b.data[d.index] != nil {
+			*out = append(*out, b.data[d.index])
+			d.index++
+		}
+		if d.index < b.k {
+			return
+		}
+		d.finish(b)
+	}
+}
+
+// finish 结束当前块，移到下一块
+func (d *Decoder) finish(b *block) {
+	delete(d.blocks, d.next)
+	d.lastK = b.k
+	d.next++
+	d.index = 0
+}
+
+// Expire 放弃超过延迟上限的块中仍缺少的数据包，返回因此可以交付的数据包
+// 接收端空闲时应在 Deadline 返回的时间调用。
+func (d *Decoder) Expire(now time.Time) [][]byte {
+	var out [][]byte
+	for {
+		d.release(&out)
+		target, ok := d.expired(now)
+		if !ok {
+			return out
+		}
+		// 按顺序放弃 target 及之前各块中的缺口
+		ids := make([]uint32, 0, len(d.blocks))
+		for id := range d.blocks {
+			if !before(target, id) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return before(ids[i], ids[j]) })
+		for _, id := range ids {
+			// 两块之间整块丢失的块
+			d.stats.Lost += uint64(id-d.next) * uint64(d.lastK)
+			d.next = id
+			b := d.blocks[id]
+			for ; d.index < b.k; d.index++ {
+				if p := b.data[d.index]; p != nil {
+					out = append(out, p)
+				} else if b.sized || d.index < b.top {
+					// 块的大小未知时无法确定块是否被 Flush 提前结束，最后一个收到的数据包之后的序号不计为丢失
+					d.stats.Lost++
+				}
+			}
+			d.finish(b)
+		}
+	}
+}
+
+// expired 返回最早超过延迟上限的块
+func (d *Decoder) expired(now time.Time) (uint32, bool) {
+	var target uint32
+	found := false
+	for id, b := range d.blocks {
+		if !now.Before(b.first.Add(d.latency)) && (!found || before(id, target)) {
+			target, found = id, true
+		}
+	}
+	return target, found
+}
+
+// Deadline 返回下一个块超过延迟上限的时间，没有等待中的块时返回 false
+func (d *Decoder) Deadline() (time.Time, bool) {
+	var t time.Time
+	found := false
+	for _, b := range d.blocks {
+		if dl := b.first.Add(d.latency); !found || dl.Before(t) {
+			t, found = dl, true
+		}
+	}
+	return t, found
+}
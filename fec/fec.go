@@ -0,0 +1,230 @@
+/**
+ * Reed-Solomon 编码库 - 数据包前向纠错
+ *
+ * Copyright 2024
+ */
+
+// Package fec 为有丢包的数据报传输提供分组前向纠错
+//
+// 发送端把连续的 k 个数据包组成一块，补零到块内最长包的长度后生成 m 个修复包；
+// 接收端收到一块中任意 k 个包即可恢复丢失的数据包，并在延迟上限内按顺序交付。
+// 每个包带有一个小头部：
+//
+//	version(1) | block(4) | index(2) | k(2) | m(2) | prev(2) | 修复包: k 个数据包的原始长度(2*k)
+//
+// 所有整数为大端序。序号小于 k 的是数据包，其余是修复包。
+// prev 是上一块实际的数据包数量，第一块为0；被 Flush 提前结束的块丢失全部修复包时，
+// 接收端由下一块的 prev 得知块内的包数。
+// 块内总包数不超过256时使用 GF(2^8)，否则使用 GF(2^16)，与 reedsolomon.New 一致。
+package fec
+
+import (
+	"encoding/binary"
+	"errors"
+
+	reedsolomon "github.com/bpfs/reedsolomon16"
+)
+
+// 头部常量
+const (
+	headerVersion = 1
+	headerLen     = 13
+
+	// MaxPacketSize 是一个数据包（不含头部）的最大长度
+	MaxPacketSize = 65535
+)
+
+// 错误定义
+var (
+	ErrInvalidPacket  = errors.New("无效的 FEC 数据包")
+	ErrPacketTooLarge = errors.New("数据包超过最大长度")
+	ErrInvalidParams  = errors.New("无效的分块参数")
+)
+
+// Header 是 FEC 数据包的头部
+type Header struct {
+	Block   uint32 // 块编号，按发送顺序递增，溢出后回绕
+	Index   int    // 块内序号，小于 Data 的是数据包
+	Data    int    // 块内数据包数量 k；提前结束的块以修复包中的值为准
+	Parity  int    // 块内修复包数量 m
+	Prev    int    // 上一块实际的数据包数量，0 表示没有上一块
+	Lengths []int  // 修复包携带的 k 个数据包原始长度，数据包为nil
+}
+
+// IsRepair 判断是否是修复包
+func (h *Header) IsRepair() bool {
+	return h.Index >= h.Data
+}
+
+// appendPacket 把头部和负载编码为一个数据报
+func (h *Header) appendPacket(b, payload []byte) []byte {
+	b = append(b, headerVersion)
+	b = binary.BigEndian.AppendUint32(b, h.Block)
+	b = binary.BigEndian.AppendUint16(b, uint16(h.Index))
+	b = binary.BigEndian.AppendUint16(b, uint16(h.Data))
+	b = binary.BigEndian.AppendUint16(b, uint16(h.Parity))
+	b = binary.BigEndian.AppendUint16(b, uint16(h.Prev))
+	for _, l := range h.Lengths {
+		b = binary.BigEndian.AppendUint16(b, uint16(l))
+	}
+	return append(b, payload...)
+}
+
+// ParsePacket 解析数据报，返回头部和负载
+// 负载引用 b 的内存。
+func ParsePacket(b []byte) (*Header, []byte, error) {
+	if len(b) < headerLen || b[0] != headerVersion {
+		return nil, nil, ErrInvalidPacket
+	}
+	h := &Header{
+		Block:  binary.BigEndian.Uint32(b[1:]),
+		Index:  int(binary.BigEndian.Uint16(b[5:])),
+		Data:   int(binary.BigEndian.Uint16(b[7:])),
+		Parity: int(binary.BigEndian.Uint16(b[9:])),
+		Prev:   int(binary.BigEndian.Uint16(b[11:])),
+	}
+	if h.Data == 0 || h.Parity == 0 || h.Data+h.Parity > 65536 || h.Index >= h.Data+h.Parity {
+		return nil, nil, ErrInvalidPacket
+	}
+	b = b[headerLen:]
+	if !h.IsRepair() {
+		return h, b, nil
+	}
+	if len(b) < 2*h.Data {
+		return nil, nil, ErrInvalidPacket
+	}
+	h.Lengths = make([]int, h.Data)
+	maxLen := 0
+	for i := range h.Lengths {
+		h.Lengths[i] = int(binary.BigEndian.Uint16(b[2*i:]))
+		maxLen = max(maxLen, h.Lengths[i])
+	}
+	b = b[2*h.Data:]
+	if len(b) != shardSize(maxLen) {
+		return nil, nil, ErrInvalidPacket
+	}
+	return h, b, nil
+}
+
+// shardSize 返回块内最长包为 n 字节时的分片大小（64字节对齐，至少64字节）
+func shardSize(n int) int {
+	return max((n+63)/64*64, 64)
+}
+
+// maxCodecs 是每个编码器或接收端缓存的编解码器数量上限
+const maxCodecs = 8
+
+// codecs 缓存不同 k、m 组合的编解码器，超过 maxCodecs 时淘汰任意一个
+type codecs struct {
+	opts []reedsolomon.Option
+	m    map[[2]int]reedsolomon.ReedSolomon
+}
+
+func (c *codecs) get(k, m int) (reedsolomon.ReedSolomon, error) {
+	key := [2]int{k, m}
+	if enc, ok := c.m[key]; ok {
+		return enc, nil
+	}
+	enc, err := reedsolomon.New(k, m, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c.m == nil {
+		c.m = make(map[[2]int]reedsolomon.ReedSolomon)
+	}
+	if len(c.m) >= maxCodecs {
+		// 提前结束的块大小各不相同，缓存不能无限增长
+		for old := range c.m {
+			delete(c.m, old)
+			break
+		}
+	}
+	c.m[key] = enc
+	return enc, nil
+}
+
+// Encoder 把数据包分块并生成修复包，不能并发使用
+type Encoder struct {
+	k, m    int
+	block   uint32
+	prev    int // 上一块的数据包数量
+	pending [][]byte
+	codecs  codecs
+}
+
+// NewEncoder 创建每块 k 个数据包、m 个修复包的编码器
+func NewEncoder(k, m int, opts ...reedsolomon.Option) (*Encoder, error) {
+	if k <= 0 || m <= 0 || k+m > 65536 {
+		return nil, ErrInvalidParams
+	}
+	e := &Encoder{k: k, m: m, codecs: codecs{opts: opts}}
+	// 提前创建完整块的编解码器，参数无效时立即报错
+	if _, err := e.codecs.get(k, m); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// DataShards 返回每块的数据包数量
+func (e *Encoder) DataShards() int { return e.k }
+
+// ParityShards 返回每块的修复包数量
+func (e *Encoder) ParityShards() int { return e.m }
+
+// Encode 加入一个数据包，返回需要发送的数据报
+// 第一个数据报是带头部的数据包本身，块满 k 个包时后面跟着 m 个修复包。
+// p 在返回后可以复用。
+func (e *Encoder) Encode(p []byte) ([][]byte, error) {
+	if len(p) > MaxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+	h := Header{Block: e.block, Index: len(e.pending), Data: e.k, Parity: e.m, Prev: e.prev}
+	e.pending = append(e.pending, append([]byte(nil), p...))
+	out := [][]byte{h.appendPacket(make([]byte, 0, headerLen+len(p)), p)}
+	if len(e.pending) < e.k {
+		return out, nil
+	}
+	repair, err := e.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return append(out, repair...), nil
+}
+
+// Flush 提前结束当前块，返回修复包；当前块没有数据包时返回nil
+// 修复包头部中的 k 为块内实际的数据包数量。发送端空闲时调用 Flush，
+// 使最后几个数据包也受到保护。
+func (e *Encoder) Flush() ([][]byte, error) {
+	k := len(e.pending)
+	if k == 0 {
+		return nil, nil
+	}
+	enc, err := e.codecs.get(k, e.m)
+	if err != nil {
+		return nil, err
+	}
+	h := Header{Block: e.block, Data: k, Parity: e.m, Prev: e.prev, Lengths: make([]int, k)}
+	maxLen := 0
+	for i, p := range e.pending {
+		h.Lengths[i] = len(p)
+		maxLen = max(maxLen, len(p))
+	}
+	size := shardSize(maxLen)
+	shards := enc.AllocAligned(k+e.m, size)
+	for i, p := range e.pending {
+		copy(shards[i], p)
+	}
+	if err := enc.Encode(shards); err != nil {
+		return nil, err
+	}
+
+	out := make([][]byte, e.m)
+	for i := range out {
+		h.Index = k + i
+		out[i] = h.appendPacket(make([]byte, 0, headerLen+2*k+size), shards[k+i])
+	}
+	e.pending = e.pending[:0]
+	e.prev = k
+	e.block++
+	return out, nil
+}
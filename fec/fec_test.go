@@ -0,0 +1,361 @@
+package fec
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// makePackets 生成 n 个长度在 [0, maxLen] 之间的随机数据包
+func makePackets(rng *rand.Rand, n, maxLen int) [][]byte {
+	pkts := make([][]byte, n)
+	for i := range pkts {
+		pkts[i] = make([]byte, rng.Intn(maxLen+1))
+		rng.Read(pkts[i])
+	}
+	return pkts
+}
+
+// encodeAll 编码全部数据包并在最后调用 Flush
+func encodeAll(t *testing.T, e *Encoder, pkts [][]byte) [][]byte {
+	t.Helper()
+	var out [][]byte
+	for _, p := range pkts {
+		dgrams, err := e.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, dgrams...)
+	}
+	dgrams, err := e.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(out, dgrams...)
+}
+
+// 测试头部编码和无效数据报
+func TestParsePacket(t *testing.T) {
+	e, err := NewEncoder(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := encodeAll(t, e, [][]byte{[]byte("a"), []byte("bcd"), nil})
+	if len(out) != 5 {
+		t.Fatalf("期望 5 个数据报，实际 %d", len(out))
+	}
+	h, payload, err := ParsePacket(out[1])
+	if err != nil || h.IsRepair() || h.Index != 1 || h.Data != 3 || h.Parity != 2 || string(payload) != "bcd" {
+		t.Fatalf("数据包头部 %+v %q %v", h, payload, err)
+	}
+	h, payload, err = ParsePacket(out[4])
+	if err != nil || !h.IsRepair() || h.Index != 4 || len(payload) != 64 || len(h.Lengths) != 3 || h.Lengths[1] != 3 {
+		t.Fatalf("修复包头部 %+v %d %v", h, len(payload), err)
+	}
+	next, err := e.Encode([]byte("e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _, err := ParsePacket(next[0]); err != nil || h.Block != 1 || h.Prev != 3 {
+		t.Fatalf("下一块的头部 %+v %v", h, err)
+	}
+
+	bad := [][]byte{
+		nil,
+		out[0][:headerLen-1],
+		append([]byte{2}, out[0][1:]...),
+		out[4][:len(out[4])-1],
+		out[4][:headerLen+2],
+	}
+	for i, p := range bad {
+		if _, _, err := ParsePacket(p); err != ErrInvalidPacket {
+			t.Fatalf("%d: 期望 ErrInvalidPacket，实际 %v", i, err)
+		}
+	}
+	if _, err := e.Encode(make([]byte, MaxPacketSize+1)); err != ErrPacketTooLarge {
+		t.Fatalf("期望 ErrPacketTooLarge，实际 %v", err)
+	}
+	if _, err := NewEncoder(0, 1); err != ErrInvalidParams {
+		t.Fatalf("期望 ErrInvalidParams，实际 %v", err)
+	}
+}
+
+// 测试每块丢失不超过 m 个包并乱序到达时全部恢复并按顺序交付
+func TestFEC(t *testing.T) {
+	testFEC(t, 10, 4)
+	testFEC(t, 250, 20)
+}
+
+func testFEC(t *testing.T, k, m int) {
+	rng := rand.New(rand.NewSource(int64(k)))
+	e, err := NewEncoder(k, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := makePackets(rng, 5*k+k/2, 1200)
+	dgrams := encodeAll(t, e, pkts)
+
+	// 每块丢弃 m 个随机包，再在小窗口内打乱顺序
+	var sent [][]byte
+	n := k + m
+	dropped := 0
+	for start := 0; start < len(dgrams); start += n {
+		end := min(start+n, len(dgrams))
+		drop := map[int]bool{}
+		for len(drop) < min(m, end-start-1) {
+			drop[start+rng.Intn(end-start)] = true
+		}
+		for i := start; i < end; i++ {
+			if drop[i] {
+				if h, _, _ := ParsePacket(dgrams[i]); !h.IsRepair() {
+					dropped++
+				}
+				continue
+			}
+			sent = append(sent, dgrams[i])
+		}
+	}
+	for i := range sent {
+		j := i + rng.Intn(min(8, len(sent)-i))
+		sent[i], sent[j] = sent[j], sent[i]
+	}
+
+	d, err := NewDecoder(k, m, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	var got [][]byte
+	for _, p := range sent {
+		out, err := d.Decode(p, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, out...)
+	}
+	// 最后一块不完整时等到延迟上限
+	got = append(got, d.Expire(now.Add(time.Second))...)
+	if len(got) != len(pkts) {
+		t.Fatalf("期望 %d 个数据包，实际 %d", len(pkts), len(got))
+	}
+	for i := range pkts {
+		if !bytes.Equal(got[i], pkts[i]) {
+			t.Fatalf("第 %d 个数据包不一致", i)
+		}
+	}
+	st := d.Stats()
+	if st.Recovered != uint64(dropped) || st.Lost != 0 || st.Invalid != 0 {
+		t.Fatalf("统计 %+v，丢弃 %d", st, dropped)
+	}
+	if _, ok := d.Deadline(); ok {
+		t.Fatal("全部交付后不应有等待中的块")
+	}
+}
+
+// 测试丢失过多时在延迟上限后放弃缺口并继续交付后续块
+func TestFECLatency(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	k, m := 4, 2
+	e, err := NewEncoder(k, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := makePackets(rng, 3*k, 100)
+	dgrams := encodeAll(t, e, pkts)
+
+	const latency = 50 * time.Millisecond
+	d, err := NewDecoder(k, m, latency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	decode := func(i int) [][]byte {
+		t.Helper()
+		out, err := d.Decode(dgrams[i], now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// 第一块丢失数据包 1、2 和一个修复包，无法恢复
+	got := decode(0)
+	if len(got) != 1 {
+		t.Fatalf("期望交付 1 个包，实际 %d", len(got))
+	}
+	got = append(got, decode(3)...)
+	got = append(got, decode(5)...)
+	// 第二块全部到达，但要等第一块超时
+	for i := 6; i < 12; i++ {
+		got = append(got, decode(i)...)
+	}
+	if len(got) != 1 {
+		t.Fatalf("超时前期望交付 1 个包，实际 %d", len(got))
+	}
+	dl, ok := d.Deadline()
+	if !ok || !dl.Equal(now.Add(latency)) {
+		t.Fatalf("截止时间 %v %v", dl, ok)
+	}
+	got = append(got, d.Expire(now.Add(latency))...)
+	want := append([][]byte{pkts[0], pkts[3]}, pkts[4:8]...)
+	if len(got) != len(want) {
+		t.Fatalf("期望交付 %d 个包，实际 %d", len(want), len(got))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("第 %d 个交付的包不一致", i)
+		}
+	}
+
+	// 迟到的数据包被丢弃
+	if out := decode(1); len(out) != 0 {
+		t.Fatal("迟到的数据包不应交付")
+	}
+	// 第三块丢失两个数据包，由修复包恢复
+	now = now.Add(time.Second)
+	got = nil
+	for i := 12; i < 18; i++ {
+		if i != 12 && i != 14 {
+			got = append(got, decode(i)...)
+		}
+	}
+	if len(got) != k {
+		t.Fatalf("期望交付 %d 个包，实际 %d", k, len(got))
+	}
+	st := d.Stats()
+	if st.Lost != 2 || st.Recovered != 2 || st.Late != 1 {
+		t.Fatalf("统计 %+v", st)
+	}
+}
+
+// 测试提前结束的块：数据包头部中的 k 大于修复包中的值
+func TestFECFlush(t *testing.T) {
+	e, err := NewEncoder(8, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := [][]byte{[]byte("one"), []byte("two"), {}}
+	dgrams := encodeAll(t, e, pkts)
+	if len(dgrams) != 6 {
+		t.Fatalf("期望 6 个数据报，实际 %d", len(dgrams))
+	}
+	d, err := NewDecoder(8, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]byte
+	// 丢失数据包 0 和 2
+	for _, i := range []int{1, 3, 4} {
+		out, err := d.Decode(dgrams[i], time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, out...)
+	}
+	if len(got) != 3 || string(got[0]) != "one" || string(got[1]) != "two" || got[2] == nil || len(got[2]) != 0 {
+		t.Fatalf("交付的包 %q", got)
+	}
+	// 下一块从新的块编号开始
+	dgrams = encodeAll(t, e, [][]byte{[]byte("next")})
+	out, err := d.Decode(dgrams[0], time.Time{})
+	if err != nil || len(out) != 1 || string(out[0]) != "next" {
+		t.Fatalf("%q %v", out, err)
+	}
+
+	// 提前结束的块丢失全部修复包时，由下一块头部中的 prev 得知实际的 k，不必等到超时
+	e, err = NewEncoder(10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts = makePackets(rand.New(rand.NewSource(3)), 13, 100)
+	short := encodeAll(t, e, pkts[:3])
+	full := encodeAll(t, e, pkts[3:])
+	d, err = NewDecoder(10, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got = nil
+	for _, dg := range append(short[:3], full...) {
+		out, err := d.Decode(dg, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, out...)
+	}
+	if len(got) != len(pkts) {
+		t.Fatalf("期望交付 %d 个包，实际 %d", len(pkts), len(got))
+	}
+	for i := range pkts {
+		if !bytes.Equal(got[i], pkts[i]) {
+			t.Fatalf("包 %d 不一致", i)
+		}
+	}
+	if st := d.Stats(); st.Lost != 0 {
+		t.Fatalf("期望没有丢失的包，实际统计 %+v", st)
+	}
+
+	// 完整的块丢失最后几个数据包和全部修复包时，下一块的 prev 表明它们确实丢失
+	full = encodeAll(t, e, pkts[:10])
+	next := encodeAll(t, e, pkts[10:])
+	got = nil
+	for _, dg := range append(full[:7], next...) {
+		out, err := d.Decode(dg, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, out...)
+	}
+	got = append(got, d.Expire(start.Add(time.Second))...)
+	if len(got) != 10 || !bytes.Equal(got[6], pkts[6]) || !bytes.Equal(got[7], pkts[10]) {
+		t.Fatalf("交付了 %d 个包", len(got))
+	}
+	if st := d.Stats(); st.Lost != 3 {
+		t.Fatalf("期望丢失 3 个包，实际统计 %+v", st)
+	}
+}
+
+// 测试接收端拒绝与配置不符的头部，编解码器缓存和等待中的块数有上限
+func TestDecoderLimits(t *testing.T) {
+	d, err := NewDecoder(4, 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 伪造的头部声称 k+m 接近 65536，不应创建 GF(2^16) 编解码器
+	for _, h := range []Header{{Data: 65000, Parity: 536}, {Data: 4, Parity: 3}, {Data: 5, Parity: 2}} {
+		if _, err := d.Decode(h.appendPacket(nil, []byte("x")), time.Time{}); err != ErrInvalidPacket {
+			t.Fatalf("%+v: 期望 ErrInvalidPacket，实际 %v", h, err)
+		}
+	}
+	if len(d.codecs.m) != 1 || len(d.blocks) != 0 || d.Stats().Invalid != 3 {
+		t.Fatalf("缓存 %d 个编解码器、%d 个块，统计 %+v", len(d.codecs.m), len(d.blocks), d.Stats())
+	}
+
+	// 属于不同块编号的数据包最多等待 maxPendingBlocks 块
+	for i := 0; i <= maxPendingBlocks; i++ {
+		h := Header{Block: uint32(2 * i), Index: 1, Data: 4, Parity: 2}
+		_, err := d.Decode(h.appendPacket(nil, []byte("x")), time.Time{})
+		if i < maxPendingBlocks && err != nil || i == maxPendingBlocks && err != ErrInvalidPacket {
+			t.Fatalf("块 %d: %v", i, err)
+		}
+	}
+	if len(d.blocks) != maxPendingBlocks {
+		t.Fatalf("期望 %d 个等待中的块，实际 %d", maxPendingBlocks, len(d.blocks))
+	}
+
+	// 提前结束的块大小各不相同，编码器缓存的编解码器数量有上限
+	e, err := NewEncoder(40, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := 1; k < 40; k++ {
+		encodeAll(t, e, make([][]byte, k))
+	}
+	if len(e.codecs.m) > maxCodecs {
+		t.Fatalf("缓存了 %d 个编解码器", len(e.codecs.m))
+	}
+	if _, err := NewDecoder(0, 1, time.Second); err != ErrInvalidParams {
+		t.Fatalf("期望 ErrInvalidParams，实际 %v", err)
+	}
+}
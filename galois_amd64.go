@@ -4,8 +4,24 @@
 
 package reedsolomon
 
+import "github.com/klauspost/cpuid/v2"
+
 const pshufb = true
 
+// kernelCandidates 返回本构建支持的内核路径，从快到慢排列
+func kernelCandidates() []kernelCandidate {
+	avx512 := cpuid.CPU.Supports(cpuid.AVX512F, cpuid.AVX512BW, cpuid.AVX512VL)
+	avx2 := cpuid.CPU.Supports(cpuid.AVX2)
+	ssse3 := cpuid.CPU.Supports(cpuid.SSSE3)
+	sse2 := cpuid.CPU.Supports(cpuid.SSE2)
+	return []kernelCandidate{
+		{KernelAVX512, options{useSSE2: true, useSSSE3: true, useAVX2: true, useAVX512: true}, avx512 && avx2 && ssse3},
+		{KernelAVX2, options{useSSE2: true, useSSSE3: true, useAVX2: true}, avx2 && ssse3},
+		{KernelSSSE3, options{useSSE2: true, useSSSE3: true}, ssse3 && sse2},
+		{KernelGeneric, options{}, true},
+	}
+}
+
 //go:noescape
 func galMulSSSE3(low, high, in, out []byte)
 
@@ -46,7 +62,8 @@ func galMulSSSE3Xor(low, high, in, out []byte) {
 // bigSwitchover 是每个循环处理64字节的大小阈值
 const bigSwitchover = 128
 
-func galMulSlice(c byte, in, out []byte, o *options) {
+func galMulSlice(c byte, in, out []byte) {
+	o := kernel()
 	if c == 1 {
 		copy(out, in)
 		return
@@ -89,9 +106,10 @@ func galMulSlice(c byte, in, out []byte, o *options) {
 	}
 }
 
-func galMulSliceXor(c byte, in, out []byte, o *options) {
+func galMulSliceXor(c byte, in, out []byte) {
+	o := kernel()
 	if c == 1 {
-		sliceXor(in, out, o)
+		sliceXor(in, out)
 		return
 	}
 
@@ -137,7 +155,8 @@ func galMulSliceXor(c byte, in, out []byte, o *options) {
 }
 
 // simple slice xor
-func sliceXor(in, out []byte, o *options) {
+func sliceXor(in, out []byte) {
+	o := kernel()
 	if o.useSSE2 {
 		if len(in) >= bigSwitchover {
 			if o.useAVX2 {
@@ -171,7 +190,7 @@ func sliceXor(in, out []byte, o *options) {
 			out = out[done:]
 		}
 	} else {
-		sliceXorGo(in, out, o)
+		sliceXorGo(in, out)
 		return
 	}
 	out = out[:len(in)]
@@ -181,7 +200,8 @@ func sliceXor(in, out []byte, o *options) {
 }
 
 // 4-way butterfly
-func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
+func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	o := kernel()
 	if len(work[0]) == 0 {
 		return
 	}
@@ -252,11 +272,12 @@ func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options
 		}
 		return
 	}
-	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
+func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	o := kernel()
 	if len(work[0]) == 0 {
 		return
 	}
@@ -333,10 +354,11 @@ func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *optio
 		}
 		return
 	}
-	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
-func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
+func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	o := kernel()
 	if len(work[0]) == 0 {
 		return
 	}
@@ -407,11 +429,12 @@ func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options)
 		}
 		return
 	}
-	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
+func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	o := kernel()
 	if len(work[0]) == 0 {
 		return
 	}
@@ -488,11 +511,12 @@ func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *option
 		}
 		return
 	}
-	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 2-way butterfly forward
-func fftDIT2(x, y []byte, log_m ffe, o *options) {
+func fftDIT2(x, y []byte, log_m ffe) {
+	o := kernel()
 	if len(x) == 0 {
 		return
 	}
@@ -513,12 +537,13 @@ func fftDIT2(x, y []byte, log_m ffe, o *options) {
 	} else {
 		// Reference version:
 		refMulAdd(x, y, log_m)
-		sliceXor(x, y, o)
+		sliceXor(x, y)
 	}
 }
 
 // 2-way butterfly forward
-func fftDIT28(x, y []byte, log_m ffe8, o *options) {
+func fftDIT28(x, y []byte, log_m ffe8) {
+	o := kernel()
 	if len(x) == 0 {
 		return
 	}
@@ -536,12 +561,13 @@ func fftDIT28(x, y []byte, log_m ffe8, o *options) {
 		y = y[done:]
 		x = x[done:]
 	}
-	mulAdd8(x, y, log_m, o)
-	sliceXor(x, y, o)
+	mulAdd8(x, y, log_m)
+	sliceXor(x, y)
 }
 
 // 2-way butterfly inverse
-func ifftDIT28(x, y []byte, log_m ffe8, o *options) {
+func ifftDIT28(x, y []byte, log_m ffe8) {
+	o := kernel()
 	if len(x) == 0 {
 		return
 	}
@@ -559,11 +585,12 @@ func ifftDIT28(x, y []byte, log_m ffe8, o *options) {
 		y = y[done:]
 		x = x[done:]
 	}
-	sliceXor(x, y, o)
-	mulAdd8(x, y, log_m, o)
+	sliceXor(x, y)
+	mulAdd8(x, y, log_m)
 }
 
-func mulAdd8(x, y []byte, log_m ffe8, o *options) {
+func mulAdd8(x, y []byte, log_m ffe8) {
+	o := kernel()
 	if o.useAVX2 {
 		t := &multiply256LUT8[log_m]
 		done := (len(y) >> 6) << 6
@@ -589,7 +616,8 @@ func mulAdd8(x, y []byte, log_m ffe8, o *options) {
 }
 
 // 2-way butterfly
-func ifftDIT2(x, y []byte, log_m ffe, o *options) {
+func ifftDIT2(x, y []byte, log_m ffe) {
+	o := kernel()
 	if len(x) == 0 {
 		return
 	}
@@ -611,12 +639,13 @@ func ifftDIT2(x, y []byte, log_m ffe, o *options) {
 		ifftDIT2_ssse3(x, y, tmp)
 	} else {
 		// Reference version:
-		sliceXor(x, y, o)
+		sliceXor(x, y)
 		refMulAdd(x, y, log_m)
 	}
 }
 
-func mulgf16(x, y []byte, log_m ffe, o *options) {
+func mulgf16(x, y []byte, log_m ffe) {
+	o := kernel()
 	if len(x) == 0 {
 		return
 	}
@@ -639,7 +668,8 @@ func mulgf16(x, y []byte, log_m ffe, o *options) {
 	}
 }
 
-func mulgf8(out, in []byte, log_m ffe8, o *options) {
+func mulgf8(out, in []byte, log_m ffe8) {
+	o := kernel()
 	if o.useAVX2 {
 		t := &multiply256LUT8[log_m]
 		done := (len(in) >> 6) << 6
@@ -7,6 +7,11 @@ package reedsolomon
 
 const pshufb = true
 
+// kernelCandidates 返回本构建支持的内核路径
+func kernelCandidates() []kernelCandidate {
+	return []kernelCandidate{{KernelNEON, options{}, true}}
+}
+
 //go:noescape
 func galMulNEON(low, high, in, out []byte)
 
@@ -6,7 +6,12 @@ package reedsolomon
 
 const pshufb = false
 
-func galMulSlice(c byte, in, out []byte, o *options) {
+// kernelCandidates 返回本构建支持的内核路径
+func kernelCandidates() []kernelCandidate {
+	return []kernelCandidate{{KernelGeneric, options{}, true}}
+}
+
+func galMulSlice(c byte, in, out []byte) {
 	out = out[:len(in)]
 	if c == 1 {
 		copy(out, in)
@@ -18,10 +23,10 @@ func galMulSlice(c byte, in, out []byte, o *options) {
 	}
 }
 
-func galMulSliceXor(c byte, in, out []byte, o *options) {
+func galMulSliceXor(c byte, in, out []byte) {
 	out = out[:len(in)]
 	if c == 1 {
-		sliceXor(in, out, o)
+		sliceXor(in, out)
 		return
 	}
 	mt := mulTable[c][:256]
@@ -30,74 +35,62 @@ func galMulSliceXor(c byte, in, out []byte, o *options) {
 	}
 }
 
-func init() {
-	defaultOptions.useAVX512 = false
-}
-
 // 4-way butterfly
-func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 2-way butterfly forward
-func fftDIT2(x, y []byte, log_m ffe, o *options) {
+func fftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
 	refMulAdd(x, y, log_m)
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 }
 
 // 2-way butterfly forward
-func fftDIT28(x, y []byte, log_m ffe8, o *options) {
+func fftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
 	refMulAdd8(x, y, log_m)
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 }
 
 // 2-way butterfly inverse
-func ifftDIT2(x, y []byte, log_m ffe, o *options) {
+func ifftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 	refMulAdd(x, y, log_m)
 }
 
 // 2-way butterfly inverse
-func ifftDIT28(x, y []byte, log_m ffe8, o *options) {
+func ifftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 	refMulAdd8(x, y, log_m)
 }
 
-func mulgf16(x, y []byte, log_m ffe, o *options) {
+func mulgf16(x, y []byte, log_m ffe) {
 	refMul(x, y, log_m)
 }
 
-func mulgf8(x, y []byte, log_m ffe8, o *options) {
+func mulgf8(x, y []byte, log_m ffe8) {
 	refMul8(x, y, log_m)
 }
 
-// 参考版本: x[] = y[] * log_m
-func refMul8(x, y []byte, log_m ffe8) {
-	lut := &mul8LUTs[log_m]
-
-	for off := 0; off < len(x); off += 64 {
-		src := y[off : off+64]
-		for i, y1 := range src {
-			x[off+i] = byte(lut.Value[y1])
-		}
-	}
+func mulAdd8(x, y []byte, log_m ffe8) {
+	refMulAdd8(x, y, log_m)
 }
@@ -4,13 +4,24 @@
 
 package reedsolomon
 
+import "github.com/klauspost/cpuid/v2"
+
 // bigSwitchover is the size where 64 bytes are processed per loop.
 const bigSwitchover = 128
 
 const pshufb = false
 
+// kernelCandidates 返回本构建支持的内核路径，从快到慢排列
+func kernelCandidates() []kernelCandidate {
+	return []kernelCandidate{
+		{KernelNoPSHUFB, options{useSSE2: true, useAVX2: cpuid.CPU.Supports(cpuid.AVX2)}, cpuid.CPU.Supports(cpuid.SSE2)},
+		{KernelGeneric, options{}, true},
+	}
+}
+
 // simple slice xor
-func sliceXor(in, out []byte, o *options) {
+func sliceXor(in, out []byte) {
+	o := kernel()
 	if o.useSSE2 {
 		if len(in) >= bigSwitchover {
 			if o.useAVX2 {
@@ -32,7 +43,7 @@ func sliceXor(in, out []byte, o *options) {
 			out = out[done:]
 		}
 	} else {
-		sliceXorGo(in, out, o)
+		sliceXorGo(in, out)
 		return
 	}
 	out = out[:len(in)]
@@ -41,7 +52,7 @@ func sliceXor(in, out []byte, o *options) {
 	}
 }
 
-func galMulSlice(c byte, in, out []byte, o *options) {
+func galMulSlice(c byte, in, out []byte) {
 	out = out[:len(in)]
 	if c == 1 {
 		copy(out, in)
@@ -63,10 +74,10 @@ func galMulSlice(c byte, in, out []byte, o *options) {
 	}
 }
 
-func galMulSliceXor(c byte, in, out []byte, o *options) {
+func galMulSliceXor(c byte, in, out []byte) {
 	out = out[:len(in)]
 	if c == 1 {
-		sliceXor(in, out, o)
+		sliceXor(in, out)
 		return
 	}
 	mt := mulTable[c][:256]
@@ -85,62 +96,62 @@ func galMulSliceXor(c byte, in, out []byte, o *options) {
 	}
 }
 
-func init() {
-	defaultOptions.useAVX512 = false
-}
-
 // 4-way butterfly
-func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 2-way butterfly forward
-func fftDIT2(x, y []byte, log_m ffe, o *options) {
+func fftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
 	refMulAdd(x, y, log_m)
-	sliceXor(x, y, o)
+	sliceXor(x, y)
 }
 
 // 2-way butterfly forward
-func fftDIT28(x, y []byte, log_m ffe8, o *options) {
+func fftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
 	refMulAdd8(x, y, log_m)
-	sliceXor(x, y, o)
+	sliceXor(x, y)
 }
 
 // 2-way butterfly inverse
-func ifftDIT2(x, y []byte, log_m ffe, o *options) {
+func ifftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
-	sliceXor(x, y, o)
+	sliceXor(x, y)
 	refMulAdd(x, y, log_m)
 }
 
 // 2-way butterfly inverse
-func ifftDIT28(x, y []byte, log_m ffe8, o *options) {
+func ifftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
-	sliceXor(x, y, o)
+	sliceXor(x, y)
 	refMulAdd8(x, y, log_m)
 }
 
-func mulgf16(x, y []byte, log_m ffe, o *options) {
+func mulgf16(x, y []byte, log_m ffe) {
 	refMul(x, y, log_m)
 }
 
-func mulgf8(x, y []byte, log_m ffe8, o *options) {
+func mulgf8(x, y []byte, log_m ffe8) {
 	refMul8(x, y, log_m)
 }
+
+func mulAdd8(x, y []byte, log_m ffe8) {
+	refMulAdd8(x, y, log_m)
+}
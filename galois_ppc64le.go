@@ -7,6 +7,11 @@ package reedsolomon
 
 const pshufb = true
 
+// kernelCandidates 返回本构建支持的内核路径
+func kernelCandidates() []kernelCandidate {
+	return []kernelCandidate{{KernelPPC64, options{}, true}}
+}
+
 //go:noescape
 func galMulPpc(low, high, in, out []byte)
 
@@ -31,7 +36,7 @@ func galMulPpcXor(low, high, in, out []byte) {
 }
 */
 
-func galMulSlice(c byte, in, out []byte, o *options) {
+func galMulSlice(c byte, in, out []byte) {
 	if c == 1 {
 		copy(out, in)
 		return
@@ -49,9 +54,9 @@ func galMulSlice(c byte, in, out []byte, o *options) {
 	}
 }
 
-func galMulSliceXor(c byte, in, out []byte, o *options) {
+func galMulSliceXor(c byte, in, out []byte) {
 	if c == 1 {
-		sliceXor(in, out, o)
+		sliceXor(in, out)
 		return
 	}
 	done := (len(in) >> 4) << 4
@@ -68,58 +73,58 @@ func galMulSliceXor(c byte, in, out []byte, o *options) {
 }
 
 // 4-way butterfly
-func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	ifftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func ifftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	ifftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe, o *options) {
-	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT4(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe) {
+	fftDIT4Ref(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 4-way butterfly
-func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8, o *options) {
-	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02, o)
+func fftDIT48(work [][]byte, dist int, log_m01, log_m23, log_m02 ffe8) {
+	fftDIT4Ref8(work, dist, log_m01, log_m23, log_m02)
 }
 
 // 2-way butterfly forward
-func fftDIT2(x, y []byte, log_m ffe, o *options) {
+func fftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
 	refMulAdd(x, y, log_m)
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 }
 
 // 2-way butterfly forward
-func fftDIT28(x, y []byte, log_m ffe8, o *options) {
+func fftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
-	mulAdd8(x, y, log_m, o)
-	sliceXorGo(x, y, o)
+	mulAdd8(x, y, log_m)
+	sliceXorGo(x, y)
 }
 
 // 2-way butterfly inverse
-func ifftDIT2(x, y []byte, log_m ffe, o *options) {
+func ifftDIT2(x, y []byte, log_m ffe) {
 	// Reference version:
-	sliceXorGo(x, y, o)
+	sliceXorGo(x, y)
 	refMulAdd(x, y, log_m)
 }
 
 // 2-way butterfly inverse
-func ifftDIT28(x, y []byte, log_m ffe8, o *options) {
+func ifftDIT28(x, y []byte, log_m ffe8) {
 	// Reference version:
-	sliceXorGo(x, y, o)
-	mulAdd8(x, y, log_m, o)
+	sliceXorGo(x, y)
+	mulAdd8(x, y, log_m)
 }
 
-func mulgf16(x, y []byte, log_m ffe, o *options) {
+func mulgf16(x, y []byte, log_m ffe) {
 	refMul(x, y, log_m)
 }
 
-func mulAdd8(out, in []byte, log_m ffe8, o *options) {
+func mulAdd8(out, in []byte, log_m ffe8) {
 	t := &multiply256LUT8[log_m]
 	galMulPpcXor(t[:16], t[16:32], in, out)
 	done := (len(in) >> 4) << 4
@@ -130,7 +135,7 @@ func mulAdd8(out, in []byte, log_m ffe8, o *options) {
 	}
 }
 
-func mulgf8(out, in []byte, log_m ffe8, o *options) {
+func mulgf8(out, in []byte, log_m ffe8) {
 	var done int
 	t := &multiply256LUT8[log_m]
 	galMulPpc(t[:16], t[16:32], in, out)
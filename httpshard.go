@@ -0,0 +1,372 @@
+/**
+ * Reed-Solomon 编码库 - HTTP 分片服务和客户端
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manifestPathName 是 URL 中表示对象清单的分片名
+const manifestPathName = "manifest"
+
+// ShardHandler 通过 HTTP 提供 ShardStore 中的分片
+// 路径为 /<id>/<index>，index 为分片序号或 "manifest"（对象清单）。
+// GET 和 HEAD 支持 Range 请求，PUT 以请求体原子地写入分片。
+// 挂载在子路径下时使用 http.StripPrefix。
+type ShardHandler struct {
+	store ShardStore
+}
+
+// NewShardHandler 创建分片服务
+func NewShardHandler(store ShardStore) *ShardHandler {
+	return &ShardHandler{store: store}
+}
+
+// ServeHTTP 实现 http.Handler
+func (h *ShardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, index, ok := parseShardPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		rc, err := h.store.Get(id, index)
+		if err != nil {
+			writeShardError(w, err)
+			return
+		}
+		defer rc.Close()
+		if err := serveShard(w, r, rc); err != nil {
+			writeShardError(w, err)
+		}
+	case http.MethodPut:
+		if err := h.store.Put(id, index, r.Body); err != nil {
+			writeShardError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// parseShardPath 解析 /<id>/<index>
+func parseShardPath(p string) (id string, index int, ok bool) {
+	id, name, ok := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	if !ok || id == "" || strings.Contains(name, "/") {
+		return "", 0, false
+	}
+	if name == manifestPathName {
+		return id, ManifestIndex, true
+	}
+	index, err := strconv.Atoi(name)
+	if err != nil || index < 0 || strconv.Itoa(index) != name {
+		return "", 0, false
+	}
+	return id, index, true
+}
+
+// shardPath 返回分片的 URL 路径，与 parseShardPath 对应
+func shardPath(id string, index int) string {
+	name := manifestPathName
+	if index != ManifestIndex {
+		name = strconv.Itoa(index)
+	}
+	return "/" + url.PathEscape(id) + "/" + name
+}
+
+// serveShard 输出分片内容
+// 不能 Seek 的分片先写入临时文件，以便 http.ServeContent 处理 Range 请求。
+func serveShard(w http.ResponseWriter, r *http.Request, rc io.ReadCloser) error {
+	var mod time.Time
+	if st, ok := rc.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		if fi, err := st.Stat(); err == nil {
+			mod = fi.ModTime()
+		}
+	}
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		f, err := os.CreateTemp("", "reedsolomon-serve-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		defer f.Close()
+		if _, err := io.Copy(f, rc); err != nil {
+			return err
+		}
+		rs = f
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", mod, rs)
+	return nil
+}
+
+// writeShardError 把存储错误转换为 HTTP 状态码
+func writeShardError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, ErrInvalidObjectID), errors.Is(err, ErrPlacement):
+		code = http.StatusBadRequest
+	default:
+		logger.Warn("分片请求失败: %v", err)
+	}
+	http.Error(w, err.Error(), code)
+}
+
+// ShardClientOptions 配置 ShardClient
+type ShardClientOptions struct {
+	Client     *http.Client  // 为nil时使用 http.DefaultClient
+	Attempts   int           // 每个分片最多尝试的次数，每次换用下一个端点，默认每个端点一次
+	HedgeDelay time.Duration // 每隔该时间仍未凑齐 k 个分片时额外读取一个分片，0 表示不对冲
+	Options    []Option      // 创建解码器时使用的选项
+}
+
+// ShardClient 从一组提供 ShardHandler 的端点读取对象
+// 分片 i 首先从 endpoints[i%len(endpoints)] 读取，失败后依次换用后面的端点重试。
+type ShardClient struct {
+	endpoints []string
+	opts      ShardClientOptions
+}
+
+// NewShardClient 创建客户端，endpoints 为端点的基础 URL，例如 http://host:port/shards
+func NewShardClient(endpoints []string, opts ShardClientOptions) *ShardClient {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = len(endpoints)
+	}
+	eps := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		eps[i] = strings.TrimSuffix(e, "/")
+	}
+	return &ShardClient{endpoints: eps, opts: opts}
+}
+
+// Manifest 依次向各端点读取对象的清单，返回第一份有效的清单
+func (c *ShardClient) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	err := error(fs.ErrNotExist)
+	for _, e := range c.endpoints {
+		var b []byte
+		var rc io.ReadCloser
+		rc, err = c.get(ctx, e, id, ManifestIndex)
+		if err != nil {
+			continue
+		}
+		b, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		m := new(Manifest)
+		if err = m.UnmarshalBinary(b); err == nil {
+			return m, nil
+		}
+	}
+	return nil, err
+}
+
+// Fetch 读取对象 id 并写入 w，返回对象的清单
+// 并发读取 k 个分片（优先数据分片）到临时文件并按清单校验，读取失败或校验不一致时换用其余分片；
+// 设置了 HedgeDelay 时，慢的读取会触发额外分片的读取。凑齐 k 个分片后取消其余读取，
+// 重建丢失的数据分片后输出对象并校验对象摘要。
+func (c *ShardClient) Fetch(ctx context.Context, id string, w io.Writer) (*Manifest, error) {
+	m, err := c.Manifest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := m.NewEncoder(c.opts.Options...)
+	if err != nil {
+		return nil, err
+	}
+	files, err := c.fetchShards(ctx, id, m)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTemps(files)
+
+	present := make([]bool, len(files))
+	for i, f := range files {
+		present[i] = f != nil
+	}
+	get := func(i int) (io.ReadCloser, error) {
+		if files[i] == nil {
+			return nil, fs.ErrNotExist
+		}
+		return io.NopCloser(io.NewSectionReader(files[i], 0, m.ShardLen(i))), nil
+	}
+	if err := joinShards(id, get, m, enc, present, w); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fetchShards 并发读取任意 k 个分片，返回按分片序号排列的临时文件，未读取的为nil
+func (c *ShardClient) fetchShards(parent context.Context, id string, m *Manifest) ([]*os.File, error) {
+	type result struct {
+		index int
+		f     *os.File
+		err   error
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	n, k := m.TotalShards(), m.DataShards
+	files := make([]*os.File, n)
+	results := make(chan result)
+	next, running, got := 0, 0, 0
+	start := func() {
+		i := next
+		next++
+		running++
+		go func() {
+			f, err := c.fetchShard(ctx, id, i, m)
+			results <- result{index: i, f: f, err: err}
+		}()
+	}
+	for next < k {
+		start()
+	}
+
+	var hedge <-chan time.Time
+	if c.opts.HedgeDelay > 0 {
+		t := time.NewTicker(c.opts.HedgeDelay)
+		defer t.Stop()
+		hedge = t.C
+	}
+	var last error
+	for running > 0 {
+		select {
+		case <-hedge:
+			if got < k && next < n {
+				logger.Debug("分片读取较慢，额外读取分片 %d", next)
+				start()
+			}
+		case r := <-results:
+			running--
+			switch {
+			case r.err != nil:
+				logger.Debug("读取分片 %d 失败: %v", r.index, r.err)
+				last = r.err
+				for got < k && got+running < k && next < n {
+					start()
+				}
+			case got < k:
+				files[r.index] = r.f
+				if got++; got == k {
+					cancel()
+				}
+			default:
+				// 已凑齐 k 个分片后完成的对冲读取
+				removeTemps([]*os.File{r.f})
+			}
+		}
+	}
+	if got < k {
+		removeTemps(files)
+		if err := parent.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %w: %v", id, ErrTooFewShards, last)
+	}
+	return files, nil
+}
+
+// fetchShard 依次从各端点读取分片 i，返回内容与清单一致的临时文件
+func (c *ShardClient) fetchShard(ctx context.Context, id string, i int, m *Manifest) (*os.File, error) {
+	var err error
+	for a := 0; a < c.opts.Attempts; a++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		var f *os.File
+		if f, err = c.download(ctx, c.endpoints[(i+a)%len(c.endpoints)], id, i, m); err == nil {
+			return f, nil
+		}
+	}
+	return nil, err
+}
+
+// download 从端点 e 读取分片 i 到临时文件并校验长度和摘要
+func (c *ShardClient) download(ctx context.Context, e, id string, i int, m *Manifest) (f *os.File, err error) {
+	rc, err := c.get(ctx, e, id, i)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if f, err = os.CreateTemp("", "reedsolomon-fetch-*"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			removeTemps([]*os.File{f})
+		}
+	}()
+
+	n := m.ShardLen(i)
+	vw := &verifyWriter{f: f, h: sha256.New(), limit: n, want: m.ShardHashes[i]}
+	if _, err := io.Copy(vw, io.LimitReader(rc, n+1)); err != nil {
+		return nil, err
+	}
+	if vw.n != n {
+		return nil, fmt.Errorf("%s: %w", e, ErrShardHashMismatch)
+	}
+	if err := vw.Close(); err != nil {
+		return nil, fmt.Errorf("%s: %w", e, err)
+	}
+	return f, nil
+}
+
+// get 向端点 e 发送 GET 请求，返回响应体
+// 404 返回满足 errors.Is(err, fs.ErrNotExist) 的错误。
+func (c *ShardClient) get(ctx context.Context, e, id string, index int) (io.ReadCloser, error) {
+	u := e + shardPath(id, index)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", u, fs.ErrNotExist)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+}
+
+// removeTemps 关闭并删除临时文件，忽略nil
+func removeTemps(files []*os.File) {
+	for _, f := range files {
+		if f != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试分片服务的 GET/HEAD/PUT 和 Range 请求
+func TestShardHandler(t *testing.T) {
+	ds := newTestDirStore(t, 4)
+	srv := httptest.NewServer(NewShardHandler(ds))
+	defer srv.Close()
+
+	data := make([]byte, 5000)
+	rand.New(rand.NewSource(1)).Read(data)
+	do := func(method, path string, body []byte, header ...string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do("PUT", "/obj/2", data); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT: %s", resp.Status)
+	}
+	if resp := do("PUT", "/obj/manifest", []byte("m")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("PUT manifest: %s", resp.Status)
+	}
+	resp := do("GET", "/obj/2", nil, "Range", "bytes=100-199")
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(got, data[100:200]) {
+		t.Fatalf("Range 请求: %s，%d 字节", resp.Status, len(got))
+	}
+	resp = do("HEAD", "/obj/2", nil)
+	if resp.StatusCode != http.StatusOK || resp.ContentLength != int64(len(data)) {
+		t.Fatalf("HEAD: %s，长度 %d", resp.Status, resp.ContentLength)
+	}
+	resp = do("GET", "/obj/manifest", nil)
+	if got, _ := io.ReadAll(resp.Body); string(got) != "m" {
+		t.Fatalf("清单内容 %q", got)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{"GET", "/obj/3", http.StatusNotFound},
+		{"GET", "/obj/02", http.StatusNotFound},
+		{"GET", "/obj", http.StatusNotFound},
+		{"GET", "/obj/2/x", http.StatusNotFound},
+		{"PUT", "/obj/4", http.StatusBadRequest},
+		{"PUT", "/../2", http.StatusBadRequest},
+		{"POST", "/obj/2", http.StatusMethodNotAllowed},
+	} {
+		if resp := do(tc.method, tc.path, []byte("x")); resp.StatusCode != tc.code {
+			t.Fatalf("%s %s: 期望 %d，实际 %s", tc.method, tc.path, tc.code, resp.Status)
+		}
+	}
+}
+
+// 测试客户端从多个端点读取任意 k 个分片：重试失败的端点、对冲慢的端点、跳过损坏的分片
+func TestShardClient(t *testing.T) {
+	testShardClient(t, 8, 6, false)
+	testShardClient(t, 250, 20, true)
+}
+
+func testShardClient(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+	ds := newTestDirStore(t, total)
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(int64(total))).Read(data)
+	if _, err := NewObjectStore(ds, enc).Put("obj", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 端点 0 和 3 正常，端点 1 读取分片 1 和 5 时很慢，端点 2 总是失败
+	h := NewShardHandler(ds)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/obj/1" || r.URL.Path == "/obj/5" {
+			select {
+			case <-time.After(10 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+	broken := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	var endpoints []string
+	for _, handler := range []http.Handler{h, slow, broken, h} {
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+		endpoints = append(endpoints, srv.URL)
+	}
+
+	// 丢失数据分片 0，损坏数据分片 3
+	if err := ds.Delete("obj", 0); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(must(ds.ShardDir("obj", 3)), "obj", "3")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)/2] ^= 1
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewShardClient(endpoints, ShardClientOptions{HedgeDelay: 10 * time.Millisecond})
+	start := time.Now()
+	var buf bytes.Buffer
+	m, err := c.Fetch(context.Background(), "obj", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("慢端点没有被对冲，耗时 %v", elapsed)
+	}
+	if m.ObjectSize != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("读取的对象不一致")
+	}
+
+	// 可用分片不足
+	for i := 0; i < total; i++ {
+		if i%2 == 0 {
+			ds.Delete("obj", i)
+		}
+	}
+	c = NewShardClient(endpoints[:1], ShardClientOptions{})
+	if _, err := c.Fetch(context.Background(), "obj", io.Discard); !errors.Is(err, ErrTooFewShards) {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+
+	// 取消上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Fetch(ctx, "obj", io.Discard); !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望 context.Canceled，实际 %v", err)
+	}
+}
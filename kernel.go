@@ -0,0 +1,161 @@
+/**
+ * Reed-Solomon 编码库 - SIMD 内核选择
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// KernelPath 表示一组有限域运算内核的实现路径
+type KernelPath string
+
+// 内核路径
+const (
+	KernelAVX512   KernelPath = "avx512"   // AVX-512 FFT 蝶形运算
+	KernelAVX2     KernelPath = "avx2"     // AVX2 FFT 蝶形运算和查表乘法
+	KernelSSSE3    KernelPath = "ssse3"    // SSSE3 PSHUFB 查表乘法
+	KernelNoPSHUFB KernelPath = "nopshufb" // 以 nopshufb 标签构建，只用 SSE2/AVX2 做异或
+	KernelNEON     KernelPath = "neon"     // arm64 NEON
+	KernelPPC64    KernelPath = "ppc64le"  // ppc64le VSX
+	KernelGeneric  KernelPath = "generic"  // 纯 Go 参考实现
+)
+
+// options 记录内核可以使用的指令集
+type options struct {
+	useSSE2       bool
+	useSSSE3      bool
+	useAVX2       bool
+	useAVX512     bool
+	useAvx512GFNI bool
+}
+
+// kernelCandidate 是本构建中的一条内核路径
+type kernelCandidate struct {
+	path      KernelPath
+	o         options
+	supported bool // 当前 CPU 是否支持
+}
+
+var (
+	activeKernel   atomic.Pointer[kernelCandidate] // 当前使用的内核
+	kernelMu       sync.Mutex                      // 串行化内核切换
+	kernelDisabled []KernelError                   // 启动自检失败的路径，受 kernelMu 保护
+)
+
+func init() {
+	for _, c := range kernelCandidates() {
+		if c.supported {
+			activeKernel.Store(&c)
+			return
+		}
+	}
+}
+
+// kernel 返回当前内核可以使用的指令集
+func kernel() *options {
+	return &activeKernel.Load().o
+}
+
+// lookupKernel 返回当前 CPU 支持的指定内核路径，包括已禁用的路径
+func lookupKernel(p KernelPath) (*kernelCandidate, bool) {
+	for _, c := range kernelCandidates() {
+		if c.path == p && c.supported {
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+// disabledKernel 返回路径被禁用的原因，调用方需持有 kernelMu
+func disabledKernel(p KernelPath) error {
+	for _, e := range kernelDisabled {
+		if e.Path == p {
+			return e
+		}
+	}
+	return nil
+}
+
+// AvailableKernels 返回本构建在当前 CPU 上可用且通过自检的内核路径，从快到慢排列
+func AvailableKernels() []KernelPath {
+	kernelSelfTest()
+	kernelMu.Lock()
+	defer kernelMu.Unlock()
+	var paths []KernelPath
+	for _, c := range kernelCandidates() {
+		if c.supported && disabledKernel(c.path) == nil {
+			paths = append(paths, c.path)
+		}
+	}
+	return paths
+}
+
+// SupportedKernels 返回本构建在当前 CPU 上支持的所有内核路径，从快到慢排列
+// 与 AvailableKernels 不同，结果包括被启动自检禁用的路径，禁用原因见 SelectedKernel。
+func SupportedKernels() []KernelPath {
+	var paths []KernelPath
+	for _, c := range kernelCandidates() {
+		if c.supported {
+			paths = append(paths, c.path)
+		}
+	}
+	return paths
+}
+
+// ActiveKernel 返回当前使用的内核路径
+func ActiveKernel() KernelPath {
+	kernelSelfTest()
+	return activeKernel.Load().path
+}
+
+// UseKernel 切换到指定的内核路径，用于基准测试和排查问题
+// 切换对所有编解码器立即生效，不应在编解码进行时调用。
+// 路径不可用时返回 ErrNotSupported，被自检禁用时返回对应的 KernelError。
+func UseKernel(p KernelPath) error {
+	kernelSelfTest()
+	c, ok := lookupKernel(p)
+	if !ok {
+		return ErrNotSupported
+	}
+	kernelMu.Lock()
+	defer kernelMu.Unlock()
+	if err := disabledKernel(p); err != nil {
+		return err
+	}
+	activeKernel.Store(c)
+	return nil
+}
+
+// KernelInfo 描述最终选用的内核
+type KernelInfo struct {
+	Path       KernelPath    // 当前使用的内核路径
+	SSE2       bool          // 使用 SSE2 异或
+	SSSE3      bool          // 使用 SSSE3 查表乘法
+	AVX2       bool          // 使用 AVX2
+	AVX512     bool          // 使用 AVX-512
+	AVX512GFNI bool          // 使用 GFNI
+	Disabled   []KernelError // 启动自检失败而被禁用的路径
+}
+
+// SelectedKernel 返回自检之后最终选用的内核和指令集
+func SelectedKernel() KernelInfo {
+	kernelSelfTest()
+	kernelMu.Lock()
+	defer kernelMu.Unlock()
+	c := activeKernel.Load()
+	return KernelInfo{
+		Path:       c.path,
+		SSE2:       c.o.useSSE2,
+		SSSE3:      c.o.useSSSE3,
+		AVX2:       c.o.useAVX2,
+		AVX512:     c.o.useAVX512,
+		AVX512GFNI: c.o.useAvx512GFNI,
+		Disabled:   slices.Clone(kernelDisabled),
+	}
+}
@@ -0,0 +1,125 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试每条可用的内核路径都通过已知答案测试，且编码结果与其他路径一致
+func TestKernels(t *testing.T) {
+	paths := AvailableKernels()
+	if len(paths) == 0 {
+		t.Fatal("没有可用的内核路径")
+	}
+	active := ActiveKernel()
+	if active != paths[0] {
+		t.Fatalf("默认应使用最快的路径 %s，实际 %s", paths[0], active)
+	}
+	defer UseKernel(active)
+
+	// 支持的路径包含所有可用的路径，顺序一致
+	supported := SupportedKernels()
+	for i, j := 0, 0; i < len(paths); j++ {
+		if j == len(supported) {
+			t.Fatalf("可用路径 %v 不在支持的路径 %v 中", paths, supported)
+		}
+		if supported[j] == paths[i] {
+			i++
+		}
+	}
+
+	for _, p := range paths {
+		if err := CheckKernel(p); err != nil {
+			t.Fatal(err)
+		}
+		if ActiveKernel() != active {
+			t.Fatalf("CheckKernel(%s) 后当前路径变为 %s", p, ActiveKernel())
+		}
+	}
+	if err := CheckKernel("none"); err != ErrNotSupported {
+		t.Fatalf("期望 ErrNotSupported，实际 %v", err)
+	}
+	if err := UseKernel("none"); err != ErrNotSupported {
+		t.Fatalf("期望 ErrNotSupported，实际 %v", err)
+	}
+
+	testKernelsEncode(t, 10, 4, false)
+	testKernelsEncode(t, 300, 100, true)
+}
+
+func testKernelsEncode(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	var want [][]byte
+	for _, p := range AvailableKernels() {
+		if err := UseKernel(p); err != nil {
+			t.Fatal(err)
+		}
+		var enc ReedSolomon
+		var err error
+		if useFF16 {
+			enc, err = New16(dataShards, parityShards)
+		} else {
+			enc, err = New8(dataShards, parityShards)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards, err := enc.Split(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(shards); err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			want = shards
+			continue
+		}
+		for i := range shards {
+			if !bytes.Equal(shards[i], want[i]) {
+				t.Fatalf("%s: 分片 %d 与 %s 的结果不一致", p, i, AvailableKernels()[0])
+			}
+		}
+	}
+}
+
+// 测试启动自检禁用结果不一致的路径并改用通过测试的最快路径
+func TestSelectKernel(t *testing.T) {
+	cands := []kernelCandidate{
+		{KernelAVX512, options{useAVX512: true}, true},
+		{KernelAVX2, options{useAVX2: true}, true},
+		{KernelSSSE3, options{useSSSE3: true}, false},
+		{KernelGeneric, options{}, true},
+	}
+	broken := func(paths ...KernelPath) func(*kernelCandidate) error {
+		return func(c *kernelCandidate) error {
+			for _, p := range paths {
+				if c.path == p {
+					return KernelError{Path: p, Funcs: []string{"fftDIT4"}}
+				}
+			}
+			return nil
+		}
+	}
+
+	chosen, disabled := selectKernel(cands, broken())
+	if chosen.path != KernelAVX512 || len(disabled) != 0 {
+		t.Fatalf("期望使用 avx512，实际 %s，禁用 %v", chosen.path, disabled)
+	}
+	chosen, disabled = selectKernel(cands, broken(KernelAVX512))
+	if chosen.path != KernelAVX2 || len(disabled) != 1 || disabled[0].Path != KernelAVX512 {
+		t.Fatalf("期望改用 avx2，实际 %s，禁用 %v", chosen.path, disabled)
+	}
+	chosen, disabled = selectKernel(cands, broken(KernelAVX512, KernelAVX2, KernelGeneric))
+	if chosen != nil || len(disabled) != 3 {
+		t.Fatalf("期望没有可用路径，实际 %v，禁用 %v", chosen, disabled)
+	}
+
+	info := SelectedKernel()
+	if info.Path != ActiveKernel() || len(info.Disabled) != 0 {
+		t.Fatalf("自检结果 %+v", info)
+	}
+}
@@ -23,6 +23,9 @@ type leopardFF16 struct {
 	totalShards  int // 总分片数量。计算得出,不应修改。
 
 	workPool sync.Pool
+
+	extraOnce sync.Once     // 额外校验分片使用的插值系数只计算一次
+	extraData *interpolator // 以数据分片为已知点的插值系数
 }
 
 // newFF16 类似于 New,但支持超过 256 个分片。
@@ -35,6 +38,7 @@ type leopardFF16 struct {
 // - *leopardFF16: 新的 leopardFF16 实例
 func newFF16(dataShards, parityShards int) (*leopardFF16, error) {
 	initConstants()
+	kernelSelfTest()
 
 	if dataShards <= 0 || parityShards <= 0 {
 		return nil, ErrInvShardNum
@@ -399,8 +403,10 @@ func (r *leopardFF16) reconstruct(shards [][]byte, recoverAll bool) error {
 	// 快速检查:所有分片都存在吗? 如果是,就没有什么要做的。
 	numberPresent := 0
 	dataPresent := 0
+	present := make([]bool, r.totalShards)
 	for i := 0; i < r.totalShards; i++ {
 		if len(shards[i]) != 0 {
+			present[i] = true
 			numberPresent++
 			if i < r.dataShards {
 				dataPresent++
@@ -425,16 +431,26 @@ func (r *leopardFF16) reconstruct(shards [][]byte, recoverAll bool) error {
 		return ErrInvalidShardSize
 	}
 
+	var errorBits errorBitfield
+	var errLocs [order]ffe
+	r.locateErrors(&errLocs, &errorBits, present, recoverAll, useBits)
+	bits := &errorBits
+	if !useBits {
+		bits = nil
+	}
+	return r.recoverShards(shards, shardSize, recoverAll, &errLocs, bits)
+}
+
+// locateErrors 计算只与丢失位置有关的错误定位多项式取值，useBits 为真时同时准备 errorBits
+// 结果只读，可以在多次、并发的 recoverShards 中重复使用。
+func (r *leopardFF16) locateErrors(errLocs *[order]ffe, errorBits *errorBitfield, present []bool, recoverAll, useBits bool) {
 	m := ceilPow2(r.parityShards)
-	n := ceilPow2(m + r.dataShards)
 
 	const LEO_ERROR_BITFIELD_OPT = true
 
 	// 填充错误位置。
-	var errorBits errorBitfield
-	var errLocs [order]ffe
 	for i := 0; i < r.parityShards; i++ {
-		if len(shards[i+r.dataShards]) == 0 {
+		if !present[i+r.dataShards] {
 			errLocs[i] = 1
 			if LEO_ERROR_BITFIELD_OPT && recoverAll {
 				errorBits.set(i)
@@ -448,7 +464,7 @@ func (r *leopardFF16) reconstruct(shards [][]byte, recoverAll bool) error {
 		}
 	}
 	for i := 0; i < r.dataShards; i++ {
-		if len(shards[i]) == 0 {
+		if !present[i] {
 			errLocs[i+m] = 1
 			if LEO_ERROR_BITFIELD_OPT {
 				errorBits.set(i + m)
@@ -461,13 +477,20 @@ func (r *leopardFF16) reconstruct(shards [][]byte, recoverAll bool) error {
 	}
 
 	// 评估错误定位多项式
-	fwht(&errLocs, m+r.dataShards)
+	fwht(errLocs, m+r.dataShards)
 
 	for i := 0; i < order; i++ {
 		errLocs[i] = ffe((uint(errLocs[i]) * uint(logWalsh[i])) % modulus)
 	}
 
-	fwht(&errLocs, order)
+	fwht(errLocs, order)
+}
+
+// recoverShards 用 locateErrors 的结果重建丢失的分片，只执行与数据有关的变换
+// errorBits 为nil时不使用位图优化。分片必须已经检查过数量和大小。
+func (r *leopardFF16) recoverShards(shards [][]byte, shardSize int, recoverAll bool, errLocs *[order]ffe, errorBits *errorBitfield) error {
+	m := ceilPow2(r.parityShards)
+	n := ceilPow2(m + r.dataShards)
 
 	var work [][]byte
 	if w, ok := r.workPool.Get().([][]byte); ok {
@@ -533,7 +556,7 @@ func (r *leopardFF16) reconstruct(shards [][]byte, recoverAll bool) error {
 
 	outputCount := m + r.dataShards
 
-	if LEO_ERROR_BITFIELD_OPT && useBits {
+	if errorBits != nil {
 		errorBits.fftDIT(work, outputCount, n, fftSkew[:])
 	} else {
 		fftDIT(work, outputCount, n, fftSkew[:])
@@ -12,7 +12,6 @@ package reedsolomon
 
 import (
 	"bytes"
-	"encoding/binary"
 	"io"
 	"math/bits"
 	"sync"
@@ -25,13 +24,20 @@ type leopardFF8 struct {
 	totalShards  int // 总分片数量。计算得出,不应修改。
 
 	workPool    sync.Pool
-	inversion   map[[inversion8Bytes]byte]leopardGF8cache
+	inversion   map[inversion8Key]leopardGF8cache
 	inversionMu sync.Mutex
 }
 
 // inversion8Bytes 用于存储纠错信息。
 const inversion8Bytes = 256 / 8
 
+// inversion8Key 是反转缓存的键: 所有丢失分片的位置，以及是否重建校验分片。
+// errorBits 在只重建数据分片时不包含丢失的校验分片，并且会被 prepare 修改，不能直接用作键。
+type inversion8Key struct {
+	erasures [inversion8Bytes]byte
+	all      bool
+}
+
 // leopardGF8cache 用于存储纠错信息。
 type leopardGF8cache struct {
 	errorLocs [256]ffe8
@@ -50,6 +56,7 @@ type leopardGF8cache struct {
 // - error: 如果参数无效,返回错误。
 func newFF8(dataShards, parityShards int) (*leopardFF8, error) {
 	initConstants8()
+	kernelSelfTest()
 
 	if dataShards <= 0 || parityShards <= 0 {
 		return nil, ErrInvShardNum
@@ -67,7 +74,7 @@ func newFF8(dataShards, parityShards int) (*leopardFF8, error) {
 	if r.totalShards <= 64 {
 		// 对于大量分片数量来说,反转缓存的效果相对较差,并且可能占用大量内存。
 		// r.totalShards 并不是实际占用的空间,而只是一个估计值。
-		r.inversion = make(map[[inversion8Bytes]byte]leopardGF8cache, r.totalShards)
+		r.inversion = make(map[inversion8Key]leopardGF8cache, r.totalShards)
 	}
 	return r, nil
 }
@@ -448,8 +455,10 @@ func (r *leopardFF8) reconstruct(shards [][]byte, recoverAll bool) error {
 	// 快速检查:所有分片是否存在? 如果是这样,就没有什么可做的了。
 	numberPresent := 0
 	dataPresent := 0
+	present := make([]bool, r.totalShards)
 	for i := 0; i < r.totalShards; i++ {
 		if len(shards[i]) != 0 {
+			present[i] = true
 			numberPresent++
 			if i < r.dataShards {
 				dataPresent++
@@ -475,39 +484,28 @@ func (r *leopardFF8) reconstruct(shards [][]byte, recoverAll bool) error {
 	useBits := r.totalShards-numberPresent <= r.parityShards/4 && shardSize*r.totalShards >= 64<<10
 
 	m := ceilPow2(r.parityShards)
-	n := ceilPow2(m + r.dataShards)
 
 	const LEO_ERROR_BITFIELD_OPT = true
 
-	// 填充错误位置。
 	var errorBits errorBitfield8
 	var errLocs [order8]ffe8
-	for i := 0; i < r.parityShards; i++ {
-		if len(shards[i+r.dataShards]) == 0 {
-			errLocs[i] = 1
-			if LEO_ERROR_BITFIELD_OPT && recoverAll {
-				errorBits.set(i)
-			}
+	cacheID := inversion8Key{all: recoverAll}
+	for i, ok := range present {
+		// 与 errLocs 中的位置一致：校验分片 j -> j，数据分片 i -> m+i
+		pos := i + m
+		if i >= r.dataShards {
+			pos = i - r.dataShards
 		}
-	}
-	for i := r.parityShards; i < m; i++ {
-		errLocs[i] = 1
-		if LEO_ERROR_BITFIELD_OPT && recoverAll {
-			errorBits.set(i)
+		if !ok {
+			cacheID.erasures[pos/8] |= 1 << (pos % 8)
 		}
 	}
-	for i := 0; i < r.dataShards; i++ {
-		if len(shards[i]) == 0 {
-			errLocs[i+m] = 1
-			if LEO_ERROR_BITFIELD_OPT {
-				errorBits.set(i + m)
-			}
-		}
+	for i := r.parityShards; i < m; i++ {
+		cacheID.erasures[i/8] |= 1 << (i % 8)
 	}
 
 	var gotInversion bool
 	if LEO_ERROR_BITFIELD_OPT && r.inversion != nil {
-		cacheID := errorBits.cacheID()
 		r.inversionMu.Lock()
 		if inv, ok := r.inversion[cacheID]; ok {
 			r.inversionMu.Unlock()
@@ -526,18 +524,7 @@ func (r *leopardFF8) reconstruct(shards [][]byte, recoverAll bool) error {
 
 	if !gotInversion {
 		// 没有反转...
-		if LEO_ERROR_BITFIELD_OPT && useBits {
-			errorBits.prepare()
-		}
-
-		// 评估错误定位多项式8
-		fwht8(&errLocs, m+r.dataShards)
-
-		for i := 0; i < order8; i++ {
-			errLocs[i] = ffe8((uint(errLocs[i]) * uint(logWalsh8[i])) % modulus8)
-		}
-
-		fwht8(&errLocs, order8)
+		r.locateErrors(&errLocs, &errorBits, present, recoverAll, useBits)
 
 		if r.inversion != nil {
 			c := leopardGF8cache{
@@ -549,11 +536,69 @@ func (r *leopardFF8) reconstruct(shards [][]byte, recoverAll bool) error {
 				c.bits = &x
 			}
 			r.inversionMu.Lock()
-			r.inversion[errorBits.cacheID()] = c
+			r.inversion[cacheID] = c
 			r.inversionMu.Unlock()
 		}
 	}
 
+	bits := &errorBits
+	if !useBits {
+		bits = nil
+	}
+	return r.recoverShards(shards, shardSize, recoverAll, &errLocs, bits)
+}
+
+// locateErrors 计算只与丢失位置有关的错误定位多项式取值，useBits 为真时同时准备 errorBits
+// 结果只读，可以在多次、并发的 recoverShards 中重复使用。
+func (r *leopardFF8) locateErrors(errLocs *[order8]ffe8, errorBits *errorBitfield8, present []bool, recoverAll, useBits bool) {
+	m := ceilPow2(r.parityShards)
+
+	const LEO_ERROR_BITFIELD_OPT = true
+
+	// 填充错误位置。
+	for i := 0; i < r.parityShards; i++ {
+		if !present[i+r.dataShards] {
+			errLocs[i] = 1
+			if LEO_ERROR_BITFIELD_OPT && recoverAll {
+				errorBits.set(i)
+			}
+		}
+	}
+	for i := r.parityShards; i < m; i++ {
+		errLocs[i] = 1
+		if LEO_ERROR_BITFIELD_OPT && recoverAll {
+			errorBits.set(i)
+		}
+	}
+	for i := 0; i < r.dataShards; i++ {
+		if !present[i] {
+			errLocs[i+m] = 1
+			if LEO_ERROR_BITFIELD_OPT {
+				errorBits.set(i + m)
+			}
+		}
+	}
+
+	if LEO_ERROR_BITFIELD_OPT && useBits {
+		errorBits.prepare()
+	}
+
+	// 评估错误定位多项式8
+	fwht8(errLocs, m+r.dataShards)
+
+	for i := 0; i < order8; i++ {
+		errLocs[i] = ffe8((uint(errLocs[i]) * uint(logWalsh8[i])) % modulus8)
+	}
+
+	fwht8(errLocs, order8)
+}
+
+// recoverShards 用 locateErrors 的结果重建丢失的分片，只执行与数据有关的变换
+// errorBits 为nil时不使用位图优化。分片必须已经检查过数量和大小。
+func (r *leopardFF8) recoverShards(shards [][]byte, shardSize int, recoverAll bool, errLocs *[order8]ffe8, errorBits *errorBitfield8) error {
+	m := ceilPow2(r.parityShards)
+	n := ceilPow2(m + r.dataShards)
+
 	var work [][]byte
 	if w, ok := r.workPool.Get().([][]byte); ok {
 		work = w
@@ -659,7 +704,7 @@ func (r *leopardFF8) reconstruct(shards [][]byte, recoverAll bool) error {
 
 		outputCount := m + r.dataShards
 
-		if LEO_ERROR_BITFIELD_OPT && useBits {
+		if errorBits != nil {
 			errorBits.fftDIT8(work, outputCount, n, fftSkew8[:])
 		} else {
 			fftDIT8(work, outputCount, n, fftSkew8[:])
@@ -1173,15 +1218,6 @@ func (e *errorBitfield8) set(i int) {
 	e.Words[0][(i/64)&3] |= uint64(1) << (i & 63)
 }
 
-func (e *errorBitfield8) cacheID() [inversion8Bytes]byte {
-	var res [inversion8Bytes]byte
-	binary.LittleEndian.PutUint64(res[0:8], e.Words[0][0])
-	binary.LittleEndian.PutUint64(res[8:16], e.Words[0][1])
-	binary.LittleEndian.PutUint64(res[16:24], e.Words[0][2])
-	binary.LittleEndian.PutUint64(res[24:32], e.Words[0][3])
-	return res
-}
-
 func (e *errorBitfield8) isNeeded(mipLevel, bit int) bool {
 	if mipLevel >= 8 || mipLevel <= 0 {
 		return true
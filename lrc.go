@@ -0,0 +1,656 @@
+/**
+ * Reed-Solomon 编码库 - 局部重建码
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// LRC 是局部重建码（Local Reconstruction Codes）编解码器
+// k 个数据分片按序号分成 l 个局部组，每组有一个异或局部校验分片；另有 r 个全局校验分片，
+// 由 New(k, r) 创建的编解码器（GF(2^8) 或 GF(2^16)）对全部数据分片编码。分片排列为:
+//
+//	数据分片 0..k-1 | 局部校验分片 k..k+l-1 | 全局校验分片 k+l..k+l+r-1
+//
+// 一个组内只丢失一个分片时只需读取同组的其他分片即可修复；否则退回全局解码。
+// 局部修复之后，剩余丢失的数据分片不超过可用的全局校验分片数时一定可以恢复，因此任意 r 个
+// 分片丢失都可以恢复。超过时把含有丢失数据分片的组的局部校验方程与全局校验方程联立求解，
+// 最多再多恢复与这些组数相同的数据分片，方程组是否可解取决于系数，ReadSet 给出确切的判断。
+// 注意 r 为2的幂时，全部全局校验分片之和等于全部数据分片之和，局部校验方程之和与之重复，
+// 最多只能多恢复组数减一个数据分片：同一组丢失 r+1 个数据分片时无法恢复。
+type LRC struct {
+	global       ReedSolomon
+	dataShards   int
+	localGroups  int
+	globalParity int
+	starts       []int // 第 g 组数据分片的起始序号，最后一项为 k
+}
+
+// NewLRC 创建局部重建码编解码器
+// dataShards 个数据分片尽量均匀地分成 localGroups 组，opts 传给全局校验使用的编解码器。
+func NewLRC(dataShards, localGroups, globalParity int, opts ...Option) (*LRC, error) {
+	if localGroups <= 0 || localGroups > dataShards {
+		return nil, ErrInvShardNum
+	}
+	global, err := New(dataShards, globalParity, opts...)
+	if err != nil {
+		return nil, err
+	}
+	starts := make([]int, localGroups+1)
+	for g := range starts {
+		starts[g] = g * dataShards / localGroups
+	}
+	return &LRC{
+		global:       global,
+		dataShards:   dataShards,
+		localGroups:  localGroups,
+		globalParity: globalParity,
+		starts:       starts,
+	}, nil
+}
+
+// DataShards 返回数据分片数量
+func (c *LRC) DataShards() int { return c.dataShards }
+
+// LocalGroups 返回局部组（局部校验分片）数量
+func (c *LRC) LocalGroups() int { return c.localGroups }
+
+// GlobalParity 返回全局校验分片数量
+func (c *LRC) GlobalParity() int { return c.globalParity }
+
+// TotalShards 返回总分片数量
+func (c *LRC) TotalShards() int { return c.dataShards + c.localGroups + c.globalParity }
+
+// Group 返回分片 i 所在的局部组，全局校验分片返回 -1
+func (c *LRC) Group(i int) int {
+	switch {
+	case i < 0 || i >= c.dataShards+c.localGroups:
+		return -1
+	case i >= c.dataShards:
+		return i - c.dataShards
+	}
+	return sort.SearchInts(c.starts, i+1) - 1
+}
+
+// members 返回第 g 组的数据分片和局部校验分片序号
+func (c *LRC) members(g int) []int {
+	m := make([]int, 0, c.starts[g+1]-c.starts[g]+1)
+	for i := c.starts[g]; i < c.starts[g+1]; i++ {
+		m = append(m, i)
+	}
+	return append(m, c.dataShards+g)
+}
+
+// globalView 返回全局编解码器使用的分片：数据分片和全局校验分片
+func (c *LRC) globalView(shards [][]byte) [][]byte {
+	view := make([][]byte, 0, c.dataShards+c.globalParity)
+	view = append(view, shards[:c.dataShards]...)
+	return append(view, shards[c.dataShards+c.localGroups:]...)
+}
+
+// setGlobalView 把全局编解码器重建的分片写回 shards
+func (c *LRC) setGlobalView(shards, view [][]byte) {
+	copy(shards, view[:c.dataShards])
+	copy(shards[c.dataShards+c.localGroups:], view[c.dataShards:])
+}
+
+// shardSize 检查分片数量和大小，返回分片大小
+func (c *LRC) shardSize(shards [][]byte) (int, error) {
+	if len(shards) != c.TotalShards() {
+		return 0, ErrTooFewShards
+	}
+	size := 0
+	for _, s := range shards {
+		if len(s) == 0 {
+			continue
+		}
+		if size != 0 && len(s) != size {
+			return 0, ErrShardSize
+		}
+		size = len(s)
+	}
+	if size == 0 {
+		return 0, ErrShardNoData
+	}
+	return size, nil
+}
+
+// xorGroup 把第 g 组除 skip 外的分片异或到 out
+func (c *LRC) xorGroup(shards [][]byte, g, skip int, out []byte) {
+	clear(out)
+	for _, i := range c.members(g) {
+		if i != skip {
+			sliceXor(shards[i], out)
+		}
+	}
+}
+
+// Split 把数据拆分为全部分片，校验分片已分配但未编码
+func (c *LRC) Split(data []byte) ([][]byte, error) {
+	split, err := c.global.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	shards := make([][]byte, 0, c.TotalShards())
+	shards = append(shards, split[:c.dataShards]...)
+	shards = append(shards, AllocAligned(c.localGroups, len(split[0]))...)
+	return append(shards, split[c.dataShards:]...), nil
+}
+
+// Join 合并数据分片，数据分片必须齐全
+func (c *LRC) Join(dst io.Writer, shards [][]byte, outSize int) error {
+	if len(shards) < c.dataShards {
+		return ErrTooFewShards
+	}
+	return c.global.Join(dst, shards[:c.dataShards], outSize)
+}
+
+// Encode 由数据分片生成局部校验分片和全局校验分片
+func (c *LRC) Encode(shards [][]byte) error {
+	size, err := c.shardSize(shards)
+	if err != nil {
+		return err
+	}
+	for _, s := range shards {
+		if len(s) != size {
+			return ErrShardSize
+		}
+	}
+	if err := c.global.Encode(c.globalView(shards)); err != nil {
+		return err
+	}
+	for g := 0; g < c.localGroups; g++ {
+		c.xorGroup(shards, g, c.dataShards+g, shards[c.dataShards+g])
+	}
+	return nil
+}
+
+// Verify 检查局部校验分片和全局校验分片是否与数据分片一致
+func (c *LRC) Verify(shards [][]byte) (bool, error) {
+	size, err := c.shardSize(shards)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range shards {
+		if len(s) != size {
+			return false, ErrShardSize
+		}
+	}
+	buf := make([]byte, size)
+	for g := 0; g < c.localGroups; g++ {
+		c.xorGroup(shards, g, -1, buf)
+		for _, b := range buf {
+			if b != 0 {
+				return false, nil
+			}
+		}
+	}
+	return c.global.Verify(c.globalView(shards))
+}
+
+// Reconstruct 重建全部丢失的分片（长度为0的分片视为丢失）
+// 只丢失一个分片的组用异或修复，其余丢失的数据分片用全局校验分片解码。
+func (c *LRC) Reconstruct(shards [][]byte) error {
+	return c.reconstruct(shards, false)
+}
+
+// ReconstructData 只重建丢失的数据分片
+func (c *LRC) ReconstructData(shards [][]byte) error {
+	return c.reconstruct(shards, true)
+}
+
+func (c *LRC) reconstruct(shards [][]byte, dataOnly bool) error {
+	size, err := c.shardSize(shards)
+	if err != nil {
+		return err
+	}
+	present := make([]bool, len(shards))
+	for i, s := range shards {
+		present[i] = len(s) != 0
+	}
+	if _, err := c.ReadSet(present); err != nil {
+		return err
+	}
+
+	// 局部修复
+	for g := 0; g < c.localGroups; g++ {
+		missing := c.missingInGroup(present, g)
+		if len(missing) != 1 || dataOnly && missing[0] >= c.dataShards {
+			continue
+		}
+		i := missing[0]
+		if cap(shards[i]) >= size {
+			shards[i] = shards[i][:size]
+		} else {
+			shards[i] = AllocAligned(1, size)[0]
+		}
+		c.xorGroup(shards, g, i, shards[i])
+		present[i] = true
+	}
+
+	// 全局校验分片不足时联立局部校验方程求解丢失的数据分片
+	if missing := c.missingData(present); len(missing) > c.globalPresent(present) {
+		if err := c.solve(shards, present, missing, size); err != nil {
+			return err
+		}
+	}
+
+	// 全局解码
+	needData, needGlobal := false, false
+	for i := 0; i < c.dataShards; i++ {
+		needData = needData || !present[i]
+	}
+	for i := c.dataShards + c.localGroups; i < len(shards); i++ {
+		needGlobal = needGlobal || !dataOnly && !present[i]
+	}
+	if needData || needGlobal {
+		view := c.globalView(shards)
+		if needGlobal {
+			err = c.global.Reconstruct(view)
+		} else {
+			err = c.global.ReconstructData(view)
+		}
+		if err != nil {
+			return err
+		}
+		c.setGlobalView(shards, view)
+	}
+	if dataOnly {
+		return nil
+	}
+
+	// 数据分片齐全后补齐剩余的局部校验分片
+	for g := 0; g < c.localGroups; g++ {
+		i := c.dataShards + g
+		if present[i] {
+			continue
+		}
+		if cap(shards[i]) >= size {
+			shards[i] = shards[i][:size]
+		} else {
+			shards[i] = AllocAligned(1, size)[0]
+		}
+		c.xorGroup(shards, g, i, shards[i])
+	}
+	return nil
+}
+
+// missingData 返回丢失的数据分片序号
+func (c *LRC) missingData(present []bool) []int {
+	var missing []int
+	for i := 0; i < c.dataShards; i++ {
+		if !present[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// globalPresent 返回可用的全局校验分片数量
+func (c *LRC) globalPresent(present []bool) int {
+	n := 0
+	for _, ok := range present[c.dataShards+c.localGroups:] {
+		if ok {
+			n++
+		}
+	}
+	return n
+}
+
+// missingInGroup 返回第 g 组中丢失的分片序号
+func (c *LRC) missingInGroup(present []bool, g int) []int {
+	var missing []int
+	for _, i := range c.members(g) {
+		if !present[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// ReadSet 返回重建全部丢失分片最少需要读取的分片序号（按序号升序）
+// present 的长度必须等于总分片数。只丢失一个分片的组只读取同组的其他分片；
+// 需要全局解码时再读取 k 个数据分片或全局校验分片，优先使用已读取或已局部修复的数据分片。
+// 可用的全局校验分片不足时读取全部可用的数据分片和联立求解用到的局部、全局校验分片。
+// 无法恢复时返回 ErrTooFewShards。没有丢失的分片时返回空集。
+func (c *LRC) ReadSet(present []bool) ([]int, error) {
+	if len(present) != c.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+	read := make([]bool, len(present))
+	known := append([]bool(nil), present...) // 可用或可以算出的分片
+
+	// 局部修复
+	for g := 0; g < c.localGroups; g++ {
+		missing := c.missingInGroup(present, g)
+		if len(missing) != 1 {
+			continue
+		}
+		for _, i := range c.members(g) {
+			read[i] = i != missing[0]
+		}
+		known[missing[0]] = true
+	}
+
+	// 全局校验分片不足时联立求解：读取全部可用的数据分片和用到的校验分片
+	if missing := c.missingData(known); len(missing) > c.globalPresent(present) {
+		rows, _, err := c.plan(known, missing)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < c.dataShards; i++ {
+			read[i] = read[i] || present[i]
+		}
+		for _, i := range rows {
+			read[i] = true
+		}
+		for i := range known[:c.dataShards] {
+			known[i] = true
+		}
+	}
+
+	// 全局解码：需要 k 个已知的数据分片或全局校验分片
+	needGlobal := false
+	for i, ok := range known {
+		if !ok && (i < c.dataShards || i >= c.dataShards+c.localGroups) {
+			needGlobal = true
+		}
+	}
+	if needGlobal {
+		var free, data, parity []int // 已读取或已修复的、需要读取的数据分片、需要读取的全局校验分片
+		for i, ok := range known {
+			switch {
+			case !ok || c.Group(i) >= 0 && i >= c.dataShards:
+			case read[i] || !present[i]:
+				free = append(free, i)
+			case i < c.dataShards:
+				data = append(data, i)
+			default:
+				parity = append(parity, i)
+			}
+		}
+		use := append(append(free, data...), parity...)
+		if len(use) < c.dataShards {
+			return nil, ErrTooFewShards
+		}
+		for _, i := range use[:c.dataShards] {
+			read[i] = present[i]
+		}
+	}
+	// 局部校验分片只在所在组丢失多个分片时才无法局部修复，此时组内有数据分片丢失，
+	// 全局解码后数据分片齐全，无需额外读取
+
+	set := []int{}
+	for i, ok := range read {
+		if ok {
+			set = append(set, i)
+		}
+	}
+	return set, nil
+}
+
+// plan 为联立求解丢失的数据分片 missing 选择方程
+// 候选方程依次为含有丢失数据分片的组的局部校验方程和可用的全局校验方程，优先使用局部方程。
+// 返回所用方程对应的校验分片序号 rows，以及 comb[i][e]：missing[i] 等于各方程右端乘以
+// comb[i][e] 之和。方程组不可解时返回 ErrTooFewShards。
+func (c *LRC) plan(known []bool, missing []int) (rows []int, comb [][]uint16, err error) {
+	f := lrcFieldOf(c.global)
+	if f == nil {
+		return nil, nil, ErrTooFewShards
+	}
+	var cand []int
+	var coef [][]uint16 // coef[e][i] 是方程 e 中 missing[i] 的系数
+	for g := 0; g < c.localGroups; g++ {
+		if !known[c.dataShards+g] {
+			continue
+		}
+		row := make([]uint16, len(missing))
+		used := false
+		for i, x := range missing {
+			if c.Group(x) == g {
+				row[i], used = 1, true
+			}
+		}
+		if used {
+			cand = append(cand, c.dataShards+g)
+			coef = append(coef, row)
+		}
+	}
+	var parity []int
+	for j := 0; j < c.globalParity; j++ {
+		if known[c.dataShards+c.localGroups+j] {
+			parity = append(parity, j)
+		}
+	}
+	for _, row := range c.globalCoeffs(f, missing, parity) {
+		coef = append(coef, row)
+	}
+	for _, j := range parity {
+		cand = append(cand, c.dataShards+c.localGroups+j)
+	}
+
+	// 对 [coef | I] 做高斯-约当消元，主元行的右半部分就是组合系数
+	n, u := len(cand), len(missing)
+	aug := make([][]uint16, n)
+	for e := range aug {
+		aug[e] = make([]uint16, u+n)
+		copy(aug[e], coef[e])
+		aug[e][u+e] = 1
+	}
+	pivots := make([]int, u)
+	done := make([]bool, n)
+	for col := 0; col < u; col++ {
+		p := -1
+		for e := 0; e < n; e++ {
+			if !done[e] && aug[e][col] != 0 {
+				p = e
+				break
+			}
+		}
+		if p < 0 {
+			return nil, nil, ErrTooFewShards
+		}
+		done[p], pivots[col] = true, p
+		inv := f.inv(aug[p][col])
+		for j := range aug[p] {
+			aug[p][j] = f.mul(aug[p][j], inv)
+		}
+		for e := 0; e < n; e++ {
+			if e == p || aug[e][col] == 0 {
+				continue
+			}
+			m := aug[e][col]
+			for j := range aug[e] {
+				aug[e][j] ^= f.mul(aug[p][j], m)
+			}
+		}
+	}
+
+	used := make([]bool, n)
+	comb = make([][]uint16, u)
+	for i, p := range pivots {
+		comb[i] = aug[p][u:]
+		for e, v := range comb[i] {
+			used[e] = used[e] || v != 0
+		}
+	}
+	// 只保留用到的方程
+	var keep []int
+	for e, ok := range used {
+		if ok {
+			keep = append(keep, e)
+			rows = append(rows, cand[e])
+		}
+	}
+	for i := range comb {
+		row := make([]uint16, len(keep))
+		for j, e := range keep {
+			row[j] = comb[i][e]
+		}
+		comb[i] = row
+	}
+	return rows, comb, nil
+}
+
+// globalCoeffs 返回全局校验分片 parity 中各丢失数据分片 missing 的系数
+// 编解码器是线性的：只有 missing[i] 的第一个符号为1时，全局校验分片的第一个符号就是系数。
+func (c *LRC) globalCoeffs(f lrcField, missing, parity []int) [][]uint16 {
+	coef := make([][]uint16, len(parity))
+	for j := range coef {
+		coef[j] = make([]uint16, len(missing))
+	}
+	if len(parity) == 0 {
+		return coef
+	}
+	view := AllocAligned(c.dataShards+c.globalParity, 64)
+	for i, x := range missing {
+		for _, s := range view {
+			clear(s)
+		}
+		f.unit(view[x])
+		if err := c.global.Encode(view); err != nil {
+			// 64字节的分片总是可以编码
+			panic(err)
+		}
+		for j, p := range parity {
+			coef[j][i] = f.first(view[c.dataShards+p])
+		}
+	}
+	return coef
+}
+
+// solve 联立局部校验方程和全局校验方程重建丢失的数据分片 missing
+func (c *LRC) solve(shards [][]byte, present []bool, missing []int, size int) error {
+	rows, comb, err := c.plan(present, missing)
+	if err != nil {
+		return err
+	}
+	f := lrcFieldOf(c.global)
+
+	// 方程右端：局部方程是局部校验分片与组内可用数据分片的异或；
+	// 全局方程是全局校验分片与丢失数据分片置零后重新编码的结果的异或
+	rhs := make([][]byte, len(rows))
+	var view [][]byte
+	for e, i := range rows {
+		if g := c.Group(i); g >= 0 {
+			rhs[e] = bytes.Clone(shards[i])
+			for _, j := range c.members(g) {
+				if j < c.dataShards && present[j] {
+					sliceXor(shards[j], rhs[e])
+				}
+			}
+			continue
+		}
+		if view == nil {
+			view = c.globalView(shards)
+			zero := make([]byte, size)
+			for _, x := range missing {
+				view[x] = zero
+			}
+			for j := c.dataShards; j < len(view); j++ {
+				view[j] = AllocAligned(1, size)[0]
+			}
+			if err := c.global.Encode(view); err != nil {
+				return err
+			}
+		}
+		rhs[e] = view[i-c.localGroups]
+		sliceXor(shards[i], rhs[e])
+	}
+
+	tmp := make([]byte, size)
+	for i, x := range missing {
+		out := shards[x]
+		if cap(out) >= size {
+			out = out[:size]
+		} else {
+			out = AllocAligned(1, size)[0]
+		}
+		clear(out)
+		for e, v := range comb[i] {
+			switch v {
+			case 0:
+			case 1:
+				sliceXor(rhs[e], out)
+			default:
+				f.mulSlice(tmp, rhs[e], v)
+				sliceXor(tmp, out)
+			}
+		}
+		shards[x] = out
+	}
+	for _, x := range missing {
+		present[x] = true
+	}
+	return nil
+}
+
+// lrcField 是全局编解码器所在有限域上的运算，元素使用 leopard 的表示
+type lrcField interface {
+	mul(a, b uint16) uint16
+	inv(a uint16) uint16
+	mulSlice(out, in []byte, c uint16) // out = in * c，c 不为0
+	unit(shard []byte)                 // 把分片的第一个符号设为1
+	first(shard []byte) uint16         // 返回分片的第一个符号
+}
+
+// lrcFieldOf 返回编解码器所在的有限域，不支持时返回nil
+func lrcFieldOf(enc ReedSolomon) lrcField {
+	switch enc.(type) {
+	case *rsFF8:
+		return lrcField8{}
+	case *rsFF16:
+		return lrcField16{}
+	}
+	return nil
+}
+
+// lrcField8 是 GF(2^8)，每个字节一个符号
+type lrcField8 struct{}
+
+func (lrcField8) mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return uint16(expLUT8[addMod8(logLUT8[a], logLUT8[b])])
+}
+
+func (lrcField8) inv(a uint16) uint16 {
+	return uint16(expLUT8[modulus8-logLUT8[a]])
+}
+
+func (lrcField8) mulSlice(out, in []byte, c uint16) {
+	mulgf8(out, in, logLUT8[c])
+}
+
+func (lrcField8) unit(shard []byte) { shard[0] = 1 }
+
+func (lrcField8) first(shard []byte) uint16 { return uint16(shard[0]) }
+
+// lrcField16 是 GF(2^16)，每64字节中前32字节是低字节，后32字节是高字节
+type lrcField16 struct{}
+
+func (lrcField16) mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return uint16(expLUT[addMod(logLUT[a], logLUT[b])])
+}
+
+func (lrcField16) inv(a uint16) uint16 {
+	return uint16(expLUT[modulus-logLUT[a]])
+}
+
+func (lrcField16) mulSlice(out, in []byte, c uint16) {
+	mulgf16(out, in, logLUT[c])
+}
+
+func (lrcField16) unit(shard []byte) { shard[0] = 1 }
+
+func (lrcField16) first(shard []byte) uint16 { return uint16(shard[0]) | uint16(shard[32])<<8 }
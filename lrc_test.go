@@ -0,0 +1,200 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试局部重建码的编码、局部修复和全局解码
+func TestLRC(t *testing.T) {
+	testLRC(t, 12, 3, 2)
+	testLRC(t, 12, 2, 3)
+	testLRC(t, 20, 2, 4)
+	testLRC(t, 300, 10, 4)
+	testLRC(t, 300, 10, 5)
+}
+
+func testLRC(t *testing.T, dataShards, localGroups, globalParity int) {
+	c, err := NewLRC(dataShards, localGroups, globalParity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := c.TotalShards()
+	data := make([]byte, dataShards*64*3+17)
+	rng := rand.New(rand.NewSource(int64(total)))
+	rng.Read(data)
+	shards, err := c.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := c.Verify(shards); !ok || err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	orig := make([][]byte, total)
+	for i := range shards {
+		orig[i] = bytes.Clone(shards[i])
+	}
+
+	groupSize := func(g int) int {
+		n := 0
+		for i := 0; i < dataShards; i++ {
+			if c.Group(i) == g {
+				n++
+			}
+		}
+		return n
+	}
+	// lose 丢弃指定的分片，检查读取集合大小并重建
+	lose := func(want int, lost ...int) {
+		t.Helper()
+		work := make([][]byte, total)
+		for i := range work {
+			work[i] = bytes.Clone(orig[i])
+		}
+		present := make([]bool, total)
+		for i := range present {
+			present[i] = true
+		}
+		for _, i := range lost {
+			work[i] = nil
+			present[i] = false
+		}
+		set, err := c.ReadSet(present)
+		if err != nil {
+			t.Fatalf("丢失 %v: %v", lost, err)
+		}
+		if len(set) != want {
+			t.Fatalf("丢失 %v: 读取 %d 个分片 %v，期望 %d", lost, len(set), set, want)
+		}
+		for _, i := range set {
+			if !present[i] {
+				t.Fatalf("丢失 %v: 读取集合包含丢失的分片 %d", lost, i)
+			}
+		}
+		if err := c.Reconstruct(work); err != nil {
+			t.Fatalf("丢失 %v: %v", lost, err)
+		}
+		for i := range work {
+			if !bytes.Equal(work[i], orig[i]) {
+				t.Fatalf("丢失 %v: 分片 %d 不一致", lost, i)
+			}
+		}
+	}
+
+	last := dataShards - 1
+	lastGroup := c.Group(last)
+	local := dataShards + lastGroup
+	global := dataShards + localGroups
+
+	lose(0)
+	// 单个数据分片或局部校验分片只读取同组的其他分片
+	lose(groupSize(0), 0)
+	lose(groupSize(lastGroup), last)
+	lose(groupSize(lastGroup), local)
+	// 全局校验分片和同组多个分片需要全局解码
+	lose(dataShards, global)
+	lose(dataShards, 0, 1)
+	// 每组丢失一个数据分片同时丢失全部全局校验分片：读取其余数据分片和局部校验分片，
+	// 局部修复的分片参与全局编码，无需额外读取
+	var lost []int
+	for g := 0; g < localGroups; g++ {
+		for i := 0; i < dataShards; i++ {
+			if c.Group(i) == g {
+				lost = append(lost, i)
+				break
+			}
+		}
+	}
+	for j := 0; j < globalParity; j++ {
+		lost = append(lost, global+j)
+	}
+	lose(dataShards, lost...)
+
+	// 丢失的数据分片多于全局校验分片时联立局部校验方程，读取其余全部数据分片
+	// 两个组各丢失多个数据分片，共 r+1 个
+	if localGroups > 1 && globalParity > 1 {
+		lost := []int{0, 1}
+		for i := 0; i < globalParity-1; i++ {
+			lost = append(lost, c.starts[1]+i)
+		}
+		lose(dataShards, lost...)
+	}
+	// 同组丢失 r+1 个数据分片：r 为2的幂时全局校验分片之和等于全部数据分片之和，
+	// 局部校验方程不提供新的信息
+	present := make([]bool, total)
+	for i := range present {
+		present[i] = i > globalParity
+	}
+	if globalParity&(globalParity-1) != 0 {
+		same := []int{}
+		for i := 0; i <= globalParity; i++ {
+			same = append(same, i)
+		}
+		lose(dataShards, same...)
+	} else if _, err := c.ReadSet(present); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+
+	// 同组丢失的数据分片比全局校验分片多两个时无法恢复
+	present = make([]bool, total)
+	for i := range present {
+		present[i] = i > globalParity+1
+	}
+	work := append([][]byte(nil), orig...)
+	for i := 0; i <= globalParity+1; i++ {
+		work[i] = nil
+	}
+	if _, err := c.ReadSet(present); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+	if err := c.Reconstruct(work); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+
+	// ReconstructData 不补齐校验分片
+	work = append([][]byte(nil), orig...)
+	work[0], work[local], work[global] = nil, nil, nil
+	if err := c.ReconstructData(work); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(work[0], orig[0]) || work[local] != nil || work[global] != nil {
+		t.Fatal("ReconstructData 结果不正确")
+	}
+	var out bytes.Buffer
+	if err := c.Join(&out, work, len(data)); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("合并失败: %v", err)
+	}
+
+	// 篡改局部校验分片
+	work = make([][]byte, total)
+	for i := range work {
+		work[i] = bytes.Clone(orig[i])
+	}
+	work[local][5] ^= 1
+	if ok, err := c.Verify(work); ok || err != nil {
+		t.Fatalf("篡改后校验: %v %v", ok, err)
+	}
+}
+
+// 测试无效的参数
+func TestLRCErrors(t *testing.T) {
+	for _, p := range [][3]int{{4, 0, 2}, {4, 5, 2}, {4, 2, 0}} {
+		if _, err := NewLRC(p[0], p[1], p[2]); err != ErrInvShardNum {
+			t.Fatalf("%v: 期望 ErrInvShardNum，实际 %v", p, err)
+		}
+	}
+	c, err := NewLRC(4, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Group(0) != 0 || c.Group(3) != 1 || c.Group(4) != 0 || c.Group(5) != 1 || c.Group(6) != -1 {
+		t.Fatal("分组不正确")
+	}
+	if _, err := c.ReadSet(make([]bool, 3)); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
@@ -0,0 +1,510 @@
+/**
+ * Reed-Solomon 编码库 - 分片集清单
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+)
+
+// ManifestVersion 是当前清单格式的版本号
+const ManifestVersion = 1
+
+// 清单二进制编码的魔数
+var manifestMagic = [4]byte{'R', 'S', 'M', 'F'}
+
+// 分片布局，描述原始数据是如何被拆分到数据分片中的
+const (
+	LayoutSplit  = "split"        // 由 Split 生成：每个分片大小相同，按顺序拼接
+	LayoutStream = "stream-split" // 由 StreamSplit 生成：最后一个数据分片按64字节对齐补零
+)
+
+// 布局在二进制编码中的取值
+var layoutCodes = []string{"", LayoutSplit, LayoutStream}
+
+// Digest 是一个 SHA-256 摘要，JSON 中以十六进制字符串表示
+type Digest [sha256.Size]byte
+
+// MarshalText 实现 encoding.TextMarshaler
+func (d Digest) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(d[:])), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler
+func (d *Digest) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(d) {
+		return ErrInvalidManifest
+	}
+	_, err := hex.Decode(d[:], text)
+	if err != nil {
+		return ErrInvalidManifest
+	}
+	return nil
+}
+
+// String 返回摘要的十六进制表示
+func (d Digest) String() string {
+	return hex.EncodeToString(d[:])
+}
+
+// Manifest 描述一个完整的分片集：编解码参数、对象大小、分片大小、布局，
+// 以及每个分片和整个对象的 SHA-256 摘要。
+// 恢复时 ObjectSize 可直接作为 Join/StreamJoin 的 outSize 使用。
+// 拆分前经过压缩时，Compression 记录压缩算法，RawSize 记录原始大小，
+// ObjectSize 和 ObjectHash 描述压缩后的数据（以同样记录了这两项的压缩数据头开始）。
+type Manifest struct {
+	Version      int      `json:"version"`               // 清单格式版本
+	Field        int      `json:"field"`                 // 有限域位宽：8 或 16
+	DataShards   int      `json:"data_shards"`           // 数据分片数量
+	ParityShards int      `json:"parity_shards"`         // 奇偶校验分片数量
+	ObjectSize   int64    `json:"object_size"`           // 原始对象大小
+	ShardSize    int64    `json:"shard_size"`            // 每个分片的大小
+	Layout       string   `json:"layout"`                // 分片布局
+	ObjectHash   Digest   `json:"object_hash"`           // 原始对象的摘要
+	ShardHashes  []Digest `json:"shard_hashes"`          // 每个分片的摘要，长度为总分片数
+	Compression  string   `json:"compression,omitempty"` // 压缩算法名称，未压缩时为空
+	RawSize      int64    `json:"raw_size,omitempty"`    // 压缩前的原始大小
+}
+
+// TotalShards 返回清单描述的总分片数量
+func (m *Manifest) TotalShards() int {
+	return m.DataShards + m.ParityShards
+}
+
+// fieldBits 返回编解码器使用的有限域位宽，无法识别时返回0
+func fieldBits(enc ReedSolomon) int {
+	switch enc.(type) {
+	case *rsFF8:
+		return 8
+	case *rsFF16:
+		return 16
+	}
+	return 0
+}
+
+// newManifest 根据编解码器创建一个尚未填充摘要的清单
+func newManifest(enc ReedSolomon, objectSize, shardSize int64, layout string) (*Manifest, error) {
+	field := fieldBits(enc)
+	if field == 0 {
+		return nil, ErrNotSupported
+	}
+	return &Manifest{
+		Version:      ManifestVersion,
+		Field:        field,
+		DataShards:   enc.DataShards(),
+		ParityShards: enc.ParityShards(),
+		ObjectSize:   objectSize,
+		ShardSize:    shardSize,
+		Layout:       layout,
+		ShardHashes:  make([]Digest, enc.TotalShards()),
+	}, nil
+}
+
+// NewManifest 为内存编码的结果创建清单
+// data 是传给 Split 的原始数据，shards 是 Encode 之后的完整分片集
+func NewManifest(enc ReedSolomon, data []byte, shards [][]byte) (*Manifest, error) {
+	if len(shards) != enc.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+	if err := checkShards(shards, false); err != nil {
+		return nil, err
+	}
+
+	m, err := newManifest(enc, int64(len(data)), int64(len(shards[0])), LayoutSplit)
+	if err != nil {
+		return nil, err
+	}
+	m.ObjectHash = sha256.Sum256(data)
+	for i, shard := range shards {
+		m.ShardHashes[i] = sha256.Sum256(shard)
+	}
+	return m, nil
+}
+
+// Validate 检查清单字段是否自洽
+func (m *Manifest) Validate() error {
+	if m.Version != ManifestVersion {
+		return ErrInvalidManifest
+	}
+	if m.Field != 8 && m.Field != 16 {
+		return ErrInvalidManifest
+	}
+	if m.DataShards <= 0 || m.ParityShards <= 0 {
+		return ErrInvalidManifest
+	}
+	if m.Field == 8 && m.TotalShards() > 256 || m.TotalShards() > 65536 {
+		return ErrInvalidManifest
+	}
+	if m.ObjectSize < 0 || m.ShardSize <= 0 || m.ShardSize > maxInt/int64(m.DataShards) {
+		return ErrInvalidManifest
+	}
+	if m.ObjectSize > m.ShardSize*int64(m.DataShards) {
+		return ErrInvalidManifest
+	}
+	if m.Layout != LayoutSplit && m.Layout != LayoutStream {
+		return ErrInvalidManifest
+	}
+	// StreamSplit 输出的分片按64字节对齐，最后一个数据分片不会长于其他分片
+	if m.Layout == LayoutStream && (m.ShardSize%64 != 0 || m.ShardLen(m.DataShards-1) > m.ShardSize) {
+		return ErrInvalidManifest
+	}
+	if len(m.ShardHashes) != m.TotalShards() {
+		return ErrInvalidManifest
+	}
+	if m.Compression == "" && m.RawSize != 0 || len(m.Compression) > 255 || m.RawSize < 0 {
+		return ErrInvalidManifest
+	}
+	return nil
+}
+
+// Check 检查编解码器参数是否与清单一致
+func (m *Manifest) Check(enc ReedSolomon) error {
+	if enc.DataShards() != m.DataShards || enc.ParityShards() != m.ParityShards {
+		return ErrInvShardNum
+	}
+	if fieldBits(enc) != m.Field {
+		return ErrInvalidManifest
+	}
+	return nil
+}
+
+// NewEncoder 创建与清单参数一致的编解码器
+func (m *Manifest) NewEncoder(opts ...Option) (ReedSolomon, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if m.Field == 8 {
+		return New8(m.DataShards, m.ParityShards, opts...)
+	}
+	return New16(m.DataShards, m.ParityShards, opts...)
+}
+
+// ShardLen 返回第 idx 个分片在存储中的实际长度
+// LayoutStream 布局下最后一个数据分片可能短于 ShardSize，其余分片都等于 ShardSize。
+func (m *Manifest) ShardLen(idx int) int64 {
+	if m.Layout != LayoutStream || idx != m.DataShards-1 || m.DataShards == 1 || m.ShardSize <= 0 {
+		return m.ShardSize
+	}
+	// StreamSplit 按顺序填充数据分片，数据在倒数第二个分片之前耗尽时剩余分片都补零到 ShardSize
+	k := int64(m.DataShards)
+	if used := (m.ObjectSize + m.ShardSize - 1) / m.ShardSize; used < k-1 {
+		return m.ShardSize
+	}
+	last := m.ObjectSize - m.ShardSize*(k-1)
+	if last <= 0 {
+		last = 1
+	}
+	return ((last + 63) / 64) * 64
+}
+
+// shardMatches 检查分片内容是否与清单一致
+// 允许把较短的分片补零到 ShardSize 后再参与内存重建
+func (m *Manifest) shardMatches(idx int, shard []byte) bool {
+	n := m.ShardLen(idx)
+	if int64(len(shard)) != n && int64(len(shard)) != m.ShardSize || n > int64(len(shard)) {
+		return false
+	}
+	if !isZero(shard[n:]) {
+		return false
+	}
+	return sha256.Sum256(shard[:n]) == m.ShardHashes[idx]
+}
+
+// ValidateShards 在 Reconstruct 之前根据清单检查分片
+// 分片长度应为 ShardLen(i)，或补零到 ShardSize；大小或摘要不匹配的分片会被置为nil，
+// 从而在重建时被视为丢失。返回被剔除的分片索引。
+// 如果剩余可信分片不足以重建，返回 ErrTooFewShards；清单本身无效时返回 ErrInvalidManifest。
+func (m *Manifest) ValidateShards(shards [][]byte) ([]int, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if len(shards) != m.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+
+	var bad []int
+	present := 0
+	for i, shard := range shards {
+		if len(shard) == 0 {
+			continue
+		}
+		if !m.shardMatches(i, shard) {
+			shards[i] = nil
+			bad = append(bad, i)
+			continue
+		}
+		present++
+	}
+	if present < m.DataShards {
+		return bad, ErrTooFewShards
+	}
+	return bad, nil
+}
+
+// CheckShard 以流式方式读取第 idx 个分片并与清单中的摘要比较
+func (m *Manifest) CheckShard(idx int, r io.Reader) error {
+	if idx < 0 || idx >= len(m.ShardHashes) {
+		return ErrInvalidShards
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return StreamReadError{Err: err, Stream: idx}
+	}
+	if n != m.ShardLen(idx) || !bytes.Equal(h.Sum(nil), m.ShardHashes[idx][:]) {
+		return ErrShardHashMismatch
+	}
+	return nil
+}
+
+// CheckObject 比较恢复出的对象与清单中的对象摘要
+func (m *Manifest) CheckObject(data []byte) error {
+	if int64(len(data)) != m.ObjectSize || sha256.Sum256(data) != m.ObjectHash {
+		return ErrShardHashMismatch
+	}
+	return nil
+}
+
+// MarshalJSON 以 JSON 编码清单
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	type plain Manifest
+	return json.Marshal((*plain)(m))
+}
+
+// UnmarshalJSON 解码 JSON 清单并检查其有效性
+func (m *Manifest) UnmarshalJSON(b []byte) error {
+	type plain Manifest
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	if err := (*Manifest)(&p).Validate(); err != nil {
+		return err
+	}
+	*m = Manifest(p)
+	return nil
+}
+
+// MarshalBinary 以紧凑的二进制格式编码清单
+//
+// 格式: magic(4) | version(1) | field(1) | layout(1) | uvarint(dataShards) | uvarint(parityShards) |
+// uvarint(objectSize) | uvarint(shardSize) | objectHash(32) | shardHashes(32*总分片数)
+//
+// 压缩的对象在末尾追加: len(compression)(1) | compression | uvarint(rawSize)
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	layout := 0
+	for i, l := range layoutCodes {
+		if l == m.Layout {
+			layout = i
+		}
+	}
+
+	b := make([]byte, 0, 7+4*binary.MaxVarintLen64+sha256.Size*(1+len(m.ShardHashes)))
+	b = append(b, manifestMagic[:]...)
+	b = append(b, byte(m.Version), byte(m.Field), byte(layout))
+	b = binary.AppendUvarint(b, uint64(m.DataShards))
+	b = binary.AppendUvarint(b, uint64(m.ParityShards))
+	b = binary.AppendUvarint(b, uint64(m.ObjectSize))
+	b = binary.AppendUvarint(b, uint64(m.ShardSize))
+	b = append(b, m.ObjectHash[:]...)
+	for _, h := range m.ShardHashes {
+		b = append(b, h[:]...)
+	}
+	if m.Compression != "" {
+		b = append(b, byte(len(m.Compression)))
+		b = append(b, m.Compression...)
+		b = binary.AppendUvarint(b, uint64(m.RawSize))
+	}
+	return b, nil
+}
+
+// UnmarshalBinary 解码 MarshalBinary 生成的数据
+func (m *Manifest) UnmarshalBinary(b []byte) error {
+	if len(b) < 7 || !bytes.Equal(b[:4], manifestMagic[:]) {
+		return ErrInvalidManifest
+	}
+	var p Manifest
+	p.Version = int(b[4])
+	p.Field = int(b[5])
+	if int(b[6]) >= len(layoutCodes) {
+		return ErrInvalidManifest
+	}
+	p.Layout = layoutCodes[b[6]]
+	b = b[7:]
+
+	var vals [4]uint64
+	for i := range vals {
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v > maxInt {
+			return ErrInvalidManifest
+		}
+		vals[i] = v
+		b = b[n:]
+	}
+	p.DataShards = int(vals[0])
+	p.ParityShards = int(vals[1])
+	p.ObjectSize = int64(vals[2])
+	p.ShardSize = int64(vals[3])
+
+	if p.DataShards > 65536 || p.ParityShards > 65536 {
+		return ErrInvalidManifest
+	}
+	total := p.DataShards + p.ParityShards
+	if len(b) < sha256.Size*(1+total) {
+		return ErrInvalidManifest
+	}
+	copy(p.ObjectHash[:], b)
+	b = b[sha256.Size:]
+	p.ShardHashes = make([]Digest, total)
+	for i := range p.ShardHashes {
+		copy(p.ShardHashes[i][:], b)
+		b = b[sha256.Size:]
+	}
+	if len(b) > 0 {
+		n := int(b[0])
+		if n == 0 || len(b) < 1+n {
+			return ErrInvalidManifest
+		}
+		p.Compression = string(b[1 : 1+n])
+		v, vn := binary.Uvarint(b[1+n:])
+		if vn <= 0 || v > maxInt || 1+n+vn != len(b) {
+			return ErrInvalidManifest
+		}
+		p.RawSize = int64(v)
+	}
+
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	*m = p
+	return nil
+}
+
+// ManifestBuilder 在流式拆分和编码过程中计算摘要并生成清单
+//
+// 用法：
+//
+//	b, _ := NewManifestBuilder(enc, size)
+//	enc.StreamSplit(b.Object(data), b.DataWriters(dataOut), size)
+//	enc.StreamEncode(dataIn, b.ParityWriters(parityOut))
+//	m, _ := b.Manifest()
+type ManifestBuilder struct {
+	m      *Manifest
+	object hash.Hash
+	read   int64
+	shards []*hashWriter
+}
+
+// hashWriter 在写入的同时计算摘要和长度
+type hashWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+// Write 实现 io.Writer
+func (w *hashWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.h.Write(p[:n])
+	w.n += int64(n)
+	return n, err
+}
+
+// NewManifestBuilder 为大小为 size 的对象创建清单构建器，布局为 LayoutStream
+func NewManifestBuilder(enc ReedSolomon, size int64) (*ManifestBuilder, error) {
+	if size <= 0 {
+		return nil, ErrSize
+	}
+	m, err := newManifest(enc, size, 0, LayoutStream)
+	if err != nil {
+		return nil, err
+	}
+	return &ManifestBuilder{
+		m:      m,
+		object: sha256.New(),
+		shards: make([]*hashWriter, enc.TotalShards()),
+	}, nil
+}
+
+// Object 包装原始数据读取器，在读取过程中计算对象摘要
+func (b *ManifestBuilder) Object(r io.Reader) io.Reader {
+	return &objectHashReader{r: r, b: b}
+}
+
+// objectHashReader 在读取的同时更新对象摘要
+type objectHashReader struct {
+	r io.Reader
+	b *ManifestBuilder
+}
+
+// Read 实现 io.Reader
+func (r *objectHashReader) Read(p []byte) (int, error) {
+	// 只统计对象范围内的字节，StreamSplit 不会读取超出 size 的部分
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.b.object.Write(p[:n])
+		r.b.read += int64(n)
+	}
+	return n, err
+}
+
+// DataWriters 包装数据分片写入器
+func (b *ManifestBuilder) DataWriters(dst []io.Writer) []io.Writer {
+	return b.wrap(dst, 0)
+}
+
+// ParityWriters 包装奇偶校验分片写入器
+func (b *ManifestBuilder) ParityWriters(dst []io.Writer) []io.Writer {
+	return b.wrap(dst, b.m.DataShards)
+}
+
+// wrap 从 first 开始包装一组分片写入器
+func (b *ManifestBuilder) wrap(dst []io.Writer, first int) []io.Writer {
+	out := make([]io.Writer, len(dst))
+	for i, w := range dst {
+		if w == nil || first+i >= len(b.shards) {
+			continue
+		}
+		hw := &hashWriter{w: w, h: sha256.New()}
+		b.shards[first+i] = hw
+		out[i] = hw
+	}
+	return out
+}
+
+// Manifest 返回构建完成的清单
+// 所有分片都必须已经写入，且长度符合 StreamSplit/StreamEncode 的输出
+func (b *ManifestBuilder) Manifest() (*Manifest, error) {
+	if b.read != b.m.ObjectSize {
+		return nil, ErrShortData
+	}
+	if b.shards[0] == nil {
+		return nil, ErrTooFewShards
+	}
+	m := *b.m
+	m.ShardSize = b.shards[0].n
+	m.ShardHashes = make([]Digest, len(b.shards))
+	b.object.Sum(m.ObjectHash[:0])
+	for i, hw := range b.shards {
+		if hw == nil {
+			return nil, ErrTooFewShards
+		}
+		if hw.n != m.ShardLen(i) {
+			return nil, ErrShardSize
+		}
+		hw.h.Sum(m.ShardHashes[i][:0])
+	}
+	return &m, nil
+}
@@ -0,0 +1,238 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// 测试内存编码生成清单、序列化以及重建前的分片校验
+func TestManifest(t *testing.T) {
+	testManifest(t, 10, 4, 100000, false)
+	testManifest(t, 10, 4, 100000, true)
+	testManifest(t, 200, 100, 50000, true)
+	testManifestInvalid(t)
+}
+
+// 字段不自洽的清单应被拒绝，且校验分片时不能崩溃
+func testManifestInvalid(t *testing.T) {
+	manifests := []Manifest{
+		// 最后一个数据分片的长度超过 ShardSize
+		{Field: 8, DataShards: 2, ParityShards: 1, Layout: LayoutStream, ShardSize: 10, ObjectSize: 20},
+		// ShardSize 不是64的倍数
+		{Field: 8, DataShards: 2, ParityShards: 1, Layout: LayoutStream, ShardSize: 100, ObjectSize: 150},
+		// 分片大小为0
+		{Field: 8, DataShards: 2, ParityShards: 1, Layout: LayoutStream, ShardSize: 0, ObjectSize: 0},
+		{Field: 16, DataShards: 2, ParityShards: 1, Layout: LayoutSplit, ShardSize: 0, ObjectSize: 0},
+		// ShardSize*DataShards 溢出
+		{Field: 16, DataShards: 4, ParityShards: 1, Layout: LayoutSplit, ShardSize: maxInt / 2, ObjectSize: 1},
+	}
+	for i := range manifests {
+		m := &manifests[i]
+		m.Version = ManifestVersion
+		m.ShardHashes = make([]Digest, m.TotalShards())
+		if err := m.Validate(); err != ErrInvalidManifest {
+			t.Errorf("清单 %d: 期望 ErrInvalidManifest，实际 %v", i, err)
+		}
+		shards := make([][]byte, m.TotalShards())
+		for j := range shards {
+			shards[j] = make([]byte, 10)
+		}
+		if _, err := m.ValidateShards(shards); err != ErrInvalidManifest {
+			t.Errorf("清单 %d: 期望 ErrInvalidManifest，实际 %v", i, err)
+		}
+		if _, err := m.NewEncoder(); err != ErrInvalidManifest {
+			t.Errorf("清单 %d: 期望 ErrInvalidManifest，实际 %v", i, err)
+		}
+		// 绕过 Validate 直接比较分片也不能越界
+		for j := range shards {
+			if m.shardMatches(j, shards[j]) {
+				t.Errorf("清单 %d: 分片 %d 不应匹配", i, j)
+			}
+		}
+	}
+}
+
+func testManifest(t *testing.T, dataShards, parityShards, dataSize int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, dataSize)
+	rand.New(rand.NewSource(int64(dataSize))).Read(data)
+
+	shards, err := enc.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManifest(enc, data, shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(enc); err != nil {
+		t.Fatal(err)
+	}
+
+	// JSON 和二进制编码都应能无损往返
+	js, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON Manifest
+	if err := json.Unmarshal(js, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	bin, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromBin Manifest
+	if err := fromBin.UnmarshalBinary(bin); err != nil {
+		t.Fatal(err)
+	}
+	if len(bin) >= len(js) {
+		t.Errorf("二进制编码 (%d 字节) 应比 JSON (%d 字节) 更紧凑", len(bin), len(js))
+	}
+	for _, got := range []*Manifest{&fromJSON, &fromBin} {
+		if got.Field != m.Field || got.ObjectSize != m.ObjectSize || got.ShardSize != m.ShardSize ||
+			got.ObjectHash != m.ObjectHash || len(got.ShardHashes) != len(m.ShardHashes) {
+			t.Fatalf("往返后清单不一致: %+v", got)
+		}
+		for i := range m.ShardHashes {
+			if got.ShardHashes[i] != m.ShardHashes[i] {
+				t.Fatalf("分片 %d 摘要不一致", i)
+			}
+		}
+	}
+
+	// 损坏一个分片、丢失一个分片，校验应剔除损坏的分片
+	shards[1][7] ^= 0xff
+	shards[dataShards] = nil
+	bad, err := fromBin.ValidateShards(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bad) != 1 || bad[0] != 1 || shards[1] != nil {
+		t.Fatalf("期望剔除分片 1，实际 %v", bad)
+	}
+
+	re, err := fromBin.NewEncoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := re.Reconstruct(shards); err != nil {
+		t.Fatal(err)
+	}
+	if bad, err := fromBin.ValidateShards(shards); err != nil || len(bad) != 0 {
+		t.Fatalf("重建后的分片应全部可信: %v %v", bad, err)
+	}
+
+	var out bytes.Buffer
+	if err := re.Join(&out, shards, int(fromBin.ObjectSize)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fromBin.CheckObject(out.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 损坏过多分片时应报告无法重建
+	for i := 0; i <= parityShards; i++ {
+		shards[i][0] ^= 1
+	}
+	if _, err := fromBin.ValidateShards(shards); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
+
+// 测试在流式拆分和编码过程中构建清单
+func TestManifestBuilder(t *testing.T) {
+	for _, useFF16 := range []bool{false, true} {
+		// 1100 字节拆成4片时最后一个数据分片短于其他分片
+		for _, size := range []int{100, 1100, 300000} {
+			testManifestBuilder(t, 4, 2, size, useFF16)
+		}
+	}
+	// 分片很多时数据可能在最后一个数据分片之前耗尽
+	testManifestBuilder(t, 200, 60, 300000, true)
+}
+
+func testManifestBuilder(t *testing.T, dataShards, parityShards, dataSize int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, dataSize)
+	rand.New(rand.NewSource(int64(dataSize))).Read(data)
+
+	b, err := NewManifestBuilder(enc, int64(dataSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bufs := make([]bytes.Buffer, enc.TotalShards())
+	writers := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		writers[i] = &bufs[i]
+	}
+	if err := enc.StreamSplit(b.Object(bytes.NewReader(data)), b.DataWriters(writers[:dataShards]), int64(dataSize)); err != nil {
+		t.Fatal(err)
+	}
+	readers := make([]io.Reader, dataShards)
+	for i := range readers {
+		readers[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	if err := enc.StreamEncode(readers, b.ParityWriters(writers[dataShards:])); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := b.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Layout != LayoutStream || m.ObjectSize != int64(dataSize) {
+		t.Fatalf("清单字段错误: %+v", m)
+	}
+	for i := range bufs {
+		if err := m.CheckShard(i, bytes.NewReader(bufs[i].Bytes())); err != nil {
+			t.Fatalf("分片 %d: %v", i, err)
+		}
+	}
+
+	corrupt := append([]byte{}, bufs[0].Bytes()...)
+	corrupt[0] ^= 1
+	if err := m.CheckShard(0, bytes.NewReader(corrupt)); err != ErrShardHashMismatch {
+		t.Fatalf("期望 ErrShardHashMismatch，实际 %v", err)
+	}
+
+	readers = make([]io.Reader, dataShards)
+	for i := range readers {
+		readers[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	var out bytes.Buffer
+	if err := enc.StreamJoin(&out, readers, m.ObjectSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CheckObject(out.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
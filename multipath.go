@@ -0,0 +1,755 @@
+/**
+ * Reed-Solomon 编码库 - 多路径传输
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 多路径传输的帧格式，每条连接上是一串帧，所有整数为大端序:
+//
+//	version(1) | kind(1) | field(1) | stripe(8) | index(2) | k(2) | m(2) | size(8) | length(4) | 负载(length)
+//
+// field 是有限域位宽（8 或 16）。分片帧的 size 是条带的原始数据大小，负载是条带的第 index 个分片；
+// 结束帧的 stripe 是条带总数，size 是数据总大小，没有负载。
+const (
+	multipathVersion   = 1
+	multipathHeaderLen = 29
+	multipathShard     = 1
+	multipathEnd       = 2
+
+	// multipathWindow 是接收端在下一个输出的条带之后最多缓存的条带数，
+	// 送来更靠后的条带的连接暂停读取，直到窗口前移
+	multipathWindow = 16
+
+	// DefaultStripeSize 是多路径传输默认的条带大小
+	DefaultStripeSize = 1 << 20
+)
+
+// multipathHeader 是多路径传输的帧头
+type multipathHeader struct {
+	kind   byte
+	field  int
+	stripe uint64
+	index  int
+	k, m   int
+	size   int64
+	length int
+}
+
+// appendFrame 把帧头和负载编码为一帧
+func (h *multipathHeader) appendFrame(b, payload []byte) []byte {
+	b = append(b, multipathVersion, h.kind, byte(h.field))
+	b = binary.BigEndian.AppendUint64(b, h.stripe)
+	b = binary.BigEndian.AppendUint16(b, uint16(h.index))
+	b = binary.BigEndian.AppendUint16(b, uint16(h.k))
+	b = binary.BigEndian.AppendUint16(b, uint16(h.m))
+	b = binary.BigEndian.AppendUint64(b, uint64(h.size))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(payload)))
+	return append(b, payload...)
+}
+
+// stripeShardLen 返回原始大小为 size 的条带编码后每个分片的长度
+// 条带补零到 k 个 64 字节（两种有限域的 ShardSizeMultiple）的整数倍，至少一个。
+func stripeShardLen(k int, size int64) int {
+	unit := int64(64 * k)
+	return int(max((size+unit-1)/unit*unit, unit) / int64(k))
+}
+
+// readMultipathFrame 读取一帧，连接在帧边界处结束时返回 io.EOF
+// 分片帧的条带大小不能超过 maxStripe，分片长度必须与条带大小相符，因此负载不超过 maxStripe/k 左右。
+func readMultipathFrame(r io.Reader, maxStripe int64) (*multipathHeader, []byte, error) {
+	var b [multipathHeaderLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return nil, nil, err
+	}
+	h := &multipathHeader{
+		kind:   b[1],
+		field:  int(b[2]),
+		stripe: binary.BigEndian.Uint64(b[3:]),
+		index:  int(binary.BigEndian.Uint16(b[11:])),
+		k:      int(binary.BigEndian.Uint16(b[13:])),
+		m:      int(binary.BigEndian.Uint16(b[15:])),
+		size:   int64(binary.BigEndian.Uint64(b[17:])),
+		length: int(binary.BigEndian.Uint32(b[25:])),
+	}
+	if b[0] != multipathVersion || h.k == 0 || h.m == 0 || h.k+h.m > 65536 ||
+		h.field != 8 && h.field != 16 || h.field == 8 && h.k+h.m > 256 {
+		return nil, nil, ErrMultipathFrame
+	}
+	switch h.kind {
+	case multipathShard:
+		if h.index >= h.k+h.m || h.size <= 0 || h.size > maxStripe || h.length != stripeShardLen(h.k, h.size) {
+			return nil, nil, ErrMultipathFrame
+		}
+	case multipathEnd:
+		if h.index != 0 || h.length != 0 || h.size < 0 {
+			return nil, nil, ErrMultipathFrame
+		}
+	default:
+		return nil, nil, ErrMultipathFrame
+	}
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return h, payload, nil
+}
+
+// MultipathOptions 配置多路径发送和接收，接收端只使用 StripeSize
+type MultipathOptions struct {
+	StripeSize   int64         // 每个条带的原始数据大小，默认 DefaultStripeSize；接收端的值不能小于发送端
+	QueueSize    int           // 每条连接最多排队的帧数，默认可容纳两个条带
+	WriteTimeout time.Duration // 写入一帧的超时时间，超时的连接视为失效，0 表示不超时
+}
+
+// PathStats 是一条连接的传输统计
+type PathStats struct {
+	Shards  int64 // 发送或收到的分片帧数量
+	Skipped int64 // 发送端因队列已满而跳过的分片帧数量
+	Err     error // 连接失效的原因，正常结束为nil
+}
+
+// MultipathStats 是多路径传输的统计
+type MultipathStats struct {
+	Stripes int64       // 条带数量
+	Bytes   int64       // 原始数据大小
+	Rebuilt int64       // 接收端需要重建数据分片的条带数量
+	Paths   []PathStats // 每条连接的统计，顺序与 conns 一致
+}
+
+// sendTracker 记录各条连接实际写出的分片，用于判断每个条带是否已送出 k 个分片
+type sendTracker struct {
+	mu      sync.Mutex
+	k       int
+	written map[uint64]int // base 之后的条带已写出的分片数量
+	base    uint64         // 此前的条带都已写出至少 k 个分片
+	ended   bool           // 结束帧已写出
+	notify  chan struct{}  // 队列腾出空间、写入完成或协程结束时发出信号
+}
+
+// signal 唤醒等待发送进度的协程
+func (t *sendTracker) signal() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+// wrote 记录一帧已写出
+func (t *sendTracker) wrote(f []byte) {
+	t.mu.Lock()
+	if f[1] == multipathEnd {
+		t.ended = true
+	} else if s := binary.BigEndian.Uint64(f[3:]); s >= t.base {
+		t.written[s]++
+		for t.written[t.base] >= t.k {
+			delete(t.written, t.base)
+			t.base++
+		}
+	}
+	t.mu.Unlock()
+	t.signal()
+}
+
+// covered 返回前 stripes 个条带是否都已写出 k 个分片
+func (t *sendTracker) covered(stripes uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.base >= stripes
+}
+
+// endWritten 返回结束帧是否已写出
+func (t *sendTracker) endWritten() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ended
+}
+
+// sendPath 是发送端的一条连接，由独立的协程按顺序写入队列中的帧
+type sendPath struct {
+	conn    net.Conn
+	timeout time.Duration
+	tracker *sendTracker
+	queue   chan []byte
+	dead    chan struct{} // 连接失效时关闭
+	done    chan struct{} // 协程结束时关闭
+	abort   chan struct{} // 要求协程放弃剩余的帧时关闭
+	reason  error         // 放弃的原因，在关闭 abort 之前设置
+	lagging bool          // 曾因队列已满被跳过，只由发送协程访问
+	shards  int64
+	skipped int64
+	err     error
+}
+
+// run 写入队列中的帧直到队列关闭；写入失败或被中断后关闭连接并丢弃其余的帧
+func (p *sendPath) run() {
+	defer func() {
+		close(p.done)
+		p.tracker.signal()
+	}()
+	for f := range p.queue {
+		// 队列腾出了空间
+		p.tracker.signal()
+		if p.err != nil {
+			continue
+		}
+		select {
+		case <-p.abort:
+			p.fail(p.reason)
+			continue
+		default:
+		}
+		if p.timeout > 0 {
+			p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+		}
+		if _, err := p.conn.Write(f); err != nil {
+			select {
+			case <-p.abort:
+				err = p.reason
+			default:
+			}
+			// 可能只写入了半帧，连接不能再使用
+			p.fail(err)
+			continue
+		}
+		if f[1] == multipathShard {
+			p.shards++
+		}
+		p.tracker.wrote(f)
+	}
+}
+
+// fail 把连接标记为失效并关闭连接
+func (p *sendPath) fail(err error) {
+	p.err = err
+	p.conn.Close()
+	close(p.dead)
+	p.tracker.signal()
+}
+
+// interrupt 要求协程放弃剩余的帧，并中断阻塞中的写入
+func (p *sendPath) interrupt(reason error) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.reason = reason
+	close(p.abort)
+	p.conn.SetWriteDeadline(time.Now())
+}
+
+// finished 返回写入协程是否已结束
+func (p *sendPath) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// 放入队列的结果
+const (
+	putQueued = iota // 已放入队列
+	putFull          // 队列已满
+	putDead          // 连接已失效
+)
+
+// tryPut 尝试不阻塞地把帧放入队列
+func (p *sendPath) tryPut(f []byte) int {
+	select {
+	case <-p.dead:
+		return putDead
+	default:
+	}
+	select {
+	case p.queue <- f:
+		return putQueued
+	default:
+		return putFull
+	}
+}
+
+// SendMultipath 把 r 中的数据经纠删码编码后分散到多条连接上发送，直到 r 结束
+// 数据按 StripeSize 切成条带，每个条带用 StreamSplit 拆分、StreamEncode 编码，
+// 分片 i 经 conns[i%len(conns)] 发送。每条连接由独立的协程写入，写入失败或超过 WriteTimeout
+// 的连接被关闭，其余连接继续发送；某个条带送出的分片少于 k 个时返回 ErrTooFewShards。
+// 某条连接的队列已满而其余连接已经承载了条带的 k 个分片时，跳过该连接而不等待，
+// 因此即使 WriteTimeout 为 0，停滞的连接也不会阻塞传输。最后在每条连接上发送结束帧；
+// 所有条带都已写出 k 个分片后，被跳过过且仍未写完的连接被中断，其错误为 ErrPathStalled。
+// 连接由调用方关闭。
+func SendMultipath(ctx context.Context, enc ReedSolomon, r io.Reader, conns []net.Conn, opts MultipathOptions) (MultipathStats, error) {
+	if len(conns) == 0 {
+		return MultipathStats{}, ErrInvalidInput
+	}
+	if fieldBits(enc) == 0 {
+		return MultipathStats{}, ErrNotSupported
+	}
+	if opts.StripeSize <= 0 {
+		opts.StripeSize = DefaultStripeSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2*((enc.TotalShards()+len(conns)-1)/len(conns)) + 1
+	}
+
+	tracker := &sendTracker{k: enc.DataShards(), written: make(map[uint64]int), notify: make(chan struct{}, 1)}
+	paths := make([]*sendPath, len(conns))
+	for i, c := range conns {
+		paths[i] = &sendPath{
+			conn:    c,
+			timeout: opts.WriteTimeout,
+			tracker: tracker,
+			queue:   make(chan []byte, opts.QueueSize),
+			dead:    make(chan struct{}),
+			done:    make(chan struct{}),
+			abort:   make(chan struct{}),
+		}
+		go paths[i].run()
+	}
+	// 取消时中断阻塞的写入
+	stop := context.AfterFunc(ctx, func() {
+		for _, c := range conns {
+			c.SetWriteDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	st := MultipathStats{Paths: make([]PathStats, len(conns))}
+	err := sendStripes(ctx, enc, r, paths, opts.StripeSize, &st)
+	for _, p := range paths {
+		close(p.queue)
+		if err != nil {
+			// 传输已经失败，不再等待剩余的帧
+			p.interrupt(err)
+		}
+	}
+	if err == nil {
+		waitPaths(paths, tracker, uint64(st.Stripes))
+	}
+	for i, p := range paths {
+		<-p.done
+		st.Paths[i] = PathStats{Shards: p.shards, Skipped: p.skipped, Err: p.err}
+	}
+	// 放入队列的帧可能因连接随后失效而没有写出
+	if err == nil && (!tracker.covered(uint64(st.Stripes)) || !tracker.endWritten()) {
+		err = ErrTooFewShards
+	}
+	return st, err
+}
+
+// waitPaths 等待各连接写完队列中的帧
+// 所有条带都已写出 k 个分片、且未被跳过的连接都已写完后，中断仍在写入的落后连接。
+func waitPaths(paths []*sendPath, tracker *sendTracker, stripes uint64) {
+	for {
+		pending, lagging := 0, 0
+		for _, p := range paths {
+			if !p.finished() {
+				pending++
+				if p.lagging {
+					lagging++
+				}
+			}
+		}
+		if pending == 0 {
+			return
+		}
+		if pending == lagging && tracker.covered(stripes) && tracker.endWritten() {
+			for _, p := range paths {
+				p.interrupt(ErrPathStalled)
+			}
+			return
+		}
+		<-tracker.notify
+	}
+}
+
+// sendStripes 逐个条带编码并把分片放入各连接的队列，最后放入结束帧
+func sendStripes(ctx context.Context, enc ReedSolomon, r io.Reader, paths []*sendPath, stripeSize int64, st *MultipathStats) error {
+	k, m, field := enc.DataShards(), enc.ParityShards(), fieldBits(enc)
+	buf := make([]byte, stripeSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		shards, err := encodeStripe(enc, buf[:n])
+		if err != nil {
+			return err
+		}
+		frames := make([][]byte, len(shards))
+		for i, s := range shards {
+			h := multipathHeader{kind: multipathShard, field: field, stripe: uint64(st.Stripes), index: i, k: k, m: m, size: int64(n)}
+			frames[i] = h.appendFrame(make([]byte, 0, multipathHeaderLen+len(s)), s)
+		}
+		stripe := uint64(st.Stripes)
+		sent, err := putFrames(ctx, paths, frames, func() bool { return paths[0].tracker.covered(stripe + 1) })
+		if err != nil {
+			return err
+		}
+		if sent < k {
+			return ErrTooFewShards
+		}
+		st.Stripes++
+		st.Bytes += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+
+	h := multipathHeader{kind: multipathEnd, field: field, stripe: uint64(st.Stripes), k: k, m: m, size: st.Bytes}
+	end := h.appendFrame(nil, nil)
+	frames := make([][]byte, len(paths))
+	for i := range frames {
+		frames[i] = end
+	}
+	_, err := putFrames(ctx, paths, frames, paths[0].tracker.endWritten)
+	return err
+}
+
+// putFrames 把 frames[i] 放入 paths[i%len(paths)] 的队列，返回放入的帧数
+// 队列已满的连接会等待腾出空间，直到 enough 报告其余连接已经写出了足够的帧，
+// 此后仍然已满的连接被跳过并标记为落后。
+func putFrames(ctx context.Context, paths []*sendPath, frames [][]byte, enough func() bool) (int, error) {
+	sent := 0
+	var full []int
+	for i, f := range frames {
+		switch paths[i%len(paths)].tryPut(f) {
+		case putQueued:
+			sent++
+		case putFull:
+			full = append(full, i)
+		}
+	}
+	for len(full) > 0 && !enough() {
+		select {
+		case <-paths[0].tracker.notify:
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		}
+		rest := full[:0]
+		for _, i := range full {
+			switch paths[i%len(paths)].tryPut(frames[i]) {
+			case putQueued:
+				sent++
+			case putFull:
+				rest = append(rest, i)
+			}
+		}
+		full = rest
+	}
+	for _, i := range full {
+		p := paths[i%len(paths)]
+		p.lagging = true
+		if frames[i][1] == multipathShard {
+			p.skipped++
+		}
+	}
+	return sent, nil
+}
+
+// encodeStripe 用 StreamSplit 和 StreamEncode 把一个条带编码为等长的分片
+// 条带先补零到 k 个对齐单位的整数倍，使 StreamSplit 输出的数据分片长度相同，
+// 接收端按条带的原始大小 StreamJoin 时丢弃补零。
+func encodeStripe(enc ReedSolomon, data []byte) ([][]byte, error) {
+	k, n := enc.DataShards(), enc.TotalShards()
+	size := int64(stripeShardLen(k, int64(len(data)))) * int64(k)
+	padded := io.MultiReader(bytes.NewReader(data), io.LimitReader(zeroReader{}, size-int64(len(data))))
+
+	bufs := make([]bytes.Buffer, n)
+	dst := make([]io.Writer, k)
+	for i := range dst {
+		dst[i] = &bufs[i]
+	}
+	if err := enc.StreamSplit(padded, dst, size); err != nil {
+		return nil, err
+	}
+	in := make([]io.Reader, k)
+	for i := range in {
+		in[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	out := make([]io.Writer, n-k)
+	for i := range out {
+		out[i] = &bufs[k+i]
+	}
+	if err := enc.StreamEncode(in, out); err != nil {
+		return nil, err
+	}
+
+	shards := make([][]byte, n)
+	for i := range shards {
+		shards[i] = bufs[i].Bytes()
+		if int64(len(shards[i]))*int64(k) != size {
+			return nil, ErrShardSize
+		}
+	}
+	return shards, nil
+}
+
+// pathFrame 是接收协程从一条连接读到的帧
+type pathFrame struct {
+	path    int
+	h       *multipathHeader
+	payload []byte
+	err     error // 连接读取结束的原因，在帧边界处正常结束为 io.EOF
+}
+
+// readPath 读取一条连接上的帧并交给接收端，直到连接结束、出错或 stop 关闭
+// 每交出一帧后等待 resume 再读取下一帧，接收端借此暂停读取送来靠后条带的连接。
+func readPath(i int, c net.Conn, maxStripe int64, out chan<- pathFrame, resume, stop <-chan struct{}) {
+	br := bufio.NewReader(c)
+	for {
+		h, payload, err := readMultipathFrame(br, maxStripe)
+		select {
+		case out <- pathFrame{path: i, h: h, payload: payload, err: err}:
+		case <-stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+		select {
+		case <-resume:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// recvStripe 是接收端正在收集的条带
+type recvStripe struct {
+	size   int64
+	length int
+	shards [][]byte
+	have   int
+}
+
+// decode 重建缺少的数据分片并输出条带的原始数据，返回是否进行了重建
+func (s *recvStripe) decode(enc ReedSolomon, w io.Writer) (bool, error) {
+	k, n := enc.DataShards(), enc.TotalShards()
+	inputs := make([]io.Reader, n)
+	outputs := make([]io.Writer, n)
+	bufs := make([]bytes.Buffer, k)
+	rebuilt := false
+	used := 0
+	// 数据分片排在前面，因此已有的数据分片都会作为输入
+	for i, p := range s.shards {
+		if p != nil && used < k {
+			inputs[i] = bytes.NewReader(p)
+			used++
+		}
+	}
+	for i := 0; i < k; i++ {
+		if s.shards[i] == nil {
+			outputs[i] = &bufs[i]
+			rebuilt = true
+		}
+	}
+	if rebuilt {
+		if err := enc.StreamReconstructData(inputs, outputs); err != nil {
+			return false, err
+		}
+		for i := 0; i < k; i++ {
+			if s.shards[i] == nil {
+				if bufs[i].Len() != s.length {
+					return false, ErrShardSize
+				}
+				s.shards[i] = bufs[i].Bytes()
+			}
+		}
+	}
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		readers[i] = bytes.NewReader(s.shards[i])
+	}
+	return rebuilt, enc.StreamJoin(w, readers, s.size)
+}
+
+// ReceiveMultipath 从多条连接接收 SendMultipath 发送的数据并按顺序写入 w
+// 有限域和分片数量来自帧头，codec 用于创建解码器；opts.StripeSize 限制接受的条带大小，
+// 默认 DefaultStripeSize，不能小于发送端的值。每个条带收到任意 k 个分片后立即用 StreamReconstructData
+// 重建缺少的数据分片并用 StreamJoin 输出，之后到达的分片被丢弃；因此停滞的连接不会拖慢接收。
+// 下一个输出的条带之后最多缓存 16 个条带，送来更靠后条带的连接暂停读取。
+// 断开或发送无效帧的连接被忽略，收到结束帧且所有条带都已输出后返回。其余连接都已结束或暂停时
+// 仍有条带缺少分片返回 ErrTooFewShards，所有连接都结束而没有收到结束帧返回 io.ErrUnexpectedEOF。
+// 接收期间由 ReceiveMultipath 使用连接的读截止时间：返回前以过去的截止时间中断仍在阻塞的读取，
+// 然后清除截止时间，调用方此前设置的读截止时间不会恢复。返回后连接不应再用于读取，由调用方关闭。
+func ReceiveMultipath(ctx context.Context, w io.Writer, conns []net.Conn, opts MultipathOptions, codec ...Option) (MultipathStats, error) {
+	if len(conns) == 0 {
+		return MultipathStats{}, ErrInvalidInput
+	}
+	if opts.StripeSize <= 0 {
+		opts.StripeSize = DefaultStripeSize
+	}
+	frames := make(chan pathFrame)
+	stop := make(chan struct{})
+	resume := make([]chan struct{}, len(conns))
+	var wg sync.WaitGroup
+	for i, c := range conns {
+		resume[i] = make(chan struct{}, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readPath(i, c, opts.StripeSize, frames, resume[i], stop)
+		}()
+	}
+	defer func() {
+		// 中断仍在阻塞读取的协程
+		close(stop)
+		for _, c := range conns {
+			c.SetReadDeadline(time.Unix(1, 0))
+		}
+		wg.Wait()
+		for _, c := range conns {
+			c.SetReadDeadline(time.Time{})
+		}
+	}()
+
+	st := MultipathStats{Paths: make([]PathStats, len(conns))}
+	var (
+		enc     ReedSolomon
+		stripes = make(map[uint64]*recvStripe)
+		next    uint64 // 下一个输出的条带
+		ended   bool
+		count   uint64 // 条带总数，来自结束帧
+		total   int64
+		failed  = make([]bool, len(conns))
+		alive   = len(conns)                     // 仍在读取的连接，失效的连接不再读取
+		parked  = make([]*pathFrame, len(conns)) // 超出窗口而暂存的帧，其连接暂停读取
+		waiting int                              // 暂存了帧的连接数量
+	)
+	fail := func(i int, err error) {
+		failed[i] = true
+		st.Paths[i].Err = err
+		alive--
+	}
+	// accept 处理一个分片帧或结束帧，帧无效时使连接失效并返回 false
+	accept := func(f pathFrame) bool {
+		h := f.h
+		if enc == nil {
+			var err error
+			if h.field == 8 {
+				enc, err = New8(h.k, h.m, codec...)
+			} else {
+				enc, err = New16(h.k, h.m, codec...)
+			}
+			if err != nil {
+				fail(f.path, err)
+				return false
+			}
+		}
+		if h.field != fieldBits(enc) || h.k != enc.DataShards() || h.m != enc.ParityShards() {
+			fail(f.path, ErrMultipathFrame)
+			return false
+		}
+
+		if h.kind == multipathEnd {
+			if ended && (h.stripe != count || h.size != total) || h.stripe < next {
+				fail(f.path, ErrMultipathFrame)
+				return false
+			}
+			ended, count, total = true, h.stripe, h.size
+			return true
+		}
+		st.Paths[f.path].Shards++
+		if h.stripe < next {
+			// 已经输出的条带
+			return true
+		}
+		s := stripes[h.stripe]
+		if ended && h.stripe >= count || s != nil && (s.size != h.size || s.length != h.length) {
+			fail(f.path, ErrMultipathFrame)
+			return false
+		}
+		if s == nil {
+			s = &recvStripe{size: h.size, length: h.length, shards: make([][]byte, enc.TotalShards())}
+			stripes[h.stripe] = s
+		}
+		if s.shards[h.index] == nil {
+			s.shards[h.index] = f.payload
+			s.have++
+		}
+		return true
+	}
+	for !ended || next < count {
+		if waiting == alive {
+			// 没有连接还能送来下一个条带的分片
+			if ended || waiting > 0 {
+				return st, ErrTooFewShards
+			}
+			return st, io.ErrUnexpectedEOF
+		}
+		var f pathFrame
+		select {
+		case <-ctx.Done():
+			return st, ctx.Err()
+		case f = <-frames:
+		}
+		if f.err != nil {
+			alive--
+			if f.err != io.EOF {
+				failed[f.path] = true
+				st.Paths[f.path].Err = f.err
+			}
+			continue
+		}
+		if f.h.kind == multipathShard && f.h.stripe >= next+multipathWindow {
+			parked[f.path] = &f
+			waiting++
+			continue
+		}
+		if accept(f) {
+			resume[f.path] <- struct{}{}
+		}
+
+		// 按顺序输出已经凑齐 k 个分片的条带，窗口前移后处理暂存的帧
+		for moved := true; moved && enc != nil; {
+			moved = false
+			for s := stripes[next]; s != nil && s.have >= enc.DataShards(); s = stripes[next] {
+				rebuilt, err := s.decode(enc, w)
+				if err != nil {
+					return st, err
+				}
+				if rebuilt {
+					st.Rebuilt++
+				}
+				delete(stripes, next)
+				next++
+				st.Stripes++
+				st.Bytes += s.size
+				moved = true
+			}
+			for i, p := range parked {
+				if p != nil && p.h.stripe < next+multipathWindow {
+					parked[i] = nil
+					waiting--
+					if accept(*p) {
+						resume[i] <- struct{}{}
+					}
+				}
+			}
+		}
+	}
+	if st.Bytes != total {
+		return st, ErrMultipathFrame
+	}
+	return st, nil
+}
@@ -0,0 +1,301 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tcpPaths 在回环地址上建立 n 条 TCP 连接，返回发送端和接收端
+func tcpPaths(t *testing.T, n int) ([]net.Conn, []net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	send := make([]net.Conn, n)
+	recv := make([]net.Conn, n)
+	for i := range send {
+		if send[i], err = net.Dial("tcp", ln.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+		if recv[i], err = ln.Accept(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for i := range send {
+			send[i].Close()
+			recv[i].Close()
+		}
+	})
+	return send, recv
+}
+
+// faultyConn 在写入 after 帧后出错：stall 为真时阻塞到写截止时间，否则直接断开
+type faultyConn struct {
+	net.Conn
+	after int
+	stall bool
+
+	mu       sync.Mutex
+	writes   int
+	deadline time.Time
+}
+
+func (c *faultyConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *faultyConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.writes++
+	n, deadline := c.writes, c.deadline
+	c.mu.Unlock()
+	if n <= c.after {
+		return c.Conn.Write(b)
+	}
+	if !c.stall {
+		c.Conn.Close()
+		return 0, net.ErrClosed
+	}
+	time.Sleep(time.Until(deadline))
+	return 0, os.ErrDeadlineExceeded
+}
+
+// transferMultipath 并发运行发送端和接收端
+func transferMultipath(enc ReedSolomon, data []byte, send, recv []net.Conn, opts MultipathOptions) (MultipathStats, MultipathStats, []byte, error, error) {
+	var out bytes.Buffer
+	var rst MultipathStats
+	var rerr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rst, rerr = ReceiveMultipath(context.Background(), &out, recv, opts)
+		// 接收完成后继续读取剩余的冗余帧，使无缓冲的连接不会阻塞发送端
+		for _, c := range recv {
+			go io.Copy(io.Discard, c)
+		}
+	}()
+	sst, serr := SendMultipath(context.Background(), enc, bytes.NewReader(data), send, opts)
+	if serr != nil {
+		// 发送失败时关闭连接，接收端随之结束
+		for _, c := range send {
+			c.Close()
+		}
+	}
+	<-done
+	return sst, rst, out.Bytes(), serr, rerr
+}
+
+// 测试一条连接断开、另一条连接停滞时仍能完整接收
+func TestMultipath(t *testing.T) {
+	testMultipath(t, 6, 6, false)
+	testMultipath(t, 6, 6, true)
+}
+
+func testMultipath(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 条连接，每条承载每个条带的 3 个分片；失效两条后每个条带仍有 6 个分片
+	send, recv := tcpPaths(t, 4)
+	send[1] = &faultyConn{Conn: send[1], after: 7}
+	send[3] = &faultyConn{Conn: send[3], after: 12, stall: true}
+
+	stripe := int64(64 * dataShards * 4)
+	data := make([]byte, 10*stripe+700)
+	rand.New(rand.NewSource(1)).Read(data)
+	opts := MultipathOptions{StripeSize: stripe, WriteTimeout: 100 * time.Millisecond}
+	sst, rst, got, serr, rerr := transferMultipath(enc, data, send, recv, opts)
+	if serr != nil || rerr != nil {
+		t.Fatalf("发送: %v，接收: %v", serr, rerr)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("接收的数据不一致: %d 字节，期望 %d", len(got), len(data))
+	}
+	if sst.Stripes != 11 || rst.Stripes != 11 || rst.Bytes != int64(len(data)) || rst.Rebuilt == 0 {
+		t.Fatalf("发送统计 %+v，接收统计 %+v", sst, rst)
+	}
+	// 停滞的连接可能先超时，也可能在其余连接送完数据后被中断
+	stalled := sst.Paths[3].Err
+	if sst.Paths[0].Err != nil || sst.Paths[0].Shards != 33 || sst.Paths[1].Err == nil ||
+		!errors.Is(stalled, os.ErrDeadlineExceeded) && stalled != ErrPathStalled {
+		t.Fatalf("发送端连接统计 %+v", sst.Paths)
+	}
+	if rst.Paths[2].Shards == 0 || rst.Paths[2].Err != nil {
+		t.Fatalf("接收端连接统计 %+v", rst.Paths)
+	}
+}
+
+// 测试没有写超时时停滞的连接不会阻塞发送
+func TestMultipathStalled(t *testing.T) {
+	enc, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3 条连接各承载每个条带的 2 个分片，第 3 条连接的对端从不读取
+	send := make([]net.Conn, 3)
+	recv := make([]net.Conn, 3)
+	for i := range send {
+		send[i], recv[i] = net.Pipe()
+		defer send[i].Close()
+		defer recv[i].Close()
+	}
+
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	type result struct {
+		sst, rst   MultipathStats
+		got        []byte
+		serr, rerr error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		r.sst, r.rst, r.got, r.serr, r.rerr = transferMultipath(enc, data, send, recv[:2], MultipathOptions{})
+		done <- r
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("停滞的连接阻塞了发送")
+	}
+	if r.serr != nil || r.rerr != nil {
+		t.Fatalf("发送: %v，接收: %v", r.serr, r.rerr)
+	}
+	if !bytes.Equal(r.got, data) {
+		t.Fatalf("接收的数据不一致: %d 字节，期望 %d", len(r.got), len(data))
+	}
+	if r.sst.Paths[2].Err != ErrPathStalled || r.sst.Paths[2].Skipped == 0 || r.sst.Paths[0].Err != nil || r.sst.Paths[1].Err != nil {
+		t.Fatalf("发送端连接统计 %+v", r.sst.Paths)
+	}
+}
+
+// 测试空数据、失效的连接过多和无效的帧
+func TestMultipathErrors(t *testing.T) {
+	enc, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send, recv := tcpPaths(t, 2)
+	sst, rst, got, serr, rerr := transferMultipath(enc, nil, send, recv, MultipathOptions{})
+	if serr != nil || rerr != nil || len(got) != 0 || sst.Stripes != 0 || rst.Stripes != 0 {
+		t.Fatalf("空数据: %v %v %d %+v", serr, rerr, len(got), rst)
+	}
+
+	// 两条连接各承载 3 个分片，其中一条断开后每个条带只剩 3 个分片
+	send, recv = tcpPaths(t, 2)
+	send[0] = &faultyConn{Conn: send[0], after: 4}
+	data := make([]byte, 5000)
+	_, _, _, serr, rerr = transferMultipath(enc, data, send, recv, MultipathOptions{StripeSize: 1024})
+	if serr != ErrTooFewShards || rerr != io.ErrUnexpectedEOF && rerr != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v %v", serr, rerr)
+	}
+
+	// 发送无效帧的连接被忽略
+	send, recv = tcpPaths(t, 2)
+	send[0].Write(make([]byte, multipathHeaderLen))
+	sst, rst, got, serr, rerr = transferMultipath(enc, data, send[1:], recv, MultipathOptions{StripeSize: 1024})
+	if serr != nil || rerr != nil || !bytes.Equal(got, data) || rst.Stripes != 5 || rst.Rebuilt != 0 {
+		t.Fatalf("发送: %v，接收: %v，%+v", serr, rerr, rst)
+	}
+	// 无效帧可能在全部条带输出之后才被读到
+	if rst.Paths[0].Err != nil && rst.Paths[0].Err != ErrMultipathFrame || rst.Paths[0].Shards != 0 || rst.Paths[1].Shards != 30 {
+		t.Fatalf("接收端连接统计 %+v", rst.Paths)
+	}
+	if _, _, err := readMultipathFrame(bytes.NewReader(make([]byte, multipathHeaderLen)), DefaultStripeSize); err != ErrMultipathFrame {
+		t.Fatalf("期望 ErrMultipathFrame，实际 %v", err)
+	}
+	// 条带大于接收端的 StripeSize 或分片长度与条带大小不符的帧在读取负载之前被拒绝
+	for _, h := range []multipathHeader{
+		{kind: multipathShard, field: 8, k: 4, m: 2, size: 2048, length: 512},
+		{kind: multipathShard, field: 8, k: 4, m: 2, size: 1000, length: 1 << 20},
+	} {
+		frame := h.appendFrame(nil, nil)
+		binary.BigEndian.PutUint32(frame[25:], uint32(h.length))
+		if _, _, err := readMultipathFrame(bytes.NewReader(frame), 1024); err != ErrMultipathFrame {
+			t.Fatalf("%+v: 期望 ErrMultipathFrame，实际 %v", h, err)
+		}
+	}
+}
+
+// 测试接收端的条带窗口：超出窗口的连接暂停读取，缺少的分片到达后继续；
+// 缺少的分片不会再到达时，不必等待暂停的连接结束即返回 ErrTooFewShards
+func TestMultipathWindow(t *testing.T) {
+	enc, err := New(2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const stripe, stripes = 256, 3 * multipathWindow
+	data := make([]byte, stripe*stripes)
+	rand.New(rand.NewSource(4)).Read(data)
+	frame := func(i, index int) []byte {
+		shards, err := encodeStripe(enc, data[i*stripe:(i+1)*stripe])
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := multipathHeader{kind: multipathShard, field: 8, stripe: uint64(i), index: index, k: 2, m: 1, size: stripe}
+		return h.appendFrame(nil, shards[index])
+	}
+	end := (&multipathHeader{kind: multipathEnd, field: 8, stripe: stripes, k: 2, m: 1, size: int64(len(data))}).appendFrame(nil, nil)
+	opts := MultipathOptions{StripeSize: stripe}
+
+	for _, lost := range []bool{false, true} {
+		send, recv := tcpPaths(t, 2)
+		// 连接 0 只送出条带 0 的一个分片，之后的条带都送出两个分片
+		go func() {
+			send[0].Write(frame(0, 0))
+			for i := 1; i < stripes; i++ {
+				send[0].Write(frame(i, 0))
+				send[0].Write(frame(i, 1))
+			}
+			send[0].Write(end)
+		}()
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			if lost {
+				send[1].Close()
+				return
+			}
+			send[1].Write(frame(0, 2))
+			send[1].Write(end)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var out bytes.Buffer
+		st, err := ReceiveMultipath(ctx, &out, recv, opts)
+		cancel()
+		if lost {
+			if err != ErrTooFewShards || out.Len() != 0 {
+				t.Fatalf("期望 ErrTooFewShards，实际 %v，输出 %d 字节", err, out.Len())
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(out.Bytes(), data) || st.Rebuilt != 1 {
+			t.Fatalf("%v，输出 %d 字节，统计 %+v", err, out.Len(), st)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/**
+ * Reed-Solomon 编码库 - 按需打开分片
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"io"
+)
+
+// ShardOpener 按需打开分片
+// 分片数量很多时（例如 GF(2^16) 的数万个分片）无法同时打开所有分片，
+// StreamReconstructShards 只打开实际需要读取的分片和需要重建的分片，并在结束后立即关闭。
+type ShardOpener interface {
+	OpenShard(i int) (io.ReadCloser, error)    // 打开分片 i 用于读取
+	CreateShard(i int) (io.WriteCloser, error) // 打开分片 i 用于写入重建结果
+}
+
+// ShardCoster 是 ShardOpener 可选实现的接口，返回读取分片 i 的代价
+// 重建时从可用分片中选择代价最小的 k 个读取，代价相同时优先选择序号小的分片。
+// 没有实现该接口时按序号选择，即优先读取数据分片。
+type ShardCoster interface {
+	ShardCost(i int) float64
+}
+
+// openShards 选择并打开需要的分片，然后调用 run 执行流式重建
+// present 标记哪些分片可以读取，rebuild 标记需要重建的分片。
+func openShards(opener ShardOpener, dataShards int, present, rebuild []bool, run func(inputs []io.Reader, outputs []io.Writer) error) (err error) {
+	total := len(present)
+	if opener == nil || len(rebuild) != total {
+		return ErrInvalidInput
+	}
+	need := false
+	for i := range rebuild {
+		if rebuild[i] && present[i] {
+			return ErrReconstructMismatch
+		}
+		need = need || rebuild[i]
+	}
+	if !need {
+		return nil
+	}
+
+	var cost func(i int) float64
+	if c, ok := opener.(ShardCoster); ok {
+		cost = c.ShardCost
+	}
+	selected, err := selectShards(present, dataShards, cost)
+	if err != nil {
+		return err
+	}
+
+	inputs := make([]io.Reader, total)
+	outputs := make([]io.Writer, total)
+	var closers []io.Closer
+	defer func() {
+		for _, c := range closers {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}()
+
+	for _, i := range selected {
+		r, err := opener.OpenShard(i)
+		if err != nil {
+			return StreamReadError{Err: err, Stream: i}
+		}
+		closers = append(closers, r)
+		inputs[i] = r
+	}
+	for i := range rebuild {
+		if !rebuild[i] {
+			continue
+		}
+		w, err := opener.CreateShard(i)
+		if err != nil {
+			return StreamWriteError{Err: err, Stream: i}
+		}
+		closers = append(closers, w)
+		outputs[i] = w
+	}
+	return run(inputs, outputs)
+}
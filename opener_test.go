@@ -0,0 +1,164 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// memOpener 是基于内存的 ShardOpener，记录打开和关闭的分片
+type memOpener struct {
+	shards  [][]byte
+	out     map[int]*bytes.Buffer
+	opened  []int
+	open    int // 当前打开的数量
+	cost    func(i int) float64
+	failAll bool
+}
+
+type memShard struct {
+	io.Reader
+	io.Writer
+	o *memOpener
+}
+
+func (s *memShard) Close() error {
+	s.o.open--
+	return nil
+}
+
+func (o *memOpener) OpenShard(i int) (io.ReadCloser, error) {
+	if o.failAll {
+		return nil, errors.New("打开失败")
+	}
+	o.opened = append(o.opened, i)
+	o.open++
+	return &memShard{Reader: bytes.NewReader(o.shards[i]), o: o}, nil
+}
+
+func (o *memOpener) CreateShard(i int) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	o.out[i] = buf
+	o.open++
+	return &memShard{Writer: buf, o: o}, nil
+}
+
+// costOpener 额外实现 ShardCoster
+type costOpener struct {
+	*memOpener
+}
+
+func (o costOpener) ShardCost(i int) float64 {
+	return o.cost(i)
+}
+
+// 测试按需打开分片的流式重建只读取 k 个分片并关闭所有分片
+func TestStreamReconstructShards(t *testing.T) {
+	testStreamReconstructShards(t, 6, 3, false)
+	testStreamReconstructShards(t, 300, 40, true)
+}
+
+func testStreamReconstructShards(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards, WithStreamBlockSize(1024))
+	} else {
+		enc, err = New8(dataShards, parityShards, WithStreamBlockSize(1024))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+
+	data := make([]byte, dataShards*3000)
+	rand.New(rand.NewSource(3)).Read(data)
+	shards, err := enc.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// 丢失第一个数据分片和最后一个校验分片，两者都需要重建
+	present := make([]bool, total)
+	rebuild := make([]bool, total)
+	for i := range present {
+		present[i] = true
+	}
+	for _, i := range []int{0, total - 1} {
+		present[i] = false
+		rebuild[i] = true
+	}
+
+	check := func(o *memOpener, want func(i int) bool) {
+		t.Helper()
+		if o.open != 0 {
+			t.Fatalf("结束后仍有 %d 个分片未关闭", o.open)
+		}
+		if len(o.opened) != dataShards {
+			t.Fatalf("期望读取 %d 个分片，实际 %d", dataShards, len(o.opened))
+		}
+		for _, i := range o.opened {
+			if !want(i) {
+				t.Fatalf("读取了不应选择的分片 %d", i)
+			}
+		}
+		for i := range rebuild {
+			if rebuild[i] && !bytes.Equal(o.out[i].Bytes(), shards[i]) {
+				t.Fatalf("重建的分片 %d 不一致", i)
+			}
+		}
+	}
+
+	// 默认按序号选择：读取除丢失分片外序号最小的 k 个分片
+	o := &memOpener{shards: shards, out: map[int]*bytes.Buffer{}}
+	if err := enc.StreamReconstructShards(o, present, rebuild); err != nil {
+		t.Fatal(err)
+	}
+	check(o, func(i int) bool { return i <= dataShards })
+
+	// 按代价选择：数据分片代价高时优先读取校验分片
+	o = &memOpener{shards: shards, out: map[int]*bytes.Buffer{}, cost: func(i int) float64 {
+		if i < dataShards {
+			return 10
+		}
+		return 1
+	}}
+	if err := enc.StreamReconstructShards(costOpener{o}, present, rebuild); err != nil {
+		t.Fatal(err)
+	}
+	parityRead := 0
+	for _, i := range o.opened {
+		if i >= dataShards {
+			parityRead++
+		}
+	}
+	if parityRead != parityShards-1 {
+		t.Fatalf("期望读取 %d 个校验分片，实际 %d", parityShards-1, parityRead)
+	}
+	check(o, func(i int) bool { return true })
+
+	// 打开失败时返回读取错误，已打开的分片全部关闭
+	o = &memOpener{shards: shards, out: map[int]*bytes.Buffer{}, failAll: true}
+	var readErr StreamReadError
+	if err := enc.StreamReconstructShards(o, present, rebuild); !errors.As(err, &readErr) {
+		t.Fatalf("期望 StreamReadError，实际 %v", err)
+	}
+	if o.open != 0 {
+		t.Fatalf("出错后仍有 %d 个分片未关闭", o.open)
+	}
+
+	// 可用分片不足
+	few := make([]bool, total)
+	copy(few, present)
+	for i := 1; i < parityShards; i++ {
+		few[i] = false
+	}
+	if err := enc.StreamReconstructShards(o, few, rebuild); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
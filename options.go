@@ -0,0 +1,106 @@
+/**
+ * Reed-Solomon 编码库 - 配置选项
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+// Option 用于配置编解码器，可以传给 New、New8 和 New16
+type Option func(*streamOptions)
+
+// 默认的流处理块大小
+const defaultStreamBlockSize = 4 * 1024 * 1024 // 4MB
+
+// 流式操作选项
+type streamOptions struct {
+	streamBS   int  // 流块大小
+	concReads  bool // 并发读取
+	concWrites bool // 并发写入
+
+	// 检查点
+	checkpointEvery int                     // 每处理多少个块报告一次检查点
+	checkpoint      func(*Checkpoint) error // 检查点回调
+
+	// 进度和统计
+	progress func(Progress)     // 每个块完成后的进度回调
+	stats    func(*StreamStats) // 操作结束时的统计回调
+}
+
+// newStreamOptions 应用所有选项并返回结果
+func newStreamOptions(opts []Option) streamOptions {
+	var o streamOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// blockSize 返回实际使用的流处理块大小，保证是64字节的倍数
+func (o *streamOptions) blockSize() int {
+	if o.streamBS <= 0 {
+		return defaultStreamBlockSize
+	}
+	return ((o.streamBS + 63) / 64) * 64
+}
+
+// WithStreamBlockSize 设置流式操作每次从每个分片读取的块大小
+// 大小会向上取整到64字节的倍数。分片非常多时，减小块大小可以降低内存占用。
+func WithStreamBlockSize(n int) Option {
+	return func(o *streamOptions) {
+		o.streamBS = n
+	}
+}
+
+// WithConcurrentStreams 同时启用并发读取和并发写入
+func WithConcurrentStreams(enabled bool) Option {
+	return func(o *streamOptions) {
+		o.concReads = enabled
+		o.concWrites = enabled
+	}
+}
+
+// WithConcurrentStreamReads 启用流式编码时的并发读取
+func WithConcurrentStreamReads(enabled bool) Option {
+	return func(o *streamOptions) {
+		o.concReads = enabled
+	}
+}
+
+// WithConcurrentStreamWrites 启用流式编码时的并发写入
+func WithConcurrentStreamWrites(enabled bool) Option {
+	return func(o *streamOptions) {
+		o.concWrites = enabled
+	}
+}
+
+// WithCheckpoint 为 StreamEncode 和 StreamReconstruct 启用检查点
+// 每处理完 everyBlocks 个块（且该块的输出已经写入）时调用 fn，
+// 传入的检查点可以序列化保存，之后交给 StreamEncodeResume/StreamReconstructResume 继续。
+// fn 返回错误时操作会中止并返回该错误。
+func WithCheckpoint(everyBlocks int, fn func(*Checkpoint) error) Option {
+	return func(o *streamOptions) {
+		if everyBlocks <= 0 {
+			everyBlocks = 1
+		}
+		o.checkpointEvery = everyBlocks
+		o.checkpoint = fn
+	}
+}
+
+// WithProgress 设置流式操作的进度回调
+// 编码、重建和拆分每处理完一个块调用一次 fn，合并每写出一次调用一次。
+// fn 在操作所在的 goroutine 中同步调用，应尽快返回。
+func WithProgress(fn func(Progress)) Option {
+	return func(o *streamOptions) {
+		o.progress = fn
+	}
+}
+
+// WithStreamStats 设置流式操作结束时的统计回调
+// 无论操作成功与否，结束时都会调用 fn，报告每个流的字节数以及读取、计算和写入耗时。
+func WithStreamStats(fn func(*StreamStats)) Option {
+	return func(o *streamOptions) {
+		o.stats = fn
+	}
+}
@@ -0,0 +1,153 @@
+/**
+ * Reed-Solomon 编码库 - 重建计划
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import "slices"
+
+// Plan 是针对一种固定丢失情况预先计算的重建计划，由 PlanReconstruct 创建
+// 只与丢失位置有关的计算（错误定位多项式、FWHT 以及位图优化的各级 mip）在创建时完成一次，
+// Reconstruct/ReconstructData 只执行与数据有关的 FFT。传入的分片丢失情况必须与创建时的 present
+// 一致，否则返回 ErrPlanMismatch。Plan 创建后只读，可以被多个 goroutine 并发使用。
+type Plan interface {
+	Reconstruct(shards [][]byte) error     // 重建全部丢失的分片
+	ReconstructData(shards [][]byte) error // 只重建丢失的数据分片
+}
+
+// planShardSize 检查分片数量、大小以及丢失情况是否与 present 一致，返回分片大小
+// 没有需要重建的分片时返回0。
+func planShardSize(shards [][]byte, present []bool, dataShards int, recoverAll bool) (int, error) {
+	if len(shards) != len(present) {
+		return 0, ErrTooFewShards
+	}
+	if err := checkShards(shards, true); err != nil {
+		return 0, err
+	}
+	need := false
+	for i, s := range shards {
+		if (len(s) != 0) != present[i] {
+			return 0, ErrPlanMismatch
+		}
+		need = need || !present[i] && (recoverAll || i < dataShards)
+	}
+	if !need {
+		return 0, nil
+	}
+	size := shardSize(shards)
+	if size%64 != 0 {
+		return 0, ErrInvalidShardSize
+	}
+	return size, nil
+}
+
+// countPresent 检查 present 的长度并返回可用分片数量，不足 k 个时返回 ErrTooFewShards
+func countPresent(present []bool, dataShards, totalShards int) (int, error) {
+	if len(present) != totalShards {
+		return 0, ErrTooFewShards
+	}
+	n := 0
+	for _, ok := range present {
+		if ok {
+			n++
+		}
+	}
+	if n < dataShards {
+		return 0, ErrTooFewShards
+	}
+	return n, nil
+}
+
+// leopardPlan16 是 leopardFF16 的重建计划
+// 位图按重建全部分片准备，只重建数据分片时多计算的输出不影响结果。
+type leopardPlan16 struct {
+	r       *leopardFF16
+	present []bool
+	errLocs *[order]ffe
+	bits    *errorBitfield // 不使用位图优化时为nil
+}
+
+// PlanReconstruct 为 present 描述的丢失情况创建重建计划
+// present 的长度必须等于总分片数，可用分片少于 k 个时返回 ErrTooFewShards。
+func (r *leopardFF16) PlanReconstruct(present []bool) (Plan, error) {
+	n, err := countPresent(present, r.dataShards, r.totalShards)
+	if err != nil {
+		return nil, err
+	}
+	p := &leopardPlan16{r: r, present: slices.Clone(present), errLocs: new([order]ffe)}
+	useBits := r.totalShards-n <= r.parityShards/4
+	bits := new(errorBitfield)
+	r.locateErrors(p.errLocs, bits, p.present, true, useBits)
+	if useBits {
+		p.bits = bits
+	}
+	return p, nil
+}
+
+// Reconstruct 按计划重建全部丢失的分片
+func (p *leopardPlan16) Reconstruct(shards [][]byte) error {
+	return p.reconstruct(shards, true)
+}
+
+// ReconstructData 按计划只重建丢失的数据分片
+func (p *leopardPlan16) ReconstructData(shards [][]byte) error {
+	return p.reconstruct(shards, false)
+}
+
+func (p *leopardPlan16) reconstruct(shards [][]byte, recoverAll bool) error {
+	size, err := planShardSize(shards, p.present, p.r.dataShards, recoverAll)
+	if err != nil || size == 0 {
+		return err
+	}
+	return p.r.recoverShards(shards, size, recoverAll, p.errLocs, p.bits)
+}
+
+// leopardPlan8 是 leopardFF8 的重建计划
+// 位图按重建全部分片准备，与 reconstruct 相同，只在分片总量足够大时使用。
+type leopardPlan8 struct {
+	r       *leopardFF8
+	present []bool
+	errLocs [order8]ffe8
+	bits    *errorBitfield8 // 丢失的分片太多、不使用位图优化时为nil
+}
+
+// PlanReconstruct 为 present 描述的丢失情况创建重建计划
+// present 的长度必须等于总分片数，可用分片少于 k 个时返回 ErrTooFewShards。
+func (r *leopardFF8) PlanReconstruct(present []bool) (Plan, error) {
+	n, err := countPresent(present, r.dataShards, r.totalShards)
+	if err != nil {
+		return nil, err
+	}
+	p := &leopardPlan8{r: r, present: slices.Clone(present)}
+	useBits := r.totalShards-n <= r.parityShards/4
+	bits := new(errorBitfield8)
+	r.locateErrors(&p.errLocs, bits, p.present, true, useBits)
+	if useBits {
+		p.bits = bits
+	}
+	return p, nil
+}
+
+// Reconstruct 按计划重建全部丢失的分片
+func (p *leopardPlan8) Reconstruct(shards [][]byte) error {
+	return p.reconstruct(shards, true)
+}
+
+// ReconstructData 按计划只重建丢失的数据分片
+func (p *leopardPlan8) ReconstructData(shards [][]byte) error {
+	return p.reconstruct(shards, false)
+}
+
+func (p *leopardPlan8) reconstruct(shards [][]byte, recoverAll bool) error {
+	size, err := planShardSize(shards, p.present, p.r.dataShards, recoverAll)
+	if err != nil || size == 0 {
+		return err
+	}
+	bits := p.bits
+	if size*p.r.totalShards < 64<<10 {
+		bits = nil
+	}
+	return p.r.recoverShards(shards, size, recoverAll, &p.errLocs, bits)
+}
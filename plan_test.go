@@ -0,0 +1,131 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// 测试重建计划与 Reconstruct 结果一致，并且可以并发地重复使用
+func TestPlanReconstruct(t *testing.T) {
+	testPlanReconstruct(t, 10, 4, 64*10, 4)      // GF(2^8)，分片较小，不使用位图
+	testPlanReconstruct(t, 20, 12, 64*1024, 2)   // GF(2^8)，使用位图
+	testPlanReconstruct(t, 300, 40, 64*4, 10)    // GF(2^16)，使用位图
+	testPlanReconstruct(t, 1000, 100, 64*2, 100) // GF(2^16)，丢失全部可恢复数量
+}
+
+func testPlanReconstruct(t *testing.T, dataShards, parityShards, size, lost int) {
+	enc, err := New(dataShards, parityShards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := enc.TotalShards()
+	rng := rand.New(rand.NewSource(int64(total)))
+	present := make([]bool, total)
+	for i := range present {
+		present[i] = true
+	}
+	// 至少丢失一个数据分片和一个校验分片
+	present[0], present[total-1] = false, false
+	for _, i := range rng.Perm(total)[:lost-2] {
+		present[i] = false
+	}
+	plan, err := enc.PlanReconstruct(present)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for round := 0; round < 3; round++ {
+				shards := enc.AllocAligned(total, size)
+				for i := 0; i < dataShards; i++ {
+					rng.Read(shards[i])
+				}
+				if err := enc.Encode(shards); err != nil {
+					errs <- err
+					return
+				}
+				work := make([][]byte, total)
+				for i := range work {
+					if present[i] {
+						work[i] = shards[i]
+					}
+				}
+				if err := plan.ReconstructData(work); err != nil {
+					errs <- err
+					return
+				}
+				for i := 0; i < total; i++ {
+					if i < dataShards && !bytes.Equal(work[i], shards[i]) || i >= dataShards && !present[i] && work[i] != nil {
+						t.Errorf("ReconstructData: 分片 %d 不正确", i)
+						return
+					}
+				}
+				for i := range work {
+					if !present[i] {
+						work[i] = nil
+					}
+				}
+				if err := plan.Reconstruct(work); err != nil {
+					errs <- err
+					return
+				}
+				for i := range work {
+					if !bytes.Equal(work[i], shards[i]) {
+						t.Errorf("Reconstruct: 分片 %d 不一致", i)
+						return
+					}
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// 丢失情况与计划不一致
+	shards := enc.AllocAligned(total, size)
+	if err := plan.Reconstruct(shards); err != ErrPlanMismatch {
+		t.Fatalf("期望 ErrPlanMismatch，实际 %v", err)
+	}
+}
+
+// 测试无效的参数
+func TestPlanReconstructErrors(t *testing.T) {
+	for _, enc := range []ReedSolomon{mustNew(New8(4, 2)), mustNew(New16(4, 2))} {
+		if _, err := enc.PlanReconstruct(make([]bool, 5)); err != ErrTooFewShards {
+			t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+		}
+		present := []bool{true, false, false, true, false, true}
+		if _, err := enc.PlanReconstruct(present); err != ErrTooFewShards {
+			t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+		}
+		// 没有丢失的分片时什么都不做
+		plan, err := enc.PlanReconstruct([]bool{true, true, true, true, true, true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := plan.Reconstruct(enc.AllocAligned(6, 64)); err != nil {
+			t.Fatal(err)
+		}
+		if err := plan.Reconstruct(enc.AllocAligned(5, 64)); err != ErrTooFewShards {
+			t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+		}
+	}
+}
+
+func mustNew(enc ReedSolomon, err error) ReedSolomon {
+	if err != nil {
+		panic(err)
+	}
+	return enc
+}
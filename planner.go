@@ -0,0 +1,155 @@
+/**
+ * Reed-Solomon 编码库 - 重建读取计划
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"io"
+	"slices"
+	"sort"
+)
+
+// Planner 根据分片的可用性和读取代价选择重建所需的最少分片
+// 任意 k 个分片都足以重建，因此可用分片多于 k 个时只需读取代价最小的 k 个，
+// 多余的分片（例如位于慢速或远程存储上的分片）不会被读取。
+type Planner struct {
+	enc  ReedSolomon
+	cost func(i int) float64
+}
+
+// NewPlanner 为编码器创建读取计划器
+// cost 返回读取分片 i 的代价，为nil时按序号选择，即优先读取数据分片。
+func NewPlanner(enc ReedSolomon, cost func(i int) float64) *Planner {
+	return &Planner{enc: enc, cost: cost}
+}
+
+// Select 返回重建需要读取的分片序号（按序号升序）
+// present 的长度必须等于总分片数。可用分片不足 k 个时返回 ErrTooFewShards。
+func (p *Planner) Select(present []bool) ([]int, error) {
+	if len(present) != p.enc.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+	return selectShards(present, p.enc.DataShards(), p.cost)
+}
+
+// Reconstruct 只使用选出的分片重建所有丢失的分片
+// 多余的可用分片不参与计算，调用期间和调用结束后都保持原样。
+func (p *Planner) Reconstruct(shards [][]byte) error {
+	return p.reconstruct(shards, false)
+}
+
+// ReconstructData 只使用选出的分片重建丢失的数据分片
+func (p *Planner) ReconstructData(shards [][]byte) error {
+	return p.reconstruct(shards, true)
+}
+
+func (p *Planner) reconstruct(shards [][]byte, dataOnly bool) error {
+	present := make([]bool, len(shards))
+	for i := range shards {
+		present[i] = len(shards[i]) != 0
+	}
+	selected, err := p.Select(present)
+	if err != nil {
+		return err
+	}
+
+	// 编解码器只看到选出的分片，重建结果只写回原本丢失的位置
+	k := p.enc.DataShards()
+	view := make([][]byte, len(shards))
+	for _, i := range selected {
+		view[i] = shards[i]
+	}
+	if err := p.enc.ReconstructData(view); err != nil {
+		return err
+	}
+	for i := 0; i < k; i++ {
+		if !present[i] {
+			shards[i] = view[i]
+		}
+	}
+	if dataOnly || !slices.Contains(present[k:], false) {
+		return nil
+	}
+
+	// 数据分片完整后重新编码校验分片，未丢失的校验分片写入临时缓冲区
+	parity := p.enc.AllocAligned(len(shards)-k, len(view[0]))
+	copy(view[k:], parity)
+	if err := p.enc.Encode(view); err != nil {
+		return err
+	}
+	for i := k; i < len(shards); i++ {
+		if !present[i] {
+			shards[i] = view[i]
+		}
+	}
+	return nil
+}
+
+// StreamReconstruct 只读取选出的输入流重建丢失的分片
+// 非nil的输入视为可用，多余的输入流不会被读取。
+func (p *Planner) StreamReconstruct(inputs []io.Reader, outputs []io.Writer) error {
+	present := make([]bool, len(inputs))
+	for i := range inputs {
+		present[i] = inputs[i] != nil
+	}
+	if len(outputs) != len(inputs) {
+		return ErrTooFewShards
+	}
+	for i := range inputs {
+		if inputs[i] != nil && outputs[i] != nil {
+			return ErrReconstructMismatch
+		}
+	}
+	selected, err := p.Select(present)
+	if err != nil {
+		return err
+	}
+
+	use := make([]io.Reader, len(inputs))
+	for _, i := range selected {
+		use[i] = inputs[i]
+	}
+	return p.enc.StreamReconstruct(use, outputs)
+}
+
+// canReconstruct 检查可用分片是否足以重建
+func canReconstruct(present []bool, dataShards, totalShards int) bool {
+	if len(present) != totalShards {
+		return false
+	}
+	n := 0
+	for _, ok := range present {
+		if ok {
+			n++
+		}
+	}
+	return n >= dataShards
+}
+
+// selectShards 从可用分片中按代价选择 k 个分片，返回按序号排列的分片序号
+func selectShards(present []bool, k int, cost func(i int) float64) ([]int, error) {
+	avail := make([]int, 0, len(present))
+	for i, ok := range present {
+		if ok {
+			avail = append(avail, i)
+		}
+	}
+	if len(avail) < k {
+		return nil, ErrTooFewShards
+	}
+	if cost != nil {
+		costs := make([]float64, len(present))
+		for _, i := range avail {
+			costs[i] = cost(i)
+		}
+		sort.SliceStable(avail, func(a, b int) bool {
+			return costs[avail[a]] < costs[avail[b]]
+		})
+	}
+	avail = avail[:k]
+	sort.Ints(avail)
+	return avail, nil
+}
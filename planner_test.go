@@ -0,0 +1,171 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// countReader 记录是否被读取过
+type countReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+// 测试读取计划器只选择代价最小的 k 个分片，多余分片不被读取
+func TestPlanner(t *testing.T) {
+	testPlanner(t, 10, 4, false)
+	testPlanner(t, 10, 4, true)
+}
+
+func testPlanner(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(4)).Read(data)
+	shards, err := enc.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据分片 0-4 位于慢速存储
+	slow := func(i int) float64 {
+		if i < 5 {
+			return 100
+		}
+		return 1
+	}
+	p := NewPlanner(enc, slow)
+
+	present := make([]bool, total)
+	for i := range present {
+		present[i] = true
+	}
+	present[7] = false
+	if !enc.CanReconstruct(present) {
+		t.Fatal("13 个可用分片应能重建")
+	}
+	sel, err := p.Select(present)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 1, 5, 6, 8, 9, 10, 11, 12, 13}
+	if len(sel) != len(want) {
+		t.Fatalf("期望选择 %v，实际 %v", want, sel)
+	}
+	for i := range want {
+		if sel[i] != want[i] {
+			t.Fatalf("期望选择 %v，实际 %v", want, sel)
+		}
+	}
+
+	// 没有代价函数时优先选择数据分片
+	sel, err = NewPlanner(enc, nil).Select(present)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel[len(sel)-1] != dataShards {
+		t.Fatalf("期望只使用一个校验分片，实际 %v", sel)
+	}
+
+	// 内存重建：多余分片保持原样
+	work := make([][]byte, total)
+	copy(work, shards)
+	work[7] = nil
+	if err := p.Reconstruct(work); err != nil {
+		t.Fatal(err)
+	}
+	for i := range shards {
+		if !bytes.Equal(work[i], shards[i]) {
+			t.Fatalf("分片 %d 不一致", i)
+		}
+	}
+	if &work[0][0] != &shards[0][0] {
+		t.Fatal("多余的分片应保持原样")
+	}
+
+	// 同时丢失数据分片和校验分片：只写回丢失的位置，多余的分片不被替换或修改
+	orig := make([][]byte, total)
+	for i := range shards {
+		orig[i] = append([]byte(nil), shards[i]...)
+	}
+	work = make([][]byte, total)
+	copy(work, shards)
+	work[7], work[total-1] = nil, nil
+	if err := p.ReconstructData(work); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(work[7], orig[7]) || work[total-1] != nil {
+		t.Fatal("ReconstructData 应只重建丢失的数据分片")
+	}
+	work[7] = nil
+	if err := p.Reconstruct(work); err != nil {
+		t.Fatal(err)
+	}
+	for i := range shards {
+		if !bytes.Equal(work[i], orig[i]) || !bytes.Equal(shards[i], orig[i]) {
+			t.Fatalf("分片 %d 不一致", i)
+		}
+		if i != 7 && i != total-1 && &work[i][0] != &shards[i][0] {
+			t.Fatalf("未丢失的分片 %d 被替换", i)
+		}
+	}
+
+	// 流式重建：多余的输入流不会被读取
+	readers := make([]*countReader, total)
+	inputs := make([]io.Reader, total)
+	outputs := make([]io.Writer, total)
+	for i := range shards {
+		if present[i] {
+			readers[i] = &countReader{r: bytes.NewReader(shards[i])}
+			inputs[i] = readers[i]
+		}
+	}
+	var rebuilt bytes.Buffer
+	outputs[7] = &rebuilt
+	if err := p.StreamReconstruct(inputs, outputs); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rebuilt.Bytes(), shards[7]) {
+		t.Fatal("流式重建的分片不一致")
+	}
+	for i, r := range readers {
+		if r == nil {
+			continue
+		}
+		if (i >= 2 && i < 5) != (r.read == 0) {
+			t.Fatalf("分片 %d 读取了 %d 字节", i, r.read)
+		}
+	}
+
+	// 可用分片不足
+	for i := 0; i < parityShards; i++ {
+		present[i] = false
+	}
+	if enc.CanReconstruct(present) {
+		t.Fatal("9 个可用分片不应能重建")
+	}
+	if _, err := p.Select(present); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
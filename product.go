@@ -0,0 +1,248 @@
+/**
+ * Reed-Solomon 编码库 - 二维乘积码
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import "io"
+
+// ProductCode 是二维乘积码编解码器
+// 数据排列为 dataRows×dataCols 的分片网格，每行用 (dataCols, parityCols) 的行编码扩展出校验列，
+// 再对包括校验列在内的每一列用 (dataRows, parityRows) 的列编码扩展出校验行，得到
+// (dataRows+parityRows)×(dataCols+parityCols) 的网格。由于编码是线性的，校验行同样是行编码的码字，
+// 因此重建时可以交替按行、按列解码：每一轮都可能让其他行或列的丢失数量降到可解的范围内，
+// 从而恢复单个一维编码无法恢复的丢失模式。
+//
+// 分片按行优先展开为一维切片，网格中第 row 行第 col 列的分片序号为 Index(row, col)。
+type ProductCode struct {
+	rowEnc     ReedSolomon // 行编码：dataCols 个数据分片，parityCols 个校验分片
+	colEnc     ReedSolomon // 列编码：dataRows 个数据分片，parityRows 个校验分片
+	dataRows   int
+	dataCols   int
+	parityRows int
+	parityCols int
+}
+
+// NewProductCode 创建二维乘积码编解码器
+// 行、列编码器按较宽的一维选择 GF(2^8) 或 GF(2^16)，opts 同时传给两者。两者必须使用同一个域：
+// 不同域中的乘法不可交换，校验行将不再是行编码的码字。
+func NewProductCode(dataRows, dataCols, parityRows, parityCols int, opts ...Option) (*ProductCode, error) {
+	newEnc := New8
+	if dataRows+parityRows > 256 || dataCols+parityCols > 256 {
+		newEnc = New16
+	}
+	rowEnc, err := newEnc(dataCols, parityCols, opts...)
+	if err != nil {
+		return nil, err
+	}
+	colEnc, err := newEnc(dataRows, parityRows, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ProductCode{
+		rowEnc:     rowEnc,
+		colEnc:     colEnc,
+		dataRows:   dataRows,
+		dataCols:   dataCols,
+		parityRows: parityRows,
+		parityCols: parityCols,
+	}, nil
+}
+
+// Rows 返回扩展后网格的行数
+func (p *ProductCode) Rows() int { return p.dataRows + p.parityRows }
+
+// Cols 返回扩展后网格的列数
+func (p *ProductCode) Cols() int { return p.dataCols + p.parityCols }
+
+// TotalShards 返回扩展后网格的分片总数
+func (p *ProductCode) TotalShards() int { return p.Rows() * p.Cols() }
+
+// DataShards 返回数据分片数量
+func (p *ProductCode) DataShards() int { return p.dataRows * p.dataCols }
+
+// Index 返回第 row 行第 col 列的分片序号
+func (p *ProductCode) Index(row, col int) int { return row*p.Cols() + col }
+
+// row 返回第 i 行的分片，与 shards 共用底层数组
+func (p *ProductCode) row(shards [][]byte, i int) [][]byte {
+	return shards[i*p.Cols() : (i+1)*p.Cols() : (i+1)*p.Cols()]
+}
+
+// col 返回第 j 列的分片
+func (p *ProductCode) col(shards [][]byte, j int) [][]byte {
+	col := make([][]byte, p.Rows())
+	for i := range col {
+		col[i] = shards[p.Index(i, j)]
+	}
+	return col
+}
+
+// setCol 把列编码器重建的分片写回 shards
+func (p *ProductCode) setCol(shards, col [][]byte, j int) {
+	for i, s := range col {
+		shards[p.Index(i, j)] = s
+	}
+}
+
+// checkShards 检查分片数量和大小；complete 为真时不允许丢失分片
+func (p *ProductCode) checkShards(shards [][]byte, complete bool) error {
+	if len(shards) != p.TotalShards() {
+		return ErrTooFewShards
+	}
+	size := 0
+	for _, s := range shards {
+		if len(s) == 0 {
+			if complete {
+				return ErrShardNoData
+			}
+			continue
+		}
+		if size != 0 && len(s) != size {
+			return ErrShardSize
+		}
+		size = len(s)
+	}
+	if size == 0 {
+		return ErrShardNoData
+	}
+	return nil
+}
+
+// Split 把数据按行优先拆分到数据分片，返回整个网格，校验分片已分配但未编码
+func (p *ProductCode) Split(data []byte) ([][]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrShortData
+	}
+	k := p.DataShards()
+	multiple := p.rowEnc.ShardSizeMultiple()
+	if m := p.colEnc.ShardSizeMultiple(); m > multiple {
+		multiple = m
+	}
+	per := (len(data) + k - 1) / k
+	per = (per + multiple - 1) / multiple * multiple
+	shards := AllocAligned(p.TotalShards(), per)
+	for r := 0; r < p.dataRows && len(data) > 0; r++ {
+		for c := 0; c < p.dataCols && len(data) > 0; c++ {
+			data = data[copy(shards[p.Index(r, c)], data):]
+		}
+	}
+	return shards, nil
+}
+
+// Join 按行优先合并数据分片，数据分片必须齐全
+func (p *ProductCode) Join(dst io.Writer, shards [][]byte, outSize int) error {
+	if len(shards) != p.TotalShards() {
+		return ErrTooFewShards
+	}
+	for r := 0; r < p.dataRows && outSize > 0; r++ {
+		for c := 0; c < p.dataCols && outSize > 0; c++ {
+			s := shards[p.Index(r, c)]
+			if s == nil {
+				return ErrReconstructRequired
+			}
+			if len(s) > outSize {
+				s = s[:outSize]
+			}
+			if _, err := dst.Write(s); err != nil {
+				return err
+			}
+			outSize -= len(s)
+		}
+	}
+	if outSize > 0 {
+		return ErrShortData
+	}
+	return nil
+}
+
+// Encode 由数据分片生成校验列和校验行
+func (p *ProductCode) Encode(shards [][]byte) error {
+	if err := p.checkShards(shards, true); err != nil {
+		return err
+	}
+	for i := 0; i < p.dataRows; i++ {
+		if err := p.rowEnc.Encode(p.row(shards, i)); err != nil {
+			return err
+		}
+	}
+	for j := 0; j < p.Cols(); j++ {
+		if err := p.colEnc.Encode(p.col(shards, j)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify 检查每一行和每一列是否都是码字
+func (p *ProductCode) Verify(shards [][]byte) (bool, error) {
+	if err := p.checkShards(shards, true); err != nil {
+		return false, err
+	}
+	for i := 0; i < p.Rows(); i++ {
+		if ok, err := p.rowEnc.Verify(p.row(shards, i)); !ok || err != nil {
+			return false, err
+		}
+	}
+	for j := 0; j < p.Cols(); j++ {
+		if ok, err := p.colEnc.Verify(p.col(shards, j)); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Reconstruct 交替按行、按列迭代解码，重建全部丢失的分片（长度为0的分片视为丢失）
+// 每一轮对丢失数量不超过校验分片数的行和列解码，直到没有丢失的分片，或者一轮中没有任何进展，
+// 此时返回 ErrTooFewShards，已经重建的分片保留在 shards 中。
+func (p *ProductCode) Reconstruct(shards [][]byte) error {
+	if err := p.checkShards(shards, false); err != nil {
+		return err
+	}
+	for {
+		missing, progress := 0, false
+		for i := 0; i < p.Rows(); i++ {
+			row := p.row(shards, i)
+			n := countMissing(row)
+			if n == 0 || n > p.parityCols {
+				missing += n
+				continue
+			}
+			if err := p.rowEnc.Reconstruct(row); err != nil {
+				return err
+			}
+			progress = true
+		}
+		for j := 0; j < p.Cols(); j++ {
+			col := p.col(shards, j)
+			n := countMissing(col)
+			if n == 0 || n > p.parityRows {
+				continue
+			}
+			if err := p.colEnc.Reconstruct(col); err != nil {
+				return err
+			}
+			p.setCol(shards, col, j)
+			progress = true
+		}
+		if !progress {
+			if missing > 0 {
+				return ErrTooFewShards
+			}
+			return nil
+		}
+	}
+}
+
+// countMissing 返回丢失的分片数量
+func countMissing(shards [][]byte) int {
+	n := 0
+	for _, s := range shards {
+		if len(s) == 0 {
+			n++
+		}
+	}
+	return n
+}
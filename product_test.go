@@ -0,0 +1,93 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试二维乘积码：超出单个一维编码能力的丢失模式通过行列迭代解码恢复
+func TestProductCode(t *testing.T) {
+	testProductCode(t, 4, 4, 4, 4)
+	testProductCode(t, 3, 200, 3, 100)
+}
+
+func testProductCode(t *testing.T, dataRows, dataCols, parityRows, parityCols int) {
+	p, err := NewProductCode(dataRows, dataCols, parityRows, parityCols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, p.DataShards()*64+100)
+	rand.New(rand.NewSource(int64(dataCols))).Read(data)
+	shards, err := p.Split(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.Verify(shards); !ok || err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	orig := make([][]byte, len(shards))
+	for i := range shards {
+		orig[i] = bytes.Clone(shards[i])
+	}
+
+	// 丢失前 parityCols 列的全部分片，以及另外一列中的一个分片：
+	// 第0行丢失的分片多于校验列数，但那一列先按列修复后所有行都可以按行解码
+	work := append([][]byte(nil), orig...)
+	for i := 0; i < p.Rows(); i++ {
+		for j := 0; j < parityCols; j++ {
+			work[p.Index(i, j)] = nil
+		}
+	}
+	work[p.Index(0, parityCols)] = nil
+	if err := p.Reconstruct(work); err != nil {
+		t.Fatal(err)
+	}
+	for i := range work {
+		if !bytes.Equal(work[i], orig[i]) {
+			t.Fatalf("分片 %d 不一致", i)
+		}
+	}
+	var out bytes.Buffer
+	if err := p.Join(&out, work, len(data)); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("合并失败: %v", err)
+	}
+
+	// 随机丢失四分之一的分片
+	rng := rand.New(rand.NewSource(1))
+	work = append([][]byte(nil), orig...)
+	for _, i := range rng.Perm(len(work))[:len(work)/4] {
+		work[i] = nil
+	}
+	if err := p.Reconstruct(work); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := p.Verify(work); !ok || err != nil {
+		t.Fatalf("重建后校验失败: %v", err)
+	}
+
+	// (parityRows+1)×(parityCols+1) 的子网格全部丢失时每行每列都无法解码
+	work = append([][]byte(nil), orig...)
+	for i := 0; i <= parityRows; i++ {
+		for j := 0; j <= parityCols; j++ {
+			work[p.Index(i, j)] = nil
+		}
+	}
+	work[p.Index(p.Rows()-1, p.Cols()-1)] = nil
+	if err := p.Reconstruct(work); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+	// 子网格之外丢失的分片已经重建
+	if work[p.Index(p.Rows()-1, p.Cols()-1)] == nil {
+		t.Fatal("可以恢复的分片没有重建")
+	}
+
+	work = append([][]byte(nil), orig...)
+	work[p.Index(p.Rows()-1, 0)][0] ^= 1
+	if ok, err := p.Verify(work); ok || err != nil {
+		t.Fatalf("篡改后校验: %v %v", ok, err)
+	}
+}
@@ -0,0 +1,139 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// 测试流式操作的进度回调和统计信息
+func TestStreamProgress(t *testing.T) {
+	testStreamProgress(t, 6, 3, false)
+	testStreamProgress(t, 6, 3, true)
+}
+
+func testStreamProgress(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	const blockSize = 4096
+	var progress []Progress
+	var stats []*StreamStats
+	opts := []Option{
+		WithStreamBlockSize(blockSize),
+		WithProgress(func(p Progress) { progress = append(progress, p) }),
+		WithStreamStats(func(s *StreamStats) { stats = append(stats, s) }),
+	}
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards, opts...)
+	} else {
+		enc, err = New8(dataShards, parityShards, opts...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := func() {
+		progress, stats = nil, nil
+	}
+	checkProgress := func(op string, blocks int, total int64) {
+		t.Helper()
+		if len(progress) != blocks {
+			t.Fatalf("%s: 期望 %d 次进度回调，实际 %d", op, blocks, len(progress))
+		}
+		for i, p := range progress {
+			if p.Op != op || p.Block != int64(i+1) || p.TotalBytes != total {
+				t.Fatalf("%s: 进度 %d 错误: %+v", op, i, p)
+			}
+			if i > 0 && p.BytesProcessed < progress[i-1].BytesProcessed {
+				t.Fatalf("%s: 已处理字节数倒退: %+v", op, p)
+			}
+		}
+		if last := progress[len(progress)-1]; last.BytesProcessed != total {
+			t.Fatalf("%s: 结束时已处理 %d 字节，期望 %d", op, last.BytesProcessed, total)
+		}
+		if len(stats) != 1 || stats[0].Op != op || stats[0].Blocks != int64(blocks) {
+			t.Fatalf("%s: 统计信息错误: %+v", op, stats)
+		}
+		s := stats[0]
+		// 计算时间直接计时，不超过总耗时；只有编码和重建有计算
+		hasCompute := op == StreamOpEncode || op == StreamOpReconstruct
+		if s.Elapsed < s.ReadTime || s.ComputeTime > s.Elapsed || (s.ComputeTime > 0) != hasCompute {
+			t.Fatalf("%s: 耗时统计错误: %+v", op, s)
+		}
+	}
+
+	// 每个分片 5 个完整块加一个不完整块
+	perShard := blockSize*5 + 640
+	data := make([]byte, perShard*dataShards)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	// 拆分：每个数据分片报告一次
+	bufs := make([]bytes.Buffer, dataShards+parityShards)
+	writers := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		writers[i] = &bufs[i]
+	}
+	if err := enc.StreamSplit(bytes.NewReader(data), writers[:dataShards], int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	checkProgress(StreamOpSplit, dataShards, int64(len(data)))
+	if stats[0].TotalRead() != int64(len(data)) || len(stats[0].BytesWritten) != dataShards {
+		t.Fatalf("拆分统计错误: %+v", stats[0])
+	}
+
+	// 编码：bytes.Reader 的总大小可知
+	reset()
+	readers := make([]io.Reader, dataShards)
+	for i := range readers {
+		readers[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	if err := enc.StreamEncode(readers, writers[dataShards:]); err != nil {
+		t.Fatal(err)
+	}
+	shardLen := int64(bufs[0].Len())
+	checkProgress(StreamOpEncode, int((shardLen+blockSize-1)/blockSize), shardLen*int64(dataShards))
+	for i, n := range stats[0].BytesWritten {
+		if n != int64(bufs[dataShards+i].Len()) {
+			t.Fatalf("校验分片 %d 写入 %d 字节，期望 %d", i, n, bufs[dataShards+i].Len())
+		}
+	}
+
+	// 重建：丢失的分片不计入读取
+	reset()
+	inputs := make([]io.Reader, len(bufs))
+	outputs := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		inputs[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	inputs[0] = nil
+	var rebuilt bytes.Buffer
+	outputs[0] = &rebuilt
+	if err := enc.StreamReconstruct(inputs, outputs); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].BytesRead[0] != 0 || stats[0].BytesWritten[0] != int64(rebuilt.Len()) || stats[0].ComputeTime == 0 {
+		t.Fatalf("重建统计错误: %+v", stats)
+	}
+	if !bytes.Equal(rebuilt.Bytes(), bufs[0].Bytes()) {
+		t.Fatal("重建的分片不一致")
+	}
+
+	// 合并：按写出的字节数报告进度
+	reset()
+	for i := range readers {
+		readers[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	var out bytes.Buffer
+	if err := enc.StreamJoin(&out, readers, int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("合并结果不一致")
+	}
+	if len(progress) == 0 || progress[len(progress)-1].BytesProcessed != int64(len(data)) {
+		t.Fatalf("合并进度错误: %+v", progress)
+	}
+	if len(stats) != 1 || stats[0].TotalWritten() != int64(len(data)) || stats[0].ComputeTime != 0 {
+		t.Fatalf("合并统计错误: %+v", stats)
+	}
+}
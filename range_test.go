@@ -0,0 +1,125 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// countReaderAt 记录读取的范围
+type countReaderAt struct {
+	r      *bytes.Reader
+	lo, hi int64
+	reads  int
+}
+
+func (c *countReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if c.reads == 0 || off < c.lo {
+		c.lo = off
+	}
+	if end := off + int64(len(p)); end > c.hi {
+		c.hi = end
+	}
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+// 测试按范围重建数据分片和校验分片中的一段
+func TestReconstructRange(t *testing.T) {
+	testReconstructRange(t, 6, 3)
+	testReconstructRange(t, 300, 20)
+}
+
+func testReconstructRange(t *testing.T, dataShards, parityShards int) {
+	enc, err := New(dataShards, parityShards, WithStreamBlockSize(128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 * 100
+	shards := enc.AllocAligned(enc.TotalShards(), size)
+	rng := rand.New(rand.NewSource(int64(dataShards)))
+	for i := 0; i < dataShards; i++ {
+		rng.Read(shards[i])
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	ranges := [][2]int{{0, size}, {100, 1}, {64, 64}, {1000, 333}, {size - 5, 5}}
+	for _, idx := range []int{0, dataShards - 1, dataShards, enc.TotalShards() - 1} {
+		// 另外丢失一个分片，重建时不能依赖它
+		work := append([][]byte(nil), shards...)
+		work[(idx+1)%len(work)] = nil
+		for _, rg := range ranges {
+			off, n := rg[0], rg[1]
+			want := shards[idx][off : off+n]
+			got, err := enc.ReconstructRange(work, idx, off, n)
+			if err != nil {
+				t.Fatalf("分片 %d 范围 %v: %v", idx, rg, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("分片 %d 范围 %v 不一致", idx, rg)
+			}
+
+			inputs := make([]io.ReaderAt, len(work))
+			counters := make([]*countReaderAt, len(work))
+			for i, s := range work {
+				if s != nil {
+					counters[i] = &countReaderAt{r: bytes.NewReader(s)}
+					inputs[i] = counters[i]
+				}
+			}
+			var out bytes.Buffer
+			if err := enc.StreamReconstructRange(inputs, idx, int64(off), int64(n), &out); err != nil {
+				t.Fatalf("分片 %d 范围 %v: %v", idx, rg, err)
+			}
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("分片 %d 范围 %v 流式重建不一致", idx, rg)
+			}
+			// 只读取 k 个分片中对齐后的窗口
+			read := 0
+			for i, c := range counters {
+				if c == nil || c.reads == 0 {
+					continue
+				}
+				read++
+				if i == idx || c.lo != int64(off&^63) || c.hi != int64((off+n+63)&^63) {
+					t.Fatalf("分片 %d 范围 %v: 分片 %d 读取了 [%d, %d)", idx, rg, i, c.lo, c.hi)
+				}
+			}
+			if read != dataShards {
+				t.Fatalf("分片 %d 范围 %v: 读取了 %d 个分片", idx, rg, read)
+			}
+		}
+	}
+}
+
+// 测试无效的参数
+func TestReconstructRangeErrors(t *testing.T) {
+	enc, _ := New(4, 2)
+	shards := enc.AllocAligned(6, 128)
+	if _, err := enc.ReconstructRange(shards, 6, 0, 1); err != ErrInvalidInput {
+		t.Fatalf("期望 ErrInvalidInput，实际 %v", err)
+	}
+	for _, rg := range [][2]int{{-1, 2}, {0, 0}, {100, 29}} {
+		if _, err := enc.ReconstructRange(shards, 0, rg[0], rg[1]); err != ErrSize {
+			t.Fatalf("范围 %v: 期望 ErrSize，实际 %v", rg, err)
+		}
+	}
+	shards[1], shards[2] = nil, nil
+	if _, err := enc.ReconstructRange(shards, 0, 0, 1); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+
+	inputs := make([]io.ReaderAt, 6)
+	for i := range inputs {
+		inputs[i] = bytes.NewReader(make([]byte, 128))
+	}
+	if err := enc.StreamReconstructRange(inputs, 0, 256, 10, io.Discard); err != ErrShortData {
+		t.Fatalf("期望 ErrShortData，实际 %v", err)
+	}
+	if err := enc.StreamReconstructRange(inputs, 0, 0, 10, nil); err != ErrNilWriter {
+		t.Fatalf("期望 ErrNilWriter，实际 %v", err)
+	}
+}
@@ -30,6 +30,29 @@ var (
 	ErrReconstructMismatch = errors.New("一个分片不能同时是输入和输出")
 	ErrNilWriter           = errors.New("目标写入器不能为nil")
 	ErrSize                = errors.New("无效的大小参数")
+	// 清单相关错误
+	ErrInvalidManifest   = errors.New("无效的分片集清单")
+	ErrShardHashMismatch = errors.New("分片摘要与清单不匹配")
+	// 检查点相关错误
+	ErrInvalidCheckpoint = errors.New("检查点与当前操作不匹配")
+	// 分片存储相关错误
+	ErrInvalidObjectID = errors.New("无效的对象 id")
+	ErrPlacement       = errors.New("分片数量超过存储位置数量，无法分散放置")
+	ErrDirChanged      = errors.New("存储目录不存在或已不在原来的设备上")
+	// 多路径传输相关错误
+	ErrMultipathFrame = errors.New("无效的多路径传输帧")
+	ErrPathStalled    = errors.New("连接停滞，其余连接已送出足够的分片")
+	// 压缩相关错误
+	ErrUnknownCompressor = errors.New("未知的压缩算法")
+	ErrCompressHeader    = errors.New("无效的压缩数据头")
+	// 加密相关错误
+	ErrSealAuth = errors.New("加密数据认证失败")
+	// 秘密共享相关错误
+	ErrInvalidShare = errors.New("无效的秘密份额")
+	// AONT 相关错误
+	ErrAONTIntegrity = errors.New("AONT 数据完整性校验失败")
+	// 重建计划相关错误
+	ErrPlanMismatch = errors.New("分片丢失情况与重建计划不一致")
 )
 
 // ReedSolomon 接口定义了Reed-Solomon编解码器的通用操作
@@ -56,6 +79,23 @@ type ReedSolomon interface {
 	StreamSplit(data io.Reader, dst []io.Writer, size int64) error       // 流式拆分
 	StreamJoin(dst io.Writer, shards []io.Reader, outSize int64) error   // 流式合并
 
+	// 从检查点恢复的流式操作，输出与不中断时逐字节一致
+	StreamEncodeResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error      // 恢复流式编码
+	StreamReconstructResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error // 恢复流式重建
+
+	// 检查可用分片是否足以重建，present 的长度必须等于总分片数
+	CanReconstruct(present []bool) bool
+
+	// 按需打开分片的流式重建，只打开 k 个输入分片和需要重建的分片
+	StreamReconstructShards(opener ShardOpener, present, rebuild []bool) error
+
+	// 只重建分片中的一段，读取 k 个分片中对齐后的同一窗口
+	ReconstructRange(shards [][]byte, missingIdx, offset, length int) ([]byte, error)
+	StreamReconstructRange(inputs []io.ReaderAt, missingIdx int, offset, length int64, out io.Writer) error
+
+	// 为固定的丢失情况预先计算重建计划，计划可以并发地重复使用
+	PlanReconstruct(present []bool) (Plan, error)
+
 	// 内存管理
 	AllocAligned(shards, each int) [][]byte // 分配对齐的内存
 	ShardSizeMultiple() int                 // 返回分片大小需要满足的倍数
@@ -66,7 +106,7 @@ type ReedSolomon interface {
 
 // New 创建一个新的Reed-Solomon编解码器
 // 如果总分片数 <= 256，将使用GF(2^8)实现，否则使用GF(2^16)实现
-func New(dataShards, parityShards int) (ReedSolomon, error) {
+func New(dataShards, parityShards int, opts ...Option) (ReedSolomon, error) {
 	if dataShards <= 0 || parityShards <= 0 {
 		return nil, ErrInvShardNum
 	}
@@ -75,31 +115,33 @@ func New(dataShards, parityShards int) (ReedSolomon, error) {
 
 	// 根据分片数量选择合适的实现
 	if totalShards <= 256 {
-		return New8(dataShards, parityShards)
+		return New8(dataShards, parityShards, opts...)
 	}
-	return New16(dataShards, parityShards)
+	return New16(dataShards, parityShards, opts...)
 }
 
 // New8 创建一个基于GF(2^8)的Reed-Solomon编解码器，最多支持256个分片
-func New8(dataShards, parityShards int) (ReedSolomon, error) {
+func New8(dataShards, parityShards int, opts ...Option) (ReedSolomon, error) {
 	// 调用内部实现函数
-	return newReedSolomon8(dataShards, parityShards)
+	return newReedSolomon8(dataShards, parityShards, newStreamOptions(opts))
 }
 
 // New16 创建一个基于GF(2^16)的Reed-Solomon编解码器，最多支持65535个分片
-func New16(dataShards, parityShards int) (ReedSolomon, error) {
+func New16(dataShards, parityShards int, opts ...Option) (ReedSolomon, error) {
 	// 调用内部实现函数
-	return newReedSolomon16(dataShards, parityShards)
+	return newReedSolomon16(dataShards, parityShards, newStreamOptions(opts))
 }
 
 // 包装 leopardFF8 的结构体，实现完整的 ReedSolomon 接口
 type rsFF8 struct {
 	*leopardFF8
+	o streamOptions // 流式操作选项
 }
 
 // 包装 leopardFF16 的结构体，实现完整的 ReedSolomon 接口
 type rsFF16 struct {
 	*leopardFF16
+	o streamOptions // 流式操作选项
 }
 
 // AllocAligned 实现 ReedSolomon 接口中的 AllocAligned 方法
@@ -129,7 +171,7 @@ func (r *rsFF8) StreamEncode(inputs []io.Reader, outputs []io.Writer) error {
 		return ErrTooFewShards
 	}
 
-	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -144,7 +186,7 @@ func (r *rsFF8) StreamVerify(shards []io.Reader) (bool, error) {
 	}
 
 	// 创建流式编码器
-	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return false, err
 	}
@@ -158,6 +200,76 @@ func (r *rsFF8) StreamReconstruct(inputs []io.Reader, outputs []io.Writer) error
 		return ErrTooFewShards
 	}
 
+	// 创建流式编码器
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	return r.streamReconstruct(enc, inputs, outputs)
+}
+
+// StreamEncodeResume 从检查点恢复流式编码
+// inputs 和 outputs 会被定位到检查点记录的偏移，之后的输出与不中断时逐字节一致。
+func (r *rsFF8) StreamEncodeResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error {
+	if len(inputs) != r.dataShards || len(outputs) != r.parityShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	in, out, err := seekToCheckpoint(cp, StreamOpEncode, enc.blockSize, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	enc.resume = cp
+	return enc.encode(in, out)
+}
+
+// StreamReconstructResume 从检查点恢复流式重建
+// inputs 和 outputs 的nil位置必须与产生检查点的 StreamReconstruct 调用一致。
+func (r *rsFF8) StreamReconstructResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error {
+	if len(inputs) != r.totalShards || len(outputs) != r.totalShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	in, out, err := seekToCheckpoint(cp, StreamOpReconstruct, enc.blockSize, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	enc.resume = cp
+	return r.streamReconstruct(enc, in, out)
+}
+
+// CanReconstruct 检查可用分片是否足以重建
+func (r *rsFF8) CanReconstruct(present []bool) bool {
+	return canReconstruct(present, r.dataShards, r.totalShards)
+}
+
+// StreamReconstructShards 通过 opener 按需打开分片进行流式重建
+// present 标记可以读取的分片，rebuild 标记需要重建的分片，长度都必须等于总分片数。
+// 只会打开 k 个输入分片（按 ShardCoster 的代价选择）和需要重建的分片，结束后全部关闭。
+func (r *rsFF8) StreamReconstructShards(opener ShardOpener, present, rebuild []bool) error {
+	if len(present) != r.totalShards || len(rebuild) != r.totalShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	return openShards(opener, r.dataShards, present, rebuild, func(inputs []io.Reader, outputs []io.Writer) error {
+		return r.streamReconstruct(enc, inputs, outputs)
+	})
+}
+
+// streamReconstruct 根据输出选择完整重建或只重建数据分片
+func (r *rsFF8) streamReconstruct(enc *rsStreamFF8, inputs []io.Reader, outputs []io.Writer) error {
 	// 确保不会同时尝试从同一个分片读取和写入
 	for i := range inputs {
 		if inputs[i] != nil && outputs[i] != nil {
@@ -165,12 +277,6 @@ func (r *rsFF8) StreamReconstruct(inputs []io.Reader, outputs []io.Writer) error
 		}
 	}
 
-	// 创建流式编码器
-	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards)
-	if err != nil {
-		return err
-	}
-
 	// 确定是否只需要重建数据分片
 	onlyData := true
 	for i := r.dataShards; i < r.totalShards; i++ {
@@ -206,7 +312,7 @@ func (r *rsFF8) StreamSplit(data io.Reader, dst []io.Writer, size int64) error {
 		return ErrTooFewShards
 	}
 
-	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -219,7 +325,7 @@ func (r *rsFF8) StreamJoin(dst io.Writer, shards []io.Reader, outSize int64) err
 		return ErrNilWriter
 	}
 
-	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF8(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -237,7 +343,7 @@ func (r *rsFF16) StreamEncode(inputs []io.Reader, outputs []io.Writer) error {
 		return ErrTooFewShards
 	}
 
-	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -252,7 +358,7 @@ func (r *rsFF16) StreamVerify(shards []io.Reader) (bool, error) {
 	}
 
 	// 创建流式编码器
-	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return false, err
 	}
@@ -266,6 +372,76 @@ func (r *rsFF16) StreamReconstruct(inputs []io.Reader, outputs []io.Writer) erro
 		return ErrTooFewShards
 	}
 
+	// 创建流式编码器
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	return r.streamReconstruct(enc, inputs, outputs)
+}
+
+// StreamEncodeResume 从检查点恢复流式编码
+// inputs 和 outputs 会被定位到检查点记录的偏移，之后的输出与不中断时逐字节一致。
+func (r *rsFF16) StreamEncodeResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error {
+	if len(inputs) != r.dataShards || len(outputs) != r.parityShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	in, out, err := seekToCheckpoint(cp, StreamOpEncode, enc.blockSize, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	enc.resume = cp
+	return enc.encode(in, out)
+}
+
+// StreamReconstructResume 从检查点恢复流式重建
+// inputs 和 outputs 的nil位置必须与产生检查点的 StreamReconstruct 调用一致。
+func (r *rsFF16) StreamReconstructResume(inputs []io.ReadSeeker, outputs []io.WriteSeeker, cp *Checkpoint) error {
+	if len(inputs) != r.totalShards || len(outputs) != r.totalShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	in, out, err := seekToCheckpoint(cp, StreamOpReconstruct, enc.blockSize, inputs, outputs)
+	if err != nil {
+		return err
+	}
+	enc.resume = cp
+	return r.streamReconstruct(enc, in, out)
+}
+
+// CanReconstruct 检查可用分片是否足以重建
+func (r *rsFF16) CanReconstruct(present []bool) bool {
+	return canReconstruct(present, r.dataShards, r.totalShards)
+}
+
+// StreamReconstructShards 通过 opener 按需打开分片进行流式重建
+// present 标记可以读取的分片，rebuild 标记需要重建的分片，长度都必须等于总分片数。
+// 只会打开 k 个输入分片（按 ShardCoster 的代价选择）和需要重建的分片，结束后全部关闭。
+func (r *rsFF16) StreamReconstructShards(opener ShardOpener, present, rebuild []bool) error {
+	if len(present) != r.totalShards || len(rebuild) != r.totalShards {
+		return ErrTooFewShards
+	}
+
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
+	if err != nil {
+		return err
+	}
+	return openShards(opener, r.dataShards, present, rebuild, func(inputs []io.Reader, outputs []io.Writer) error {
+		return r.streamReconstruct(enc, inputs, outputs)
+	})
+}
+
+// streamReconstruct 根据输出选择完整重建或只重建数据分片
+func (r *rsFF16) streamReconstruct(enc *rsStream16, inputs []io.Reader, outputs []io.Writer) error {
 	// 确保不会同时尝试从同一个分片读取和写入
 	for i := range inputs {
 		if inputs[i] != nil && outputs[i] != nil {
@@ -273,12 +449,6 @@ func (r *rsFF16) StreamReconstruct(inputs []io.Reader, outputs []io.Writer) erro
 		}
 	}
 
-	// 创建流式编码器
-	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards)
-	if err != nil {
-		return err
-	}
-
 	// 确定是否只需要重建数据分片
 	onlyData := true
 	for i := r.dataShards; i < r.totalShards; i++ {
@@ -314,7 +484,7 @@ func (r *rsFF16) StreamSplit(data io.Reader, dst []io.Writer, size int64) error
 		return ErrTooFewShards
 	}
 
-	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -327,7 +497,7 @@ func (r *rsFF16) StreamJoin(dst io.Writer, shards []io.Reader, outSize int64) er
 		return ErrNilWriter
 	}
 
-	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards)
+	enc, err := newStreamEncoderFF16(r.dataShards, r.parityShards, r.o)
 	if err != nil {
 		return err
 	}
@@ -336,21 +506,21 @@ func (r *rsFF16) StreamJoin(dst io.Writer, shards []io.Reader, outSize int64) er
 }
 
 // newReedSolomon8 创建基于GF(2^8)的Reed-Solomon编解码器的内部实现
-func newReedSolomon8(dataShards, parityShards int) (ReedSolomon, error) {
+func newReedSolomon8(dataShards, parityShards int, o streamOptions) (ReedSolomon, error) {
 	ff8, err := newFF8(dataShards, parityShards)
 	if err != nil {
 		return nil, err
 	}
-	return &rsFF8{ff8}, nil
+	return &rsFF8{leopardFF8: ff8, o: o}, nil
 }
 
 // newReedSolomon16 创建基于GF(2^16)的Reed-Solomon编解码器的内部实现
-func newReedSolomon16(dataShards, parityShards int) (ReedSolomon, error) {
+func newReedSolomon16(dataShards, parityShards int, o streamOptions) (ReedSolomon, error) {
 	ff16, err := newFF16(dataShards, parityShards)
 	if err != nil {
 		return nil, err
 	}
-	return &rsFF16{ff16}, nil
+	return &rsFF16{leopardFF16: ff16, o: o}, nil
 }
 
 // Extensions is an optional interface.
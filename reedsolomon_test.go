@@ -113,6 +113,46 @@ func TestReconstructData(t *testing.T) {
 	testReconstruction(t, 10, 4, mediumTestSize, true, true)
 }
 
+// 测试同一个编码器依次重建不同的丢失组合，反转缓存不能混用
+func TestReconstructReuse(t *testing.T) {
+	r, err := New8(4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := r.AllocAligned(8, 64)
+	for i := 0; i < 4; i++ {
+		rand.Read(shards[i])
+	}
+	if err := r.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	patterns := [][]int{{1, 4, 5, 7}, {1, 5}, {1, 4, 5, 7}, {0, 6}, {0}, {0, 6}}
+	for _, dataOnly := range []bool{true, false} {
+		for _, pattern := range patterns {
+			work := make([][]byte, len(shards))
+			for i := range shards {
+				work[i] = append([]byte(nil), shards[i]...)
+			}
+			for _, i := range pattern {
+				work[i] = nil
+			}
+			if dataOnly {
+				err = r.ReconstructData(work)
+			} else {
+				err = r.Reconstruct(work)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range shards {
+				if (i < 4 || !dataOnly) && !bytes.Equal(work[i], shards[i]) {
+					t.Fatalf("丢失 %v 时分片 %d 重建结果不正确 (仅数据=%v)", pattern, i, dataOnly)
+				}
+			}
+		}
+	}
+}
+
 // 测试验证功能
 func TestVerify(t *testing.T) {
 	testVerify(t, 10, 4, smallTestSize, false)
@@ -1504,3 +1544,53 @@ func contains(slice []int, val int) bool {
 	}
 	return false
 }
+
+// 测试流式重建时没有请求输出的丢失分片仍被视为丢失，而不是当作全0的可用分片
+func TestStreamReconstructUnrequestedMissing(t *testing.T) {
+	testStreamReconstructUnrequestedMissing(t, false)
+	testStreamReconstructUnrequestedMissing(t, true)
+}
+
+func testStreamReconstructUnrequestedMissing(t *testing.T, useFF16 bool) {
+	var r ReedSolomon
+	var err error
+	if useFF16 {
+		r, err = New16(6, 3)
+	} else {
+		r, err = New8(6, 3)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := r.AllocAligned(9, 64*8)
+	for i := 0; i < 6; i++ {
+		rand.Read(shards[i])
+	}
+	if err := r.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+
+	// 分片0、1和校验分片6丢失，只请求重建分片0（以及在完整重建中的分片6）
+	for _, rebuild := range [][]int{{0}, {0, 6}} {
+		inputs := make([]io.Reader, 9)
+		for i := range inputs {
+			if i != 0 && i != 1 && i != 6 {
+				inputs[i] = bytes.NewReader(shards[i])
+			}
+		}
+		outputs := make([]io.Writer, 9)
+		bufs := make([]*bytes.Buffer, 9)
+		for _, i := range rebuild {
+			bufs[i] = &bytes.Buffer{}
+			outputs[i] = bufs[i]
+		}
+		if err := r.StreamReconstruct(inputs, outputs); err != nil {
+			t.Fatalf("重建 %v: %v", rebuild, err)
+		}
+		for _, i := range rebuild {
+			if !bytes.Equal(bufs[i].Bytes(), shards[i]) {
+				t.Fatalf("重建 %v: 分片 %d 不一致", rebuild, i)
+			}
+		}
+	}
+}
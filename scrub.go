@@ -0,0 +1,472 @@
+/**
+ * Reed-Solomon 编码库 - 后台校验和修复
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ObjectLister 是 ShardStore 可选实现的接口，返回存储中所有对象的 id
+// Scrubber.Scrub 在没有指定 id 时用它遍历存储。
+type ObjectLister interface {
+	Objects() ([]string, error)
+}
+
+// ScrubOptions 配置后台校验
+type ScrubOptions struct {
+	BytesPerSecond int64              // 校验和修复读取的总速率上限，0 表示不限速
+	BlockSize      int                // 每次读取的块大小，默认 1MB
+	Workers        int                // 并发修复的对象数量，默认 1
+	OnScrub        func(ScrubResult)  // 每校验完一个对象调用一次
+	OnRepair       func(RepairResult) // 每修复完一个对象调用一次
+	Options        []Option           // 创建修复用的编解码器时使用的选项
+}
+
+// ScrubResult 是一个对象的校验结果
+type ScrubResult struct {
+	ID      string
+	Missing []int // 无法读取的分片
+	Damaged []int // 长度或摘要与清单不一致的分片
+	Spare   int   // 完好分片数量减去数据分片数量，小于0表示无法恢复
+	Err     error // 读取清单失败或无法恢复时的错误
+}
+
+// Healthy 报告对象的所有分片是否完好
+func (r ScrubResult) Healthy() bool {
+	return r.Err == nil && len(r.Missing) == 0 && len(r.Damaged) == 0
+}
+
+// RepairResult 是一个对象的修复结果
+type RepairResult struct {
+	ID       string
+	Repaired []int // 重新生成的分片
+	Err      error
+}
+
+// Scrubber 逐块校验存储中的分片集，把需要修复的对象放入优先队列，
+// 由修复 worker 用 StreamReconstruct 重新生成丢失或损坏的分片。
+// 剩余冗余越少（Spare 越小）的对象越先修复。
+type Scrubber struct {
+	store   ShardStore
+	opts    ScrubOptions
+	limiter *rateLimiter
+
+	mu     sync.Mutex
+	queue  repairQueue
+	queued map[string]bool
+	seq    int
+}
+
+// NewScrubber 创建后台校验器
+func NewScrubber(store ShardStore, opts ScrubOptions) *Scrubber {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 1 << 20
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	return &Scrubber{
+		store:   store,
+		opts:    opts,
+		limiter: newRateLimiter(opts.BytesPerSecond),
+		queued:  make(map[string]bool),
+	}
+}
+
+// Scrub 校验指定的对象，没有指定时校验存储中的所有对象
+// 需要修复且可以修复的对象进入修复队列。存储没有实现 ObjectLister 且没有指定 id 时返回 ErrNotSupported。
+func (s *Scrubber) Scrub(ctx context.Context, ids ...string) ([]ScrubResult, error) {
+	if len(ids) == 0 {
+		l, ok := s.store.(ObjectLister)
+		if !ok {
+			return nil, ErrNotSupported
+		}
+		var err error
+		if ids, err = l.Objects(); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]ScrubResult, 0, len(ids))
+	for _, id := range ids {
+		r, err := s.ScrubObject(ctx, id)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// ScrubObject 校验一个对象的所有分片
+// 返回的错误只表示校验被取消；对象本身的问题记录在 ScrubResult 中。
+func (s *Scrubber) ScrubObject(ctx context.Context, id string) (ScrubResult, error) {
+	r := ScrubResult{ID: id}
+	m, err := loadManifest(s.store, id)
+	if err != nil {
+		r.Err = err
+		s.report(r)
+		return r, nil
+	}
+	ok := 0
+	for i := 0; i < m.TotalShards(); i++ {
+		err := s.checkShard(ctx, id, m, i)
+		switch {
+		case err == nil:
+			ok++
+		case ctx.Err() != nil:
+			return r, ctx.Err()
+		case errors.Is(err, ErrShardHashMismatch):
+			r.Damaged = append(r.Damaged, i)
+		default:
+			r.Missing = append(r.Missing, i)
+		}
+	}
+	r.Spare = ok - m.DataShards
+	if r.Spare < 0 {
+		r.Err = ErrTooFewShards
+	}
+	if !r.Healthy() && r.Err == nil {
+		s.enqueue(r)
+	}
+	s.report(r)
+	return r, nil
+}
+
+func (s *Scrubber) report(r ScrubResult) {
+	if s.opts.OnScrub != nil {
+		s.opts.OnScrub(r)
+	}
+}
+
+// checkShard 按块读取分片并与清单比较
+func (s *Scrubber) checkShard(ctx context.Context, id string, m *Manifest, i int) error {
+	rc, err := s.store.Get(id, i)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	buf := make([]byte, s.opts.BlockSize)
+	var n int64
+	for {
+		c, err := io.ReadFull(rc, buf)
+		if c > 0 {
+			if werr := s.limiter.wait(ctx, c); werr != nil {
+				return werr
+			}
+			h.Write(buf[:c])
+			n += int64(c)
+			if n > m.ShardLen(i) {
+				return ErrShardHashMismatch
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if n != m.ShardLen(i) || Digest(h.Sum(nil)) != m.ShardHashes[i] {
+		return ErrShardHashMismatch
+	}
+	return nil
+}
+
+// Pending 按修复顺序返回队列中等待修复的对象
+func (s *Scrubber) Pending() []ScrubResult {
+	s.mu.Lock()
+	q := make(repairQueue, len(s.queue))
+	copy(q, s.queue)
+	s.mu.Unlock()
+
+	var out []ScrubResult
+	for q.Len() > 0 {
+		out = append(out, heap.Pop(&q).(*repairItem).r)
+	}
+	return out
+}
+
+func (s *Scrubber) enqueue(r ScrubResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queued[r.ID] {
+		return
+	}
+	s.queued[r.ID] = true
+	s.seq++
+	heap.Push(&s.queue, &repairItem{r: r, seq: s.seq})
+}
+
+func (s *Scrubber) dequeue() (ScrubResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue.Len() == 0 {
+		return ScrubResult{}, false
+	}
+	r := heap.Pop(&s.queue).(*repairItem).r
+	delete(s.queued, r.ID)
+	return r, true
+}
+
+// Repair 用 Workers 个 worker 修复队列中的所有对象，队列为空或 ctx 取消时返回
+// 单个对象的修复错误通过 OnRepair 报告，不会中止其他对象的修复。
+func (s *Scrubber) Repair(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for w := 0; w < s.opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				r, ok := s.dequeue()
+				if !ok {
+					return
+				}
+				res := s.repair(ctx, r)
+				if s.opts.OnRepair != nil {
+					s.opts.OnRepair(res)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Run 每隔 interval 校验一遍存储并修复发现的问题，直到 ctx 取消
+func (s *Scrubber) Run(ctx context.Context, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := s.Scrub(ctx); err != nil {
+			return err
+		}
+		if err := s.Repair(ctx); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// repair 重新生成一个对象中丢失或损坏的分片
+func (s *Scrubber) repair(ctx context.Context, r ScrubResult) RepairResult {
+	res := RepairResult{ID: r.ID}
+	m, err := loadManifest(s.store, r.ID)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	enc, err := m.NewEncoder(s.opts.Options...)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	present := make([]bool, m.TotalShards())
+	rebuild := make([]bool, m.TotalShards())
+	for i := range present {
+		present[i] = true
+	}
+	for _, list := range [][]int{r.Missing, r.Damaged} {
+		for _, i := range list {
+			present[i] = false
+			rebuild[i] = true
+			res.Repaired = append(res.Repaired, i)
+		}
+	}
+	o := &repairOpener{ctx: ctx, s: s, id: r.ID, m: m}
+	if err := enc.StreamReconstructShards(o, present, rebuild); err != nil {
+		res.Err = err
+	}
+	return res
+}
+
+// repairOpener 从存储读取分片（受速率限制），重建结果校验摘要后原子地写回存储
+type repairOpener struct {
+	ctx context.Context
+	s   *Scrubber
+	id  string
+	m   *Manifest
+}
+
+func (o *repairOpener) OpenShard(i int) (io.ReadCloser, error) {
+	rc, err := o.s.store.Get(o.id, i)
+	if err != nil {
+		return nil, err
+	}
+	pad := o.m.ShardSize - o.m.ShardLen(i)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(&limitedReader{r: rc, ctx: o.ctx, l: o.s.limiter}, io.LimitReader(zeroReader{}, pad)), rc}, nil
+}
+
+func (o *repairOpener) CreateShard(i int) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := o.s.store.Put(o.id, i, pr)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	return &repairWriter{pw: pw, done: done, h: sha256.New(), limit: o.m.ShardLen(i), want: o.m.ShardHashes[i]}, nil
+}
+
+// repairWriter 把重建结果的前 limit 字节写入存储，摘要一致时才提交
+type repairWriter struct {
+	pw    *io.PipeWriter
+	done  chan error
+	h     hash.Hash
+	n     int64
+	limit int64
+	want  Digest
+}
+
+func (w *repairWriter) Write(p []byte) (int, error) {
+	if rest := w.limit - w.n; rest > 0 {
+		b := p[:min(int64(len(p)), rest)]
+		w.h.Write(b)
+		if _, err := w.pw.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func (w *repairWriter) Close() error {
+	if w.n < w.limit || Digest(w.h.Sum(nil)) != w.want {
+		// 中断写入，存储不会保存这个分片
+		w.pw.CloseWithError(ErrShardHashMismatch)
+		<-w.done
+		return ErrShardHashMismatch
+	}
+	w.pw.Close()
+	return <-w.done
+}
+
+// limitedReader 按速率限制读取
+type limitedReader struct {
+	r   io.Reader
+	ctx context.Context
+	l   *rateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// loadManifest 读取对象的清单
+func loadManifest(store ShardStore, id string) (*Manifest, error) {
+	rc, err := store.Get(id, ManifestIndex)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		// ObjectStore.Put 占用 id 时写入的空清单，对象还没有写完
+		return nil, fmt.Errorf("%s: %w", id, fs.ErrNotExist)
+	}
+	m := new(Manifest)
+	if err := m.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// rateLimiter 限制每秒读取的字节数，rate 为0时不限速
+type rateLimiter struct {
+	rate int64
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate}
+}
+
+// wait 为 n 字节预留时间并等待到预留的时间点
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// repairItem 是修复队列中的一项
+type repairItem struct {
+	r   ScrubResult
+	seq int
+}
+
+// repairQueue 按剩余冗余从少到多排列，相同时先进先出
+type repairQueue []*repairItem
+
+func (q repairQueue) Len() int { return len(q) }
+
+func (q repairQueue) Less(i, j int) bool {
+	if q[i].r.Spare != q[j].r.Spare {
+		return q[i].r.Spare < q[j].r.Spare
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q repairQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *repairQueue) Push(x any) { *q = append(*q, x.(*repairItem)) }
+
+func (q *repairQueue) Pop() any {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,204 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDirStore 在临时目录下创建 n 个目录组成的分片存储
+func newTestDirStore(t *testing.T, n int) *DirStore {
+	t.Helper()
+	root := t.TempDir()
+	dirs := make([]string, n)
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, fmt.Sprintf("disk%d", i))
+		if err := os.Mkdir(dirs[i], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds, err := NewDirStore(dirs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+// 测试校验发现丢失和损坏的分片，按剩余冗余排序修复
+func TestScrubber(t *testing.T) {
+	testScrubber(t, 10, 4, false)
+	testScrubber(t, 250, 10, true)
+}
+
+func testScrubber(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := newTestDirStore(t, dataShards+parityShards)
+	store := NewObjectStore(ds, enc)
+
+	objects := map[string][]byte{}
+	for n, id := range []string{"a", "b", "c", "d"} {
+		data := make([]byte, 50000+n*1000)
+		rand.New(rand.NewSource(int64(n))).Read(data)
+		if _, err := store.Put(id, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+		objects[id] = data
+	}
+
+	shardFile := func(id string, i int) string {
+		return filepath.Join(must(ds.ShardDir(id, i)), id, fmt.Sprint(i))
+	}
+	remove := func(id string, idx ...int) {
+		for _, i := range idx {
+			if err := os.Remove(shardFile(id, i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	corrupt := func(id string, idx ...int) {
+		for _, i := range idx {
+			p := shardFile(id, i)
+			b, err := os.ReadFile(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b[len(b)-1] ^= 0x80
+			if err := os.WriteFile(p, b, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// a 剩余冗余 m-1，b 剩余 m-3（丢失两个、损坏一个），c 剩余 m-2
+	remove("a", 0)
+	remove("b", 1, dataShards+1)
+	corrupt("b", dataShards-1)
+	corrupt("c", 2, dataShards)
+
+	var repaired []RepairResult
+	s := NewScrubber(ds, ScrubOptions{
+		BlockSize: 4096,
+		Workers:   1,
+		OnRepair:  func(r RepairResult) { repaired = append(repaired, r) },
+	})
+	ctx := context.Background()
+	results, err := s.Scrub(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("期望校验 4 个对象，实际 %d", len(results))
+	}
+	if !results[3].Healthy() || results[3].Spare != parityShards {
+		t.Fatalf("对象 d 应完好: %+v", results[3])
+	}
+	if len(results[1].Missing) != 2 || len(results[1].Damaged) != 1 {
+		t.Fatalf("对象 b 的校验结果 %+v", results[1])
+	}
+
+	var order []string
+	for _, r := range s.Pending() {
+		order = append(order, r.ID)
+	}
+	if fmt.Sprint(order) != "[b c a]" {
+		t.Fatalf("期望修复顺序 [b c a]，实际 %v", order)
+	}
+
+	if err := s.Repair(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(repaired) != 3 || repaired[0].ID != "b" {
+		t.Fatalf("修复结果 %+v", repaired)
+	}
+	for _, r := range repaired {
+		if r.Err != nil {
+			t.Fatalf("%s: %v", r.ID, r.Err)
+		}
+	}
+	if len(s.Pending()) != 0 {
+		t.Fatal("修复后队列应为空")
+	}
+
+	results, err = s.Scrub(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if !r.Healthy() {
+			t.Fatalf("修复后仍有问题: %+v", r)
+		}
+	}
+	for id, data := range objects {
+		rc, err := store.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		_, err = buf.ReadFrom(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("%s: 修复后读取失败: %v", id, err)
+		}
+	}
+
+	// 完好分片不足的对象不进入修复队列
+	remove("d", makeRange(0, parityShards+1)...)
+	r, err := s.ScrubObject(ctx, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Err != ErrTooFewShards || r.Spare != -1 || len(s.Pending()) != 0 {
+		t.Fatalf("对象 d 的校验结果 %+v", r)
+	}
+}
+
+// 测试校验读取受速率限制，取消时立即返回
+func TestScrubberRateLimit(t *testing.T) {
+	enc, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds := newTestDirStore(t, 6)
+	data := make([]byte, 40000)
+	if _, err := NewObjectStore(ds, enc).Put("x", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 6 个分片约 60KB，按 200KB/s 至少需要约 0.25 秒
+	s := NewScrubber(ds, ScrubOptions{BytesPerSecond: 200000, BlockSize: 1024})
+	start := time.Now()
+	if _, err := s.Scrub(context.Background(), "x"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Fatalf("速率限制无效，用时 %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s = NewScrubber(ds, ScrubOptions{BytesPerSecond: 10000, BlockSize: 1024})
+	if _, err := s.Scrub(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("期望 context.DeadlineExceeded，实际 %v", err)
+	}
+}
+
+func makeRange(from, to int) []int {
+	r := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		r = append(r, i)
+	}
+	return r
+}
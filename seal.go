@@ -0,0 +1,632 @@
+/**
+ * Reed-Solomon 编码库 - 认证加密
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// 加密数据的格式:
+//
+//	magic(4) | version(1) | index(4) | segment(4) | object(16) | salt(32) | len(keyID)(1) | keyID | 各段密文
+//
+// 每段明文 segment 字节（最后一段可以更短，也可以为空），加密后附带16字节的认证标签。
+// 每份数据用密钥和随机盐经 HKDF-SHA256 派生独立的 AES 密钥，第 i 段的 nonce 为 i；
+// 整个头部和“是否为最后一段”作为附加认证数据，因此修改头部、截断、调换分片都会被发现。
+// object 是随机生成的对象 id，同一分片集的所有分片相同，用于发现混入的其他对象中序号相同的分片。
+const (
+	sealVersion   = 1
+	sealObjectLen = 16
+	sealSaltLen   = 32
+	sealFixedLen  = 62 // 不含 keyID 的头部长度
+	sealMaxSegLen = 16 << 20
+
+	// SealObjectIndex 是编码前加密整个对象时使用的序号
+	SealObjectIndex = -1
+
+	// DefaultSealSegment 是默认的加密分段大小
+	DefaultSealSegment = 64 << 10
+)
+
+// 加密数据的魔数
+var sealMagic = [4]byte{'R', 'S', 'E', 'C'}
+
+// KeyProvider 提供 AES-GCM 使用的密钥，密钥长度为 16、24 或 32 字节
+// 加密数据的头部记录加密时使用的密钥 id，解密时按 id 查找，因此可以轮换密钥。
+type KeyProvider interface {
+	EncryptionKey() (id string, key []byte, err error) // 加密新数据使用的密钥，id 不超过255字节
+	DecryptionKey(id string) ([]byte, error)           // 按 id 返回解密使用的密钥
+}
+
+// staticKey 是只有一个密钥的 KeyProvider
+type staticKey struct {
+	id  string
+	key []byte
+}
+
+// StaticKey 返回只有一个密钥的 KeyProvider
+func StaticKey(id string, key []byte) KeyProvider {
+	return staticKey{id: id, key: key}
+}
+
+func (k staticKey) EncryptionKey() (string, []byte, error) {
+	return k.id, k.key, nil
+}
+
+func (k staticKey) DecryptionKey(id string) ([]byte, error) {
+	if id != k.id {
+		return nil, ErrSealAuth
+	}
+	return k.key, nil
+}
+
+// Sealer 用 AES-GCM 加密并认证数据
+// 可以在编码前加密整个对象（序号 SealObjectIndex），也可以在编码后分别加密每个分片（序号为分片序号）。
+// 分片加密后，认证失败的分片在重建时被视为丢失，而不会污染解码结果。
+type Sealer struct {
+	keys    KeyProvider
+	segment int
+	object  *[sealObjectLen]byte // 绑定的对象 id，nil 时每份数据使用新的随机 id
+}
+
+// NewSealer 创建加密器，segment 为分段大小，0 表示 DefaultSealSegment
+func NewSealer(keys KeyProvider, segment int) (*Sealer, error) {
+	if segment == 0 {
+		segment = DefaultSealSegment
+	}
+	if keys == nil || segment < 0 || segment > sealMaxSegLen {
+		return nil, ErrInvalidInput
+	}
+	return &Sealer{keys: keys, segment: segment}, nil
+}
+
+// NewObject 返回使用相同密钥和分段大小、绑定一个新的随机对象 id 的加密器
+// 逐个分片调用 SealReader 或 SealWriter 加密同一分片集时，应使用同一个 NewObject 返回的加密器，
+// 使所有分片的对象 id 相同；s 本身每次加密都使用新的 id。
+func (s *Sealer) NewObject() (*Sealer, error) {
+	var id [sealObjectLen]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	return s.withObject(id), nil
+}
+
+// withObject 返回绑定对象 id 的加密器
+func (s *Sealer) withObject(id [sealObjectLen]byte) *Sealer {
+	return &Sealer{keys: s.keys, segment: s.segment, object: &id}
+}
+
+// sealStream 是一份加密数据的头部和派生出的 AEAD
+type sealStream struct {
+	header  []byte
+	object  [sealObjectLen]byte
+	segment int
+	aead    cipher.AEAD
+	aad     [2][]byte // 非最后一段和最后一段的附加认证数据
+}
+
+// newSealStream 根据头部和主密钥创建 AEAD
+func newSealStream(header []byte, segment int, key, salt []byte) (*sealStream, error) {
+	sub, err := hkdf.Key(sha256.New, key, salt, "reedsolomon16 seal", len(key))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(sub)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	st := &sealStream{header: header, segment: segment, aead: aead}
+	copy(st.object[:], header[13:])
+	for i := range st.aad {
+		st.aad[i] = append(append([]byte(nil), header...), byte(i))
+	}
+	return st, nil
+}
+
+// nonce 返回第 counter 段的 nonce
+func (st *sealStream) nonce(counter uint64) []byte {
+	var n [12]byte
+	binary.BigEndian.PutUint64(n[4:], counter)
+	return n[:]
+}
+
+// newStream 为序号 index 的数据生成新的头部
+func (s *Sealer) newStream(index int) (*sealStream, error) {
+	id, key, err := s.keys.EncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, ErrInvalidInput
+	}
+	h := make([]byte, 0, sealFixedLen+len(id))
+	h = append(h, sealMagic[:]...)
+	h = append(h, sealVersion)
+	h = binary.BigEndian.AppendUint32(h, uint32(int32(index)))
+	h = binary.BigEndian.AppendUint32(h, uint32(s.segment))
+	if s.object != nil {
+		h = append(h, s.object[:]...)
+	} else {
+		var id [sealObjectLen]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return nil, err
+		}
+		h = append(h, id[:]...)
+	}
+	salt := make([]byte, sealSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	h = append(h, salt...)
+	h = append(h, byte(len(id)))
+	h = append(h, id...)
+	return newSealStream(h, s.segment, key, salt)
+}
+
+// readStream 读取并检查头部，序号必须为 index
+func (s *Sealer) readStream(r io.Reader, index int) (*sealStream, error) {
+	h := make([]byte, sealFixedLen, sealFixedLen+255)
+	if _, err := io.ReadFull(r, h); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrSealAuth
+		}
+		return nil, err
+	}
+	segment := int(binary.BigEndian.Uint32(h[9:]))
+	if !bytes.Equal(h[:4], sealMagic[:]) || h[4] != sealVersion ||
+		int32(binary.BigEndian.Uint32(h[5:])) != int32(index) || segment <= 0 || segment > sealMaxSegLen {
+		return nil, ErrSealAuth
+	}
+	salt := h[13+sealObjectLen : 13+sealObjectLen+sealSaltLen]
+	h = h[:sealFixedLen+int(h[sealFixedLen-1])]
+	if _, err := io.ReadFull(r, h[sealFixedLen:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrSealAuth
+		}
+		return nil, err
+	}
+	key, err := s.keys.DecryptionKey(string(h[sealFixedLen:]))
+	if err != nil {
+		return nil, err
+	}
+	return newSealStream(h, segment, key, salt)
+}
+
+// sealedSize 返回头部长度为 header、明文为 n 字节时加密数据的大小
+func sealedSize(header, segment int, n int64) int64 {
+	segments := max((n+int64(segment)-1)/int64(segment), 1)
+	return int64(header) + n + segments*16
+}
+
+// sealReader 边读取明文边输出加密数据
+type sealReader struct {
+	st      *sealStream
+	r       *bufio.Reader
+	buf     []byte
+	out     []byte // 尚未读出的输出
+	counter uint64
+	done    bool
+	err     error
+}
+
+// Read 实现 io.Reader
+func (sr *sealReader) Read(p []byte) (int, error) {
+	for len(sr.out) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if sr.done {
+			return 0, io.EOF
+		}
+		sr.next()
+	}
+	n := copy(p, sr.out)
+	sr.out = sr.out[n:]
+	return n, nil
+}
+
+// next 加密下一段，读不满一段或之后没有数据时作为最后一段
+func (sr *sealReader) next() {
+	seg := sr.st.segment
+	n, err := io.ReadFull(sr.r, sr.buf[:seg])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		sr.err = err
+		return
+	}
+	final := n < seg
+	if !final {
+		if _, err := sr.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			sr.err = err
+			return
+		}
+	}
+	aad := sr.st.aad[0]
+	if final {
+		aad = sr.st.aad[1]
+	}
+	sr.out = sr.st.aead.Seal(sr.buf[seg:seg], sr.st.nonce(sr.counter), sr.buf[:n], aad)
+	sr.counter++
+	sr.done = final
+}
+
+// newSealReader 创建按 st 加密 r 的读取器
+func newSealReader(st *sealStream, r io.Reader) *sealReader {
+	return &sealReader{
+		st:  st,
+		r:   bufio.NewReader(r),
+		buf: make([]byte, st.segment, 2*st.segment+16),
+		out: st.header,
+	}
+}
+
+// SealReader 返回加密 r 中 size 字节明文的读取器，以及加密后的大小
+// 加密后的大小可以直接作为 StreamSplit 的 size，从而在编码前加密整个对象（index 为 SealObjectIndex）。
+func (s *Sealer) SealReader(r io.Reader, size int64, index int) (io.Reader, int64, error) {
+	st, err := s.newStream(index)
+	if err != nil {
+		return nil, 0, err
+	}
+	return newSealReader(st, io.LimitReader(r, size)), sealedSize(len(st.header), st.segment, size), nil
+}
+
+// SealWriter 返回把写入的明文加密后写入 w 的写入器，Close 写出最后一段
+func (s *Sealer) SealWriter(w io.Writer, index int) (io.WriteCloser, error) {
+	// 提前取得密钥，使密钥错误在创建时返回
+	st, err := s.newStream(index)
+	if err != nil {
+		return nil, err
+	}
+	return newFilterWriter(func(r io.Reader) error {
+		_, err := io.Copy(w, newSealReader(st, r))
+		return err
+	}), nil
+}
+
+// openReader 边读取加密数据边输出认证过的明文
+type openReader struct {
+	st      *sealStream
+	r       *bufio.Reader
+	buf     []byte
+	out     []byte
+	counter uint64
+	done    bool
+	err     error
+}
+
+// Read 实现 io.Reader
+func (or *openReader) Read(p []byte) (int, error) {
+	for len(or.out) == 0 {
+		if or.err != nil {
+			return 0, or.err
+		}
+		if or.done {
+			return 0, io.EOF
+		}
+		or.next()
+	}
+	n := copy(p, or.out)
+	or.out = or.out[n:]
+	return n, nil
+}
+
+// next 解密并认证下一段
+func (or *openReader) next() {
+	full := or.st.segment + 16
+	n, err := io.ReadFull(or.r, or.buf[:full])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		or.err = err
+		return
+	}
+	final := n < full
+	if !final {
+		if _, err := or.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			or.err = err
+			return
+		}
+	}
+	aad := or.st.aad[0]
+	if final {
+		aad = or.st.aad[1]
+	}
+	// 截断的数据缺少带最后一段标记的段，无法通过认证
+	out, err := or.st.aead.Open(or.buf[:0], or.st.nonce(or.counter), or.buf[:n], aad)
+	if err != nil {
+		or.err = ErrSealAuth
+		return
+	}
+	or.out = out
+	or.counter++
+	or.done = final
+}
+
+// OpenReader 返回解密 r 的读取器，r 必须是序号为 index 的加密数据
+// 每段在认证通过后才输出；头部无效、序号不符或任何一段认证失败时返回 ErrSealAuth。
+// 由于按段输出，认证失败之前已经读出的明文可能来自被截断的数据，需要完整读到 io.EOF 才能确认。
+func (s *Sealer) OpenReader(r io.Reader, index int) (io.Reader, error) {
+	return s.openStream(r, index)
+}
+
+// openStream 读取并检查头部，返回解密其后各段的读取器
+func (s *Sealer) openStream(r io.Reader, index int) (*openReader, error) {
+	br := bufio.NewReader(r)
+	st, err := s.readStream(br, index)
+	if err != nil {
+		return nil, err
+	}
+	return &openReader{st: st, r: br, buf: make([]byte, st.segment+16)}, nil
+}
+
+// OpenWriter 返回把写入的加密数据解密后写入 w 的写入器，Close 返回认证结果
+// 用于 StreamJoin 之后解密编码前加密的对象。
+func (s *Sealer) OpenWriter(w io.Writer, index int) io.WriteCloser {
+	return newFilterWriter(func(r io.Reader) error {
+		or, err := s.OpenReader(r, index)
+		if err == nil {
+			_, err = io.Copy(w, or)
+		}
+		if err != nil {
+			return err
+		}
+		// 读完剩余的数据，使写入端不会阻塞
+		_, err = io.Copy(io.Discard, r)
+		return err
+	})
+}
+
+// SealShards 用分片序号分别加密每个分片，nil 分片保持为nil；所有分片使用同一个新的对象 id
+func (s *Sealer) SealShards(shards [][]byte) ([][]byte, error) {
+	o, err := s.NewObject()
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([][]byte, len(shards))
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if sealed[i], err = o.sealShard(shard, i); err != nil {
+			return nil, err
+		}
+	}
+	return sealed, nil
+}
+
+// sealShard 加密一个分片
+func (s *Sealer) sealShard(shard []byte, index int) ([]byte, error) {
+	r, size, err := s.SealReader(bytes.NewReader(shard), int64(len(shard)), index)
+	if err != nil {
+		return nil, err
+	}
+	return readAllInto(make([]byte, 0, size), r)
+}
+
+// readAllInto 把 r 的全部内容追加到 b
+func readAllInto(b []byte, r io.Reader) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+// openShard 解密一个完整的加密分片，同时返回其对象 id
+func (s *Sealer) openShard(sealed []byte, index int) ([]byte, [sealObjectLen]byte, error) {
+	or, err := s.openStream(bytes.NewReader(sealed), index)
+	if err != nil {
+		return nil, [sealObjectLen]byte{}, err
+	}
+	shard, err := readAllInto(make([]byte, 0, len(sealed)), or)
+	return shard, or.st.object, err
+}
+
+// majorityObject 返回多数分片的对象 id，票数相同时取序号最小的分片的 id；ids 为空时返回 false
+func majorityObject(ids map[int][sealObjectLen]byte) ([sealObjectLen]byte, bool) {
+	var best [sealObjectLen]byte
+	bestVotes, bestIndex := 0, 0
+	votes := make(map[[sealObjectLen]byte]int)
+	first := make(map[[sealObjectLen]byte]int)
+	for i, id := range ids {
+		votes[id]++
+		if f, ok := first[id]; !ok || i < f {
+			first[id] = i
+		}
+	}
+	for id, v := range votes {
+		if v > bestVotes || v == bestVotes && first[id] < bestIndex {
+			best, bestVotes, bestIndex = id, v, first[id]
+		}
+	}
+	return best, bestVotes > 0
+}
+
+// OpenShards 解密 SealShards 生成的分片
+// 认证失败、无法解密或对象 id 与多数分片不同的分片置为nil并返回其序号，
+// 结果可以直接交给 Reconstruct/ReconstructData。
+func (s *Sealer) OpenShards(sealed [][]byte) ([][]byte, []int) {
+	shards, bad, _ := s.openShards(sealed)
+	return shards, bad
+}
+
+// openShards 实现 OpenShards，同时返回分片集的对象 id
+func (s *Sealer) openShards(sealed [][]byte) ([][]byte, []int, *Sealer) {
+	shards := make([][]byte, len(sealed))
+	ids := make(map[int][sealObjectLen]byte)
+	failed := make([]bool, len(sealed))
+	for i, p := range sealed {
+		if p == nil {
+			continue
+		}
+		shard, id, err := s.openShard(p, i)
+		if err != nil {
+			failed[i] = true
+			continue
+		}
+		shards[i], ids[i] = shard, id
+	}
+	object, ok := majorityObject(ids)
+	var bad []int
+	for i := range sealed {
+		if failed[i] || shards[i] != nil && ids[i] != object {
+			bad = append(bad, i)
+			shards[i] = nil
+		}
+	}
+	if !ok {
+		return shards, bad, nil
+	}
+	return shards, bad, s.withObject(object)
+}
+
+// Reconstruct 重建加密分片集
+// 认证失败或属于其他对象的分片被视为丢失，与nil分片一起重建后用分片集的对象 id 重新加密写回 sealed；
+// 返回被视为丢失的分片序号（nil 分片除外）。
+func (s *Sealer) Reconstruct(enc ReedSolomon, sealed [][]byte) ([]int, error) {
+	shards, bad, o := s.openShards(sealed)
+	if err := enc.Reconstruct(shards); err != nil {
+		return bad, err
+	}
+	for i := range sealed {
+		if sealed[i] != nil && !containsInt(bad, i) {
+			continue
+		}
+		var err error
+		if sealed[i], err = o.sealShard(shards[i], i); err != nil {
+			return bad, err
+		}
+	}
+	return bad, nil
+}
+
+// containsInt 判断 list 中是否有 v
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamReconstruct 流式重建加密分片集
+// 每个输入先完整认证一遍，认证失败或对象 id 与多数分片不同的分片被视为丢失，然后回到开头边解密边参与重建。
+// outputs[i] 不为nil时，分片 i 丢失或被视为丢失就重建、用分片集的对象 id 加密后写入 outputs[i]；
+// 分片 i 完好时忽略 outputs[i]。返回被视为丢失的分片序号（nil 输入除外）。
+func (s *Sealer) StreamReconstruct(enc ReedSolomon, inputs []io.ReadSeeker, outputs []io.Writer) (bad []int, err error) {
+	n := enc.TotalShards()
+	if len(inputs) != n || len(outputs) != n {
+		return nil, ErrTooFewShards
+	}
+	ids := make(map[int][sealObjectLen]byte)
+	failed := make([]bool, n)
+	for i, in := range inputs {
+		if in == nil {
+			continue
+		}
+		id, err := s.verify(in, i)
+		if err != nil {
+			if _, ok := err.(StreamReadError); ok {
+				return nil, err
+			}
+			failed[i] = true
+			continue
+		}
+		ids[i] = id
+	}
+	object, ok := majorityObject(ids)
+	o := s
+	if ok {
+		o = s.withObject(object)
+	}
+	readers := make([]io.Reader, n)
+	for i, in := range inputs {
+		if in == nil {
+			continue
+		}
+		if failed[i] || ids[i] != object {
+			bad = append(bad, i)
+			continue
+		}
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return bad, StreamReadError{Err: err, Stream: i}
+		}
+		if readers[i], err = s.OpenReader(in, i); err != nil {
+			return bad, StreamReadError{Err: err, Stream: i}
+		}
+	}
+
+	writers := make([]io.Writer, n)
+	var sealers []*filterWriter
+	defer func() {
+		for _, w := range sealers {
+			if cerr := w.CloseWithError(err); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}()
+	rebuild := false
+	for i, out := range outputs {
+		if out == nil || readers[i] != nil {
+			continue
+		}
+		w, err := o.SealWriter(out, i)
+		if err != nil {
+			return bad, err
+		}
+		sealers = append(sealers, w.(*filterWriter))
+		writers[i] = w
+		rebuild = true
+	}
+	if !rebuild {
+		return bad, nil
+	}
+	return bad, enc.StreamReconstruct(readers, writers)
+}
+
+// verify 完整读取并认证一份加密数据，返回其对象 id
+// 读取失败时返回 StreamReadError，其他错误说明数据本身无效。
+func (s *Sealer) verify(r io.Reader, index int) ([sealObjectLen]byte, error) {
+	er := &errRecorder{r: r}
+	var id [sealObjectLen]byte
+	or, err := s.openStream(er, index)
+	if err == nil {
+		id = or.st.object
+		_, err = io.Copy(io.Discard, or)
+	}
+	if er.err != nil {
+		return id, StreamReadError{Err: er.err, Stream: index}
+	}
+	return id, err
+}
+
+// errRecorder 记录底层读取器返回的错误（io.EOF 除外）
+type errRecorder struct {
+	r   io.Reader
+	err error
+}
+
+// Read 实现 io.Reader
+func (e *errRecorder) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,280 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// testSealKey 返回测试用的密钥
+func testSealKey(id string, seed int64) KeyProvider {
+	key := make([]byte, 32)
+	rand.New(rand.NewSource(seed)).Read(key)
+	return StaticKey(id, key)
+}
+
+// 测试加密往返：不同长度、分段边界、截断和篡改
+func TestSealStream(t *testing.T) {
+	s, err := NewSealer(testSealKey("k1", 1), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(2))
+	for _, n := range []int{0, 1, 99, 100, 101, 200, 1000} {
+		data := make([]byte, n)
+		rng.Read(data)
+		r, size, err := s.SealReader(bytes.NewReader(data), int64(n), 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(sealed)) != size {
+			t.Fatalf("长度 %d: 加密后 %d 字节，期望 %d", n, len(sealed), size)
+		}
+
+		// SealWriter 生成的数据同样可以解密
+		var buf bytes.Buffer
+		w, err := s.SealWriter(&buf, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range [][]byte{sealed, buf.Bytes()} {
+			or, err := s.OpenReader(bytes.NewReader(p), 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(or)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("长度 %d: 解密失败 %v", n, err)
+			}
+		}
+
+		open := func(p []byte, index int) error {
+			or, err := s.OpenReader(bytes.NewReader(p), index)
+			if err == nil {
+				_, err = io.ReadAll(or)
+			}
+			return err
+		}
+		if err := open(sealed, 4); err != ErrSealAuth {
+			t.Fatalf("长度 %d: 序号不符，期望 ErrSealAuth，实际 %v", n, err)
+		}
+		// 在分段边界截断也能发现
+		for _, cut := range []int{1, 116, len(sealed) - 1} {
+			if cut <= 0 || cut >= len(sealed) {
+				continue
+			}
+			if err := open(sealed[:len(sealed)-cut], 3); err != ErrSealAuth {
+				t.Fatalf("长度 %d: 截断 %d 字节，期望 ErrSealAuth，实际 %v", n, cut, err)
+			}
+		}
+		bad := bytes.Clone(sealed)
+		bad[len(bad)-1] ^= 1
+		if err := open(bad, 3); err != ErrSealAuth {
+			t.Fatalf("长度 %d: 篡改后期望 ErrSealAuth，实际 %v", n, err)
+		}
+	}
+
+	// 密钥不同
+	other, err := NewSealer(testSealKey("k1", 9), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, _ := s.SealReader(bytes.NewReader([]byte("hello")), 5, 0)
+	sealed, _ := io.ReadAll(r)
+	if or, err := other.OpenReader(bytes.NewReader(sealed), 0); err == nil {
+		if _, err := io.ReadAll(or); err != ErrSealAuth {
+			t.Fatalf("期望 ErrSealAuth，实际 %v", err)
+		}
+	} else {
+		t.Fatal(err)
+	}
+	if _, err := NewSealer(nil, 0); err != ErrInvalidInput {
+		t.Fatalf("期望 ErrInvalidInput，实际 %v", err)
+	}
+}
+
+// 测试被篡改的分片在重建时被视为丢失
+func TestSealReconstruct(t *testing.T) {
+	testSealReconstruct(t, 6, 5, false)
+	testSealReconstruct(t, 6, 5, true)
+}
+
+func testSealReconstruct(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSealer(testSealKey("k1", 3), 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+	shards := make([][]byte, total)
+	rng := rand.New(rand.NewSource(4))
+	for i := range shards {
+		shards[i] = make([]byte, 64*20)
+		if i < dataShards {
+			rng.Read(shards[i])
+		}
+	}
+	if err := enc.Encode(shards); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := s.SealShards(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean := make([][]byte, total)
+	for i := range sealed {
+		clean[i] = bytes.Clone(sealed[i])
+	}
+	// 同一数据、同一密钥的另一次加密，对象 id 不同
+	other, err := s.SealShards(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, object, err := s.openShard(clean[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 篡改分片 1，调换分片 4 和 5，丢失分片 7，分片 8 来自另一次加密
+	tampered := func() [][]byte {
+		p := make([][]byte, total)
+		for i := range p {
+			p[i] = bytes.Clone(clean[i])
+		}
+		p[1][len(p[1])/2] ^= 0x40
+		p[4], p[5] = p[5], p[4]
+		p[7] = nil
+		p[8] = bytes.Clone(other[8])
+		return p
+	}
+	wantBad := []int{1, 4, 5, 8}
+
+	// 内存重建
+	p := tampered()
+	bad, err := s.Reconstruct(enc, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(bad, wantBad) {
+		t.Fatalf("认证失败的分片 %v", bad)
+	}
+	got, bad := s.OpenShards(p)
+	if len(bad) != 0 {
+		t.Fatalf("重建后仍有认证失败的分片 %v", bad)
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], shards[i]) {
+			t.Fatalf("分片 %d 不一致", i)
+		}
+		if _, id, _ := s.openShard(p[i], i); id != object {
+			t.Fatalf("重建的分片 %d 的对象 id 不一致", i)
+		}
+	}
+
+	// 流式重建：每个分片都提供输出，只有丢失和认证失败的分片被写入
+	p = tampered()
+	inputs := make([]io.ReadSeeker, total)
+	outputs := make([]io.Writer, total)
+	rebuilt := make([]bytes.Buffer, total)
+	for i := range inputs {
+		if p[i] != nil {
+			inputs[i] = bytes.NewReader(p[i])
+		}
+		outputs[i] = &rebuilt[i]
+	}
+	bad, err = s.StreamReconstruct(enc, inputs, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(bad, wantBad) {
+		t.Fatalf("认证失败的分片 %v", bad)
+	}
+	for i := range rebuilt {
+		written := rebuilt[i].Len() > 0
+		if written != (i == 7 || slices.Contains(wantBad, i)) {
+			t.Fatalf("分片 %d: 是否写入 %v", i, written)
+		}
+		if !written {
+			continue
+		}
+		shard, id, err := s.openShard(rebuilt[i].Bytes(), i)
+		if err != nil || !bytes.Equal(shard, shards[i]) || id != object {
+			t.Fatalf("流式重建的分片 %d 不一致: %v", i, err)
+		}
+	}
+
+	// 认证失败的分片过多
+	p = tampered()
+	p[0][60] ^= 1
+	if _, err := s.Reconstruct(enc, p); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
+
+// 测试编码前加密整个对象
+func TestSealObject(t *testing.T) {
+	enc, err := New(10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSealer(testSealKey("obj", 5), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 300000)
+	rand.New(rand.NewSource(6)).Read(data)
+	r, size, err := s.SealReader(bytes.NewReader(data), int64(len(data)), SealObjectIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bufs := make([]bytes.Buffer, 10)
+	dst := make([]io.Writer, 10)
+	for i := range dst {
+		dst[i] = &bufs[i]
+	}
+	if err := enc.StreamSplit(r, dst, size); err != nil {
+		t.Fatal(err)
+	}
+	join := func() error {
+		shards := make([]io.Reader, 10)
+		for i := range shards {
+			shards[i] = bytes.NewReader(bufs[i].Bytes())
+		}
+		var out bytes.Buffer
+		w := s.OpenWriter(&out, SealObjectIndex)
+		err := enc.StreamJoin(w, shards, size)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil && !bytes.Equal(out.Bytes(), data) {
+			t.Fatal("解密后的数据不一致")
+		}
+		return err
+	}
+	if err := join(); err != nil {
+		t.Fatal(err)
+	}
+	bufs[3].Bytes()[10] ^= 1
+	if err := join(); err != ErrSealAuth {
+		t.Fatalf("期望 ErrSealAuth，实际 %v", err)
+	}
+}
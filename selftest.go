@@ -0,0 +1,311 @@
+/**
+ * Reed-Solomon 编码库 - 内核自检
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// KernelError 表示内核路径的计算结果与纯 Go 参考实现不一致
+type KernelError struct {
+	Path  KernelPath
+	Funcs []string // 结果不一致的函数
+}
+
+func (e KernelError) Error() string {
+	return fmt.Sprintf("kernel %s: mismatch in %s", e.Path, strings.Join(e.Funcs, ", "))
+}
+
+// CheckKernel 使用的分片大小，覆盖 64 字节对齐的短切片和超过 bigSwitchover 的长切片
+var selfTestSizes = []int{64, 640, 64 * 1024}
+
+// 启动自检只使用较小的输入
+var startupTestSizes = []int{64, 640}
+
+var selfTestOnce sync.Once
+
+// CheckKernel 用已知答案测试指定的内核路径
+// 每个 SIMD 函数的输出都与 refMul/refMulAdd/sliceXorGo 组成的参考实现比较。
+// 测试期间会临时切换到该路径，结束后恢复，不应在编解码进行时调用。
+// 已被启动自检禁用的路径也可以测试。
+// 路径不可用时返回 ErrNotSupported，结果不一致时返回 KernelError。
+func CheckKernel(p KernelPath) error {
+	kernelSelfTest()
+	c, ok := lookupKernel(p)
+	if !ok {
+		return ErrNotSupported
+	}
+	kernelMu.Lock()
+	defer kernelMu.Unlock()
+	return checkKernel(c, selfTestSizes)
+}
+
+// kernelSelfTest 在第一次创建编解码器时测试所有可用的内核路径
+// 结果不一致的路径被禁用，当前路径被禁用时改用通过测试的最快路径。
+func kernelSelfTest() {
+	selfTestOnce.Do(func() {
+		initConstants()
+		initConstants8()
+
+		kernelMu.Lock()
+		defer kernelMu.Unlock()
+		chosen, disabled := selectKernel(kernelCandidates(), func(c *kernelCandidate) error {
+			return checkKernel(c, startupTestSizes)
+		})
+		kernelDisabled = disabled
+		for _, e := range disabled {
+			logger.Error("内核自检失败，已禁用: %v", e)
+		}
+
+		active := activeKernel.Load()
+		switch {
+		case chosen == nil:
+			logger.Error("没有通过自检的内核路径，继续使用 %s", active.path)
+		case chosen.path != active.path:
+			logger.Warn("内核 %s 未通过自检，改用 %s", active.path, chosen.path)
+			activeKernel.Store(chosen)
+		default:
+			logger.Debug("内核自检通过，使用 %s", active.path)
+		}
+	})
+}
+
+// selectKernel 测试所有支持的路径，返回通过测试的最快路径和未通过的路径
+func selectKernel(cands []kernelCandidate, check func(*kernelCandidate) error) (*kernelCandidate, []KernelError) {
+	var chosen *kernelCandidate
+	var disabled []KernelError
+	for i := range cands {
+		c := &cands[i]
+		if !c.supported {
+			continue
+		}
+		if err := check(c); err != nil {
+			var ke KernelError
+			if !errors.As(err, &ke) {
+				ke = KernelError{Path: c.path, Funcs: []string{err.Error()}}
+			}
+			disabled = append(disabled, ke)
+			continue
+		}
+		if chosen == nil {
+			chosen = c
+		}
+	}
+	return chosen, disabled
+}
+
+// checkKernel 切换到 c 运行已知答案测试，调用方需持有 kernelMu
+func checkKernel(c *kernelCandidate, sizes []int) error {
+	prev := activeKernel.Load()
+	activeKernel.Store(c)
+	defer activeKernel.Store(prev)
+
+	var failed []string
+	check := func(name string, ok bool) {
+		if !ok && !slices.Contains(failed, name) {
+			failed = append(failed, name)
+		}
+	}
+	rng := rand.New(rand.NewSource(0x5eed))
+	for _, size := range sizes {
+		testKernel16(rng, size, check)
+		testKernel8(rng, size, check)
+	}
+	if len(failed) > 0 {
+		return KernelError{Path: c.path, Funcs: failed}
+	}
+	return nil
+}
+
+// testKernel16 测试 GF(2^16) 内核
+func testKernel16(rng *rand.Rand, size int, check func(string, bool)) {
+	logM := func() ffe { return ffe(rng.Intn(modulus)) }
+
+	x, y := randShard(rng, size), randShard(rng, size)
+	want, got := make([]byte, size), make([]byte, size)
+	m := logM()
+	refMul(want, y, m)
+	mulgf16(got, y, m)
+	check("mulgf16", bytes.Equal(got, want))
+
+	want, got = bytes.Clone(x), bytes.Clone(x)
+	sliceXorGo(y, want)
+	sliceXor(y, got)
+	check("sliceXor", bytes.Equal(got, want))
+
+	wx, wy, gx, gy := bytes.Clone(x), bytes.Clone(y), bytes.Clone(x), bytes.Clone(y)
+	refMulAdd(wx, wy, m)
+	sliceXorGo(wx, wy)
+	fftDIT2(gx, gy, m)
+	check("fftDIT2", bytes.Equal(gx, wx) && bytes.Equal(gy, wy))
+
+	wx, wy, gx, gy = bytes.Clone(x), bytes.Clone(y), bytes.Clone(x), bytes.Clone(y)
+	sliceXorGo(wx, wy)
+	refMulAdd(wx, wy, m)
+	ifftDIT2(gx, gy, m)
+	check("ifftDIT2", bytes.Equal(gx, wx) && bytes.Equal(gy, wy))
+
+	// 每个对数参数分别取 modulus（只做异或）和随机值
+	for combo := 0; combo < 8; combo++ {
+		pick := func(bit int) ffe {
+			if combo&(1<<bit) != 0 {
+				return modulus
+			}
+			return logM()
+		}
+		m01, m23, m02 := pick(0), pick(1), pick(2)
+		for _, dist := range []int{1, 2} {
+			work := randWork(rng, 4*dist, size)
+			want, got := cloneWork(work), cloneWork(work)
+			refDIT4(want, dist, ref16(m01), ref16(m23), ref16(m02), false)
+			fftDIT4(got, dist, m01, m23, m02)
+			check("fftDIT4", equalWork(got, want))
+
+			want, got = cloneWork(work), cloneWork(work)
+			refDIT4(want, dist, ref16(m01), ref16(m23), ref16(m02), true)
+			ifftDIT4(got, dist, m01, m23, m02)
+			check("ifftDIT4", equalWork(got, want))
+		}
+	}
+}
+
+// testKernel8 测试 GF(2^8) 内核
+func testKernel8(rng *rand.Rand, size int, check func(string, bool)) {
+	logM := func() ffe8 { return ffe8(rng.Intn(modulus8)) }
+
+	x, y := randShard(rng, size), randShard(rng, size)
+	want, got := make([]byte, size), make([]byte, size)
+	m := logM()
+	refMul8(want, y, m)
+	mulgf8(got, y, m)
+	check("mulgf8", bytes.Equal(got, want))
+
+	want, got = bytes.Clone(x), bytes.Clone(x)
+	refMulAdd8(want, y, m)
+	mulAdd8(got, y, m)
+	check("mulAdd8", bytes.Equal(got, want))
+
+	wx, wy, gx, gy := bytes.Clone(x), bytes.Clone(y), bytes.Clone(x), bytes.Clone(y)
+	refMulAdd8(wx, wy, m)
+	sliceXorGo(wx, wy)
+	fftDIT28(gx, gy, m)
+	check("fftDIT28", bytes.Equal(gx, wx) && bytes.Equal(gy, wy))
+
+	wx, wy, gx, gy = bytes.Clone(x), bytes.Clone(y), bytes.Clone(x), bytes.Clone(y)
+	sliceXorGo(wx, wy)
+	refMulAdd8(wx, wy, m)
+	ifftDIT28(gx, gy, m)
+	check("ifftDIT28", bytes.Equal(gx, wx) && bytes.Equal(gy, wy))
+
+	for combo := 0; combo < 8; combo++ {
+		pick := func(bit int) ffe8 {
+			if combo&(1<<bit) != 0 {
+				return modulus8
+			}
+			return logM()
+		}
+		m01, m23, m02 := pick(0), pick(1), pick(2)
+		for _, dist := range []int{1, 2} {
+			work := randWork(rng, 4*dist, size)
+			want, got := cloneWork(work), cloneWork(work)
+			refDIT4(want, dist, ref8(m01), ref8(m23), ref8(m02), false)
+			fftDIT48(got, dist, m01, m23, m02)
+			check("fftDIT48", equalWork(got, want))
+
+			want, got = cloneWork(work), cloneWork(work)
+			refDIT4(want, dist, ref8(m01), ref8(m23), ref8(m02), true)
+			ifftDIT48(got, dist, m01, m23, m02)
+			check("ifftDIT48", equalWork(got, want))
+		}
+	}
+}
+
+// ref16 返回 x[] ^= y[] * log_m 的参考实现，log_m 为 modulus 时返回 nil（只做异或）
+func ref16(logM ffe) func(x, y []byte) {
+	if logM == modulus {
+		return nil
+	}
+	return func(x, y []byte) { refMulAdd(x, y, logM) }
+}
+
+// ref8 是 ref16 的 GF(2^8) 版本
+func ref8(logM ffe8) func(x, y []byte) {
+	if logM == modulus8 {
+		return nil
+	}
+	return func(x, y []byte) { refMulAdd8(x, y, logM) }
+}
+
+// refDIT2 是只使用纯 Go 函数的 2 路蝶形运算
+func refDIT2(x, y []byte, mulAdd func(x, y []byte), inverse bool) {
+	switch {
+	case mulAdd == nil:
+		sliceXorGo(x, y)
+	case inverse:
+		sliceXorGo(x, y)
+		mulAdd(x, y)
+	default:
+		mulAdd(x, y)
+		sliceXorGo(x, y)
+	}
+}
+
+// refDIT4 是只使用纯 Go 函数的 4 路蝶形运算，层次与 fftDIT4Ref/ifftDIT4Ref 相同
+func refDIT4(work [][]byte, dist int, m01, m23, m02 func(x, y []byte), inverse bool) {
+	outer := func() {
+		refDIT2(work[0], work[dist*2], m02, inverse)
+		refDIT2(work[dist], work[dist*3], m02, inverse)
+	}
+	inner := func() {
+		refDIT2(work[0], work[dist], m01, inverse)
+		refDIT2(work[dist*2], work[dist*3], m23, inverse)
+	}
+	if inverse {
+		inner()
+		outer()
+	} else {
+		outer()
+		inner()
+	}
+}
+
+func randShard(rng *rand.Rand, size int) []byte {
+	b := make([]byte, size)
+	rng.Read(b)
+	return b
+}
+
+func randWork(rng *rand.Rand, n, size int) [][]byte {
+	work := make([][]byte, n)
+	for i := range work {
+		work[i] = randShard(rng, size)
+	}
+	return work
+}
+
+func cloneWork(work [][]byte) [][]byte {
+	c := make([][]byte, len(work))
+	for i, b := range work {
+		c[i] = bytes.Clone(b)
+	}
+	return c
+}
+
+func equalWork(a, b [][]byte) bool {
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+/**
+ * Reed-Solomon 编码库 - 秘密共享
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+)
+
+// 份额的格式:
+//
+//	magic(4) | version(1) | threshold(2) | x(2) | length(4) | id(8) | 各符号的 y 值
+//
+// 秘密按大端序每2字节作为 GF(2^16) 中的一个符号（长度为奇数时补一个0字节），
+// 每个符号使用独立的 threshold-1 次随机多项式，常数项为秘密，份额保存多项式在 x 处的值。
+// id 在每次拆分时随机生成，用于发现混用不同拆分的份额。
+const (
+	shamirVersion   = 1
+	shamirHeaderLen = 21
+
+	// MaxSecretShares 是秘密共享支持的最大份额数
+	MaxSecretShares = modulus
+)
+
+// 份额的魔数
+var shamirMagic = [4]byte{'R', 'S', 'S', 'S'}
+
+// ShareHeader 是份额头部记录的信息
+type ShareHeader struct {
+	Threshold int     // 恢复秘密所需的份额数
+	X         int     // 份额的横坐标，1 到 MaxSecretShares
+	Length    int     // 秘密的字节数
+	ID        [8]byte // 同一次拆分产生的份额 id 相同
+}
+
+// ParseShareHeader 解析并检查份额的头部
+func ParseShareHeader(share []byte) (ShareHeader, error) {
+	var h ShareHeader
+	if len(share) < shamirHeaderLen || !bytes.Equal(share[:4], shamirMagic[:]) || share[4] != shamirVersion {
+		return h, ErrInvalidShare
+	}
+	h.Threshold = int(binary.BigEndian.Uint16(share[5:]))
+	h.X = int(binary.BigEndian.Uint16(share[7:]))
+	h.Length = int(binary.BigEndian.Uint32(share[9:]))
+	copy(h.ID[:], share[13:shamirHeaderLen])
+	if h.Threshold < 2 || h.X == 0 || h.X > MaxSecretShares || h.Length == 0 ||
+		len(share) != shamirHeaderLen+2*secretSymbols(h.Length) {
+		return h, ErrInvalidShare
+	}
+	return h, nil
+}
+
+// secretSymbols 返回 n 字节秘密的符号数
+func secretSymbols(n int) int {
+	return (n + 1) / 2
+}
+
+// ctNonZero 在 a 不为0时返回 0xFFFF，否则返回0，不产生分支
+func ctNonZero(a ffe) ffe {
+	return -ffe((uint32(a) | -uint32(a)) >> 31)
+}
+
+// mulLogCT 返回 a * Exp(log_b)，与 mulLog 相同但不按 a 的值分支
+func mulLogCT(a, log_b ffe) ffe {
+	return expLUT[addMod(logLUT[a], log_b)] & ctNonZero(a)
+}
+
+// SplitSecret 把秘密拆分为 shares 个份额，任意 threshold 个份额可以恢复秘密
+// 少于 threshold 个份额得不到秘密的任何信息。2 <= threshold <= shares <= MaxSecretShares，
+// 份额的横坐标为 1 到 shares；计算量与 threshold×shares×len(secret) 成正比。
+// 对秘密数据的运算不按值分支，但查表的访存地址仍依赖秘密数据。
+func SplitSecret(secret []byte, threshold, shares int) ([][]byte, error) {
+	if len(secret) == 0 || int64(len(secret)) > 1<<32-1 {
+		return nil, ErrInvalidInput
+	}
+	if threshold < 2 || threshold > shares || shares > MaxSecretShares {
+		return nil, ErrInvShardNum
+	}
+	initConstants()
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+	symbols := secretSymbols(len(secret))
+	out := make([][]byte, shares)
+	logX := make([]ffe, shares)
+	for i := range out {
+		p := make([]byte, shamirHeaderLen+2*symbols)
+		copy(p, shamirMagic[:])
+		p[4] = shamirVersion
+		binary.BigEndian.PutUint16(p[5:], uint16(threshold))
+		binary.BigEndian.PutUint16(p[7:], uint16(i+1))
+		binary.BigEndian.PutUint32(p[9:], uint32(len(secret)))
+		copy(p[13:], id[:])
+		out[i] = p
+		logX[i] = logLUT[i+1]
+	}
+
+	// 每个符号的随机系数，用完后清零
+	raw := make([]byte, 2*(threshold-1))
+	coeffs := make([]ffe, threshold-1)
+	defer func() {
+		clear(raw)
+		clear(coeffs)
+	}()
+	for s := 0; s < symbols; s++ {
+		var pair [2]byte
+		copy(pair[:], secret[2*s:])
+		c0 := ffe(binary.BigEndian.Uint16(pair[:]))
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j := range coeffs {
+			coeffs[j] = ffe(binary.BigEndian.Uint16(raw[2*j:]))
+		}
+		// 霍纳法则: y = ((c[t-1]·x + c[t-2])·x + ...)·x + c0
+		for i, p := range out {
+			y := coeffs[len(coeffs)-1]
+			for j := len(coeffs) - 2; j >= 0; j-- {
+				y = mulLogCT(y, logX[i]) ^ coeffs[j]
+			}
+			y = mulLogCT(y, logX[i]) ^ c0
+			binary.BigEndian.PutUint16(p[shamirHeaderLen+2*s:], uint16(y))
+		}
+		clear(pair[:])
+	}
+	return out, nil
+}
+
+// CombineSecret 用 SplitSecret 生成的份额恢复秘密
+// 至少需要 threshold 个同一次拆分产生的不同份额，多余的份额被忽略；
+// 份额少于 threshold 时返回 ErrTooFewShards，头部无效、不一致或横坐标重复时返回 ErrInvalidShare。
+// 份额本身没有认证，被篡改的份额会得到错误的秘密。
+func CombineSecret(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, ErrTooFewShards
+	}
+	first, err := ParseShareHeader(shares[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) < first.Threshold {
+		return nil, ErrTooFewShards
+	}
+	initConstants()
+
+	use := shares[:first.Threshold]
+	xs := make([]ffe, len(use))
+	seen := make(map[int]bool, len(use))
+	for i, p := range use {
+		h, err := ParseShareHeader(p)
+		if err != nil {
+			return nil, err
+		}
+		if h.Threshold != first.Threshold || h.Length != first.Length || h.ID != first.ID || seen[h.X] {
+			return nil, ErrInvalidShare
+		}
+		seen[h.X] = true
+		xs[i] = ffe(h.X)
+	}
+
+	// 拉格朗日基函数在 0 处的值（取对数）:
+	// l_i = Π_{j≠i} x_j / (x_i + x_j)，特征为2时减法即异或
+	var logSum uint64
+	for _, x := range xs {
+		logSum += uint64(logLUT[x])
+	}
+	logL := make([]ffe, len(xs))
+	for i, xi := range xs {
+		num := logSum - uint64(logLUT[xi])
+		var den uint64
+		for j, xj := range xs {
+			if j != i {
+				den += uint64(logLUT[xi^xj])
+			}
+		}
+		logL[i] = ffe((num%modulus + modulus - den%modulus) % modulus)
+	}
+
+	symbols := secretSymbols(first.Length)
+	secret := make([]byte, 2*symbols)
+	for s := 0; s < symbols; s++ {
+		var y ffe
+		off := shamirHeaderLen + 2*s
+		for i, p := range use {
+			y ^= mulLogCT(ffe(binary.BigEndian.Uint16(p[off:])), logL[i])
+		}
+		binary.BigEndian.PutUint16(secret[2*s:], uint16(y))
+	}
+	return secret[:first.Length], nil
+}
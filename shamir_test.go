@@ -0,0 +1,108 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// 测试 GF(2^16) 乘法：与 mulLog 一致，非零元素与逆元的乘积为1
+func TestMulLogCT(t *testing.T) {
+	initConstants()
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		a, b := ffe(rng.Intn(order)), ffe(rng.Intn(order))
+		if i < 2 {
+			a = 0
+		}
+		if got, want := mulLogCT(a, logLUT[b]), mulLog(a, logLUT[b]); b != 0 && got != want {
+			t.Fatalf("%#x * %#x = %#x，期望 %#x", a, b, got, want)
+		}
+		if a != 0 && mulLogCT(a, modulus-logLUT[a]) != 1 {
+			t.Fatalf("%#x 与逆元的乘积不为1", a)
+		}
+	}
+}
+
+// 测试拆分并用不同的份额子集恢复秘密
+func TestSecretSharing(t *testing.T) {
+	testSecretSharing(t, 32, 2, 3)
+	testSecretSharing(t, 33, 5, 9)
+	testSecretSharing(t, 1, 10, 10)
+	testSecretSharing(t, 16, 3, MaxSecretShares)
+	testSecretSharing(t, 7, 200, 1000)
+}
+
+func testSecretSharing(t *testing.T, length, threshold, shares int) {
+	rng := rand.New(rand.NewSource(int64(length + threshold + shares)))
+	secret := make([]byte, length)
+	rng.Read(secret)
+	out, err := SplitSecret(secret, threshold, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != shares {
+		t.Fatalf("份额数 %d，期望 %d", len(out), shares)
+	}
+	h, err := ParseShareHeader(out[shares-1])
+	if err != nil || h.Threshold != threshold || h.X != shares || h.Length != length {
+		t.Fatalf("份额头部 %+v %v", h, err)
+	}
+
+	for trial := 0; trial < 3; trial++ {
+		perm := rng.Perm(shares)
+		subset := make([][]byte, threshold)
+		for i := range subset {
+			subset[i] = out[perm[i]]
+		}
+		got, err := CombineSecret(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Fatalf("%d/%d: 恢复的秘密不一致", threshold, shares)
+		}
+		// 少一个份额时无法恢复
+		if _, err := CombineSecret(subset[1:]); err != ErrTooFewShards {
+			t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+		}
+	}
+}
+
+// 测试无效的参数和份额
+func TestSecretSharingErrors(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+	for _, c := range [][2]int{{1, 3}, {4, 3}, {2, MaxSecretShares + 1}} {
+		if _, err := SplitSecret(secret, c[0], c[1]); err != ErrInvShardNum {
+			t.Fatalf("%v: 期望 ErrInvShardNum，实际 %v", c, err)
+		}
+	}
+	if _, err := SplitSecret(nil, 2, 3); err != ErrInvalidInput {
+		t.Fatalf("期望 ErrInvalidInput，实际 %v", err)
+	}
+
+	a, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := SplitSecret(secret, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := a[2][:len(a[2])-1]
+	for name, set := range map[string][][]byte{
+		"重复的份额":  {a[0], a[1], a[0]},
+		"混用不同拆分": {a[0], a[1], b[2]},
+		"截断的份额":  {a[0], a[1], truncated},
+	} {
+		if _, err := CombineSecret(set); err != ErrInvalidShare {
+			t.Fatalf("%s: 期望 ErrInvalidShare，实际 %v", name, err)
+		}
+	}
+
+	// 任意 threshold 个份额的结果相同，多余的份额被忽略
+	got, err := CombineSecret([][]byte{a[4], a[2], a[0], a[1]})
+	if err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("恢复失败: %v", err)
+	}
+}
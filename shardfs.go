@@ -0,0 +1,467 @@
+/**
+ * Reed-Solomon 编码库 - 分片集文件系统
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ManifestSuffix 是分片集清单（JSON）的文件名后缀
+// 对象 name 的清单为 name.manifest，第 i 个分片为 name.i，与 rs16 命令行工具的布局一致。
+const ManifestSuffix = ".manifest"
+
+// ShardFS 是只读文件系统，把底层文件系统中的分片集呈现为普通文件
+// 每个 name.manifest 对应一个文件 name，分片文件和清单本身不可见，子目录原样保留。
+// 打开文件时检查分片是否存在及其长度，丢失的数据分片在第一次读到时从其余分片重建到临时文件。
+// 每个分片在第一次读取或参与重建之前按清单校验 SHA-256，摘要不符或无法读取的分片同样视为丢失。
+// 文件实现 io.Seeker 和 io.ReaderAt，可以通过 http.FS 提供范围请求。
+type ShardFS struct {
+	fsys fs.FS
+	opts []Option
+}
+
+// NewShardFS 在 fsys 之上创建分片集文件系统，opts 用于创建重建时的编解码器
+func NewShardFS(fsys fs.FS, opts ...Option) *ShardFS {
+	return &ShardFS{fsys: fsys, opts: opts}
+}
+
+// Open 实现 fs.FS
+func (s *ShardFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := s.openObject(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	fi, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := s.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &shardDir{info: fi, entries: entries}, nil
+}
+
+// readManifest 读取对象 name 的清单
+func (s *ShardFS) readManifest(name string) (*Manifest, fs.FileInfo, error) {
+	p := name + ManifestSuffix
+	if name == "." {
+		return nil, nil, fs.ErrNotExist
+	}
+	fi, err := fs.Stat(s.fsys, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		return nil, nil, fs.ErrNotExist
+	}
+	b, err := fs.ReadFile(s.fsys, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, nil, err
+	}
+	if m.Layout != LayoutSplit && m.Layout != LayoutStream {
+		return nil, nil, ErrInvalidManifest
+	}
+	// 压缩的对象无法按偏移随机读取
+	if m.Compression != "" {
+		return nil, nil, ErrNotSupported
+	}
+	return m, fi, nil
+}
+
+// readDir 列出目录中的子目录和分片集
+func (s *ShardFS) readDir(dir string) ([]fs.DirEntry, error) {
+	raw, err := fs.ReadDir(s.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	for _, e := range raw {
+		name := e.Name()
+		switch {
+		case e.IsDir():
+			entries = append(entries, e)
+		case strings.HasSuffix(name, ManifestSuffix) && len(name) > len(ManifestSuffix):
+			obj := strings.TrimSuffix(name, ManifestSuffix)
+			m, fi, err := s.readManifest(path.Join(dir, obj))
+			if err != nil {
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(&objectInfo{name: obj, size: m.ObjectSize, mod: fi.ModTime()}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// openObject 打开分片集对应的文件
+func (s *ShardFS) openObject(name string) (*shardFile, error) {
+	m, fi, err := s.readManifest(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &shardFile{
+		fsys:   s.fsys,
+		name:   name,
+		m:      m,
+		info:   &objectInfo{name: path.Base(name), size: m.ObjectSize, mod: fi.ModTime()},
+		opts:   s.opts,
+		shards: make([]fs.File, m.DataShards),
+		temps:  make(map[int]*os.File),
+	}
+	f.present = make([]bool, m.TotalShards())
+	f.verified = make([]bool, m.TotalShards())
+	ok := 0
+	for i := range f.present {
+		fi, err := fs.Stat(s.fsys, f.shardName(i))
+		if err == nil && !fi.IsDir() && fi.Size() == m.ShardLen(i) {
+			f.present[i] = true
+			ok++
+		}
+	}
+	if ok < m.DataShards {
+		return nil, ErrTooFewShards
+	}
+	return f, nil
+}
+
+// objectInfo 是分片集文件的 fs.FileInfo
+type objectInfo struct {
+	name string
+	size int64
+	mod  time.Time
+}
+
+func (i *objectInfo) Name() string       { return i.name }
+func (i *objectInfo) Size() int64        { return i.size }
+func (i *objectInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *objectInfo) ModTime() time.Time { return i.mod }
+func (i *objectInfo) IsDir() bool        { return false }
+func (i *objectInfo) Sys() any           { return nil }
+
+// shardDir 是 ShardFS 中的目录
+type shardDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *shardDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *shardDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *shardDir) Close() error { return nil }
+
+// ReadDir 实现 fs.ReadDirFile
+func (d *shardDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.off:]
+	if n <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = int(min(int64(n), int64(len(rest))))
+	d.off += n
+	return rest[:n], nil
+}
+
+// shardFile 是 ShardFS 中的文件，按偏移从对应的数据分片读取
+// 对象按顺序存放在数据分片中，偏移 off 位于分片 off/ShardSize。
+type shardFile struct {
+	fsys    fs.FS
+	name    string
+	m       *Manifest
+	info    fs.FileInfo
+	opts    []Option
+	present []bool // 分片存在且长度正确，校验摘要失败后置为 false
+
+	verified []bool // 已按清单校验过摘要，由 mu 保护
+
+	mu     sync.Mutex
+	off    int64
+	shards []fs.File        // 已打开的数据分片
+	temps  map[int]*os.File // 已重建的数据分片
+	closed bool
+}
+
+func (f *shardFile) shardName(i int) string {
+	return f.name + "." + strconv.Itoa(i)
+}
+
+func (f *shardFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Read 实现 io.Reader
+func (f *shardFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	off := f.off
+	f.mu.Unlock()
+	n, err := f.ReadAt(p, off)
+	f.mu.Lock()
+	f.off = off + int64(n)
+	f.mu.Unlock()
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek 实现 io.Seeker
+func (f *shardFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.m.ObjectSize
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+// ReadAt 实现 io.ReaderAt，可以并发调用
+func (f *shardFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= f.m.ObjectSize {
+		return 0, io.EOF
+	}
+	var eof error
+	if rest := f.m.ObjectSize - off; int64(len(p)) > rest {
+		p = p[:rest]
+		eof = io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		idx := int(pos / f.m.ShardSize)
+		shardOff := pos % f.m.ShardSize
+		c := int(min(int64(len(p)-n), f.m.ShardSize-shardOff))
+		r, err := f.shard(idx)
+		if err != nil {
+			return n, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		got, err := r.ReadAt(p[n:n+c], shardOff)
+		n += got
+		if err != nil && !(err == io.EOF && got == c) {
+			return n, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	}
+	return n, eof
+}
+
+// shard 返回数据分片 i 的 io.ReaderAt，丢失的分片先重建
+func (f *shardFile) shard(i int) (io.ReaderAt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil, fs.ErrClosed
+	}
+	if t, ok := f.temps[i]; ok {
+		return t, nil
+	}
+	if !f.verify(i) {
+		if err := f.rebuild(i); err != nil {
+			return nil, err
+		}
+		return f.temps[i], nil
+	}
+	if f.shards[i] == nil {
+		sf, err := f.fsys.Open(f.shardName(i))
+		if err != nil {
+			return nil, err
+		}
+		f.shards[i] = sf
+	}
+	if ra, ok := f.shards[i].(io.ReaderAt); ok {
+		return ra, nil
+	}
+	return &reopenReaderAt{fsys: f.fsys, name: f.shardName(i)}, nil
+}
+
+// verify 在第一次使用前校验分片 i 的摘要，返回分片是否可用，调用方需持有 mu
+// 摘要不符或无法读取的分片被视为丢失。
+func (f *shardFile) verify(i int) bool {
+	if !f.present[i] || f.verified[i] {
+		return f.present[i]
+	}
+	sf, err := f.fsys.Open(f.shardName(i))
+	if err == nil {
+		err = f.m.CheckShard(i, sf)
+		sf.Close()
+	}
+	if err != nil {
+		f.present[i] = false
+		return false
+	}
+	f.verified[i] = true
+	return true
+}
+
+// rebuild 从完好的分片重建数据分片 i 到临时文件并校验摘要，调用方需持有 mu
+func (f *shardFile) rebuild(i int) (err error) {
+	enc, err := f.m.NewEncoder(f.opts...)
+	if err != nil {
+		return err
+	}
+	t, err := os.CreateTemp("", "reedsolomon-shardfs-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			t.Close()
+			os.Remove(t.Name())
+		}
+	}()
+
+	// 只用校验过摘要的 k 个分片重建
+	present := make([]bool, len(f.present))
+	have := 0
+	for j := range present {
+		if have == f.m.DataShards {
+			break
+		}
+		if j != i && f.verify(j) {
+			present[j] = true
+			have++
+		}
+	}
+	if have < f.m.DataShards {
+		return ErrTooFewShards
+	}
+	rebuild := make([]bool, len(present))
+	rebuild[i] = true
+	o := &fsOpener{f: f, out: t, want: i}
+	if err := enc.StreamReconstructShards(o, present, rebuild); err != nil {
+		return err
+	}
+	if err := t.Truncate(f.m.ShardLen(i)); err != nil {
+		return err
+	}
+	if _, err := t.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.m.CheckShard(i, t); err != nil {
+		return err
+	}
+	f.temps[i] = t
+	return nil
+}
+
+// Close 关闭打开的分片并删除临时文件
+func (f *shardFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	var first error
+	for _, sf := range f.shards {
+		if sf != nil {
+			if err := sf.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	for _, t := range f.temps {
+		t.Close()
+		os.Remove(t.Name())
+	}
+	return first
+}
+
+// fsOpener 为重建打开底层文件系统中的分片
+type fsOpener struct {
+	f    *shardFile
+	out  *os.File
+	want int
+}
+
+func (o *fsOpener) OpenShard(i int) (io.ReadCloser, error) {
+	sf, err := o.f.fsys.Open(o.f.shardName(i))
+	if err != nil {
+		return nil, err
+	}
+	pad := o.f.m.ShardSize - o.f.m.ShardLen(i)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(sf, io.LimitReader(zeroReader{}, pad)), sf}, nil
+}
+
+func (o *fsOpener) CreateShard(i int) (io.WriteCloser, error) {
+	if i != o.want {
+		return nil, ErrInvalidOutput
+	}
+	return nopWriteCloser{o.out}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// reopenReaderAt 为不支持 io.ReaderAt 的文件系统实现随机读取：每次重新打开并跳过前面的内容
+type reopenReaderAt struct {
+	fsys fs.FS
+	name string
+}
+
+func (r *reopenReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f, err := r.fsys.Open(r.name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(off, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, f, off)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(f, p)
+}
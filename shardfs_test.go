@@ -0,0 +1,164 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// addShardSet 把 data 流式编码后以 name.i 和 name.manifest 的形式加入 fsys
+func addShardSet(t *testing.T, fsys fstest.MapFS, enc ReedSolomon, name string, data []byte) {
+	t.Helper()
+	b, err := NewManifestBuilder(enc, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := enc.DataShards()
+	bufs := make([]*bytes.Buffer, enc.TotalShards())
+	writers := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		bufs[i] = new(bytes.Buffer)
+		writers[i] = bufs[i]
+	}
+	if err := enc.StreamSplit(b.Object(bytes.NewReader(data)), b.DataWriters(writers[:k]), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		readers[i] = bytes.NewReader(bufs[i].Bytes())
+	}
+	if err := enc.StreamEncode(readers, b.ParityWriters(writers[k:])); err != nil {
+		t.Fatal(err)
+	}
+	m, err := b.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mj, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mod := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys[name+ManifestSuffix] = &fstest.MapFile{Data: mj, ModTime: mod}
+	for i, buf := range bufs {
+		fsys[fmt.Sprintf("%s.%d", name, i)] = &fstest.MapFile{Data: buf.Bytes(), ModTime: mod}
+	}
+}
+
+// 测试分片集文件系统通过 fstest.TestFS，并在分片丢失时重建
+func TestShardFS(t *testing.T) {
+	testShardFS(t, 10, 4, false)
+	testShardFS(t, 260, 20, true)
+}
+
+func testShardFS(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewSource(int64(dataShards)))
+	// 大小随数据分片数变化，覆盖不整齐的尾部和小于数据分片数的对象
+	unit := 64 * dataShards
+	files := map[string][]byte{
+		"a.bin":       make([]byte, 6*unit-100),
+		"dir/b.txt":   make([]byte, 2*unit-66),
+		"dir/sub/c":   make([]byte, 4*unit-5),
+		"dir/sub/one": make([]byte, 1),
+	}
+	fsys := fstest.MapFS{"empty": &fstest.MapFile{Mode: fs.ModeDir | 0o755}}
+	for name, data := range files {
+		rng.Read(data)
+		addShardSet(t, fsys, enc, name, data)
+	}
+	// 丢失部分数据分片和校验分片
+	delete(fsys, "a.bin.0")
+	delete(fsys, fmt.Sprintf("a.bin.%d", dataShards-1))
+	delete(fsys, fmt.Sprintf("dir/sub/c.%d", dataShards))
+	delete(fsys, "dir/sub/c.3")
+	// 长度不变但内容被破坏的数据分片和校验分片同样视为丢失
+	fsys["a.bin.2"].Data[7] ^= 1
+	fsys["dir/sub/c.1"].Data[0] ^= 0x80
+	fsys[fmt.Sprintf("dir/sub/c.%d", dataShards+1)].Data[3] ^= 2
+
+	sfs := NewShardFS(fsys)
+	if err := fstest.TestFS(sfs, "a.bin", "dir/b.txt", "dir/sub/c", "dir/sub/one", "empty"); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		got, err := fs.ReadFile(sfs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: 内容不一致", name)
+		}
+	}
+
+	// 分片和清单本身不可见
+	for _, name := range []string{"a.bin.1", "a.bin" + ManifestSuffix, "missing"} {
+		if _, err := sfs.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: 期望 fs.ErrNotExist，实际 %v", name, err)
+		}
+	}
+
+	// 完好分片不足
+	for i := 0; i <= parityShards; i++ {
+		delete(fsys, fmt.Sprintf("dir/b.txt.%d", i))
+	}
+	if _, err := sfs.Open("dir/b.txt"); !errors.Is(err, ErrTooFewShards) {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+}
+
+// 测试通过 http.FS 提供范围请求
+func TestShardFSHTTP(t *testing.T) {
+	enc, err := New(6, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	fsys := fstest.MapFS{}
+	addShardSet(t, fsys, enc, "video.bin", data)
+	delete(fsys, "video.bin.2")
+
+	srv := httptest.NewServer(http.FileServer(http.FS(NewShardFS(fsys))))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+"/video.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=70000-140009")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("期望 206，实际 %d", resp.StatusCode)
+	}
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[70000:140010]) {
+		t.Fatal("范围请求的内容不一致")
+	}
+}
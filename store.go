@@ -0,0 +1,417 @@
+/**
+ * Reed-Solomon 编码库 - 分片存储和对象读写
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// ManifestIndex 是对象清单在 ShardStore 中使用的分片序号
+const ManifestIndex = -1
+
+// ShardStore 按对象 id 和分片序号保存分片
+// 序号 ManifestIndex 保存对象的清单，实现应当把清单复制到多个位置，
+// 使得丢失部分分片位置后仍能读取清单。
+type ShardStore interface {
+	Put(id string, index int, r io.Reader) error     // 原子地写入分片，读取 r 出错时不留下分片
+	Get(id string, index int) (io.ReadCloser, error) // 打开分片用于读取
+	Delete(id string, index int) error               // 删除分片，分片不存在时不返回错误
+	List(id string) ([]int, error)                   // 返回已保存的分片序号（不包括清单）
+}
+
+// ExclusiveStore 是支持排他创建的 ShardStore
+// ObjectStore.Put 通过 Create 原子地占用对象 id，并发写入同一 id 时只有一个会成功。
+type ExclusiveStore interface {
+	ShardStore
+	Create(id string, index int, r io.Reader) error // 与 Put 相同，但分片已存在时返回满足 errors.Is(err, fs.ErrExist) 的错误
+}
+
+// ObjectStore 在 ShardStore 之上按对象读写，使用流式编码，内存占用与对象大小无关
+type ObjectStore struct {
+	store ShardStore
+	enc   ReedSolomon
+	comp  Compressor
+}
+
+// NewObjectStore 创建对象存储，enc 决定新写入对象的分片参数
+// 读取时使用对象清单中记录的参数。
+func NewObjectStore(store ShardStore, enc ReedSolomon) *ObjectStore {
+	return &ObjectStore{store: store, enc: enc}
+}
+
+// WithCompressor 返回在拆分前用 c 压缩新写入对象的对象存储，c 为nil时不压缩
+// 读取时按对象清单记录的算法解压，与此设置无关。
+func (s *ObjectStore) WithCompressor(c Compressor) *ObjectStore {
+	cp := *s
+	cp.comp = c
+	return &cp
+}
+
+// Put 读取 size 字节并以 id 保存，返回对象的清单
+// size 为负数时表示大小未知，先把 r 读到末尾并暂存到临时文件。
+// 对象已存在时返回满足 errors.Is(err, fs.ErrExist) 的错误。
+// 存储实现了 ExclusiveStore 时先写入空清单占用 id，写完所有分片后再替换为真正的清单，
+// 写入期间读取该对象返回 fs.ErrNotExist；否则只能先检查再写入，并发写入同一 id 时互相覆盖。
+// 写入失败时删除已写入的分片。
+func (s *ObjectStore) Put(id string, r io.Reader, size int64) (m *Manifest, err error) {
+	if size == 0 {
+		return nil, ErrSize
+	}
+	if err := s.claim(id); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			s.Delete(id)
+		}
+	}()
+
+	var spool *compressedSpool
+	if s.comp != nil {
+		// 清单中的对象大小和摘要描述压缩后的数据
+		src := r
+		if size > 0 {
+			src = io.LimitReader(r, size)
+		}
+		if spool, err = compressToTemp(s.comp, src); err != nil {
+			return nil, err
+		}
+		defer spool.Close()
+		if size > 0 && spool.raw != size {
+			return nil, ErrShortData
+		}
+		r, size = spool, spool.size
+	} else if size < 0 {
+		f, n, err := spoolToTemp(r)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			f.Close()
+			os.Remove(f.Name())
+		}()
+		r, size = f, n
+	}
+	if size == 0 || spool != nil && spool.raw == 0 {
+		return nil, ErrSize
+	}
+	b, err := NewManifestBuilder(s.enc, size)
+	if err != nil {
+		return nil, err
+	}
+	if spool != nil {
+		b.m.Compression, b.m.RawSize = s.comp.Name(), spool.raw
+	}
+
+	k := s.enc.DataShards()
+	err = s.putShards(id, 0, k, func(w []io.Writer) error {
+		return s.enc.StreamSplit(b.Object(r), b.DataWriters(w), size)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 从存储中读回数据分片生成校验分片
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		rc, err := s.store.Get(id, i)
+		if err != nil {
+			return nil, StreamReadError{Err: err, Stream: i}
+		}
+		defer rc.Close()
+		readers[i] = rc
+	}
+	err = s.putShards(id, k, s.enc.ParityShards(), func(w []io.Writer) error {
+		return s.enc.StreamEncode(readers, b.ParityWriters(w))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if m, err = b.Manifest(); err != nil {
+		return nil, err
+	}
+	mb, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(id, ManifestIndex, bytes.NewReader(mb)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// claim 占用对象 id，对象已存在时返回满足 errors.Is(err, fs.ErrExist) 的错误
+func (s *ObjectStore) claim(id string) error {
+	if es, ok := s.store.(ExclusiveStore); ok {
+		return es.Create(id, ManifestIndex, bytes.NewReader(nil))
+	}
+	rc, err := s.store.Get(id, ManifestIndex)
+	if err == nil {
+		rc.Close()
+		return fmt.Errorf("%s: %w", id, fs.ErrExist)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// spoolToTemp 把 r 的全部内容写入临时文件，返回读取位置在开头的文件和内容长度
+func spoolToTemp(r io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "reedsolomon-object-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+	return f, n, nil
+}
+
+// putShards 为分片 first 到 first+n-1 各启动一个 Put，fn 通过管道写入分片内容
+func (s *ObjectStore) putShards(id string, first, n int, fn func(w []io.Writer) error) error {
+	pipes := make([]*io.PipeWriter, n)
+	writers := make([]io.Writer, n)
+	errs := make(chan error, n)
+	for i := range pipes {
+		pr, pw := io.Pipe()
+		pipes[i], writers[i] = pw, pw
+		go func(index int) {
+			err := s.store.Put(id, index, pr)
+			pr.CloseWithError(err)
+			if err != nil {
+				err = StreamWriteError{Err: err, Stream: index}
+			}
+			errs <- err
+		}(first + i)
+	}
+
+	err := fn(writers)
+	for _, pw := range pipes {
+		// err 为nil时正常结束，否则 Put 读取出错，不会保存分片
+		pw.CloseWithError(err)
+	}
+	for range pipes {
+		if perr := <-errs; perr != nil && err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+// Stat 返回对象的清单
+func (s *ObjectStore) Stat(id string) (*Manifest, error) {
+	return loadManifest(s.store, id)
+}
+
+// Get 返回对象内容的读取器
+// 丢失的数据分片从其余分片重建到临时文件中；读到末尾时校验对象摘要，
+// 不一致时返回 ErrShardHashMismatch。调用方必须关闭返回的读取器。
+func (s *ObjectStore) Get(id string) (io.ReadCloser, error) {
+	m, err := s.Stat(id)
+	if err != nil {
+		return nil, err
+	}
+	enc := s.enc
+	if m.Check(enc) != nil {
+		if enc, err = m.NewEncoder(); err != nil {
+			return nil, err
+		}
+	}
+	list, err := s.store.List(id)
+	if err != nil {
+		return nil, err
+	}
+	present := make([]bool, m.TotalShards())
+	for _, i := range list {
+		if i < len(present) {
+			present[i] = true
+		}
+	}
+	if !enc.CanReconstruct(present) {
+		return nil, ErrTooFewShards
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.join(id, m, enc, present, pw))
+	}()
+	return pr, nil
+}
+
+// join 重建丢失的数据分片并把对象内容写入 w
+func (s *ObjectStore) join(id string, m *Manifest, enc ReedSolomon, present []bool, w io.Writer) error {
+	get := func(i int) (io.ReadCloser, error) {
+		return s.store.Get(id, i)
+	}
+	return joinShards(id, get, m, enc, present, w)
+}
+
+// joinShards 通过 get 读取分片，重建丢失的数据分片并把对象内容写入 w
+func joinShards(id string, get func(i int) (io.ReadCloser, error), m *Manifest, enc ReedSolomon, present []bool, w io.Writer) error {
+	k := m.DataShards
+	o := &storeOpener{get: get, m: m}
+	defer o.cleanup()
+
+	rebuild := make([]bool, len(present))
+	need := false
+	for i := 0; i < k; i++ {
+		rebuild[i] = !present[i]
+		need = need || rebuild[i]
+	}
+	if need {
+		if err := enc.StreamReconstructShards(o, present, rebuild); err != nil {
+			return err
+		}
+	}
+
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		r, err := o.openData(i)
+		if err != nil {
+			return StreamReadError{Err: err, Stream: i}
+		}
+		defer r.Close()
+		readers[i] = r
+	}
+	// 压缩的对象边合并边解压，摘要按压缩后的数据计算
+	var d *filterWriter
+	if m.Compression != "" {
+		d = newDecompressWriter(m, w)
+		w = d
+	}
+	h := sha256.New()
+	err := enc.StreamJoin(io.MultiWriter(w, h), readers, m.ObjectSize)
+	if err == nil && !bytes.Equal(h.Sum(nil), m.ObjectHash[:]) {
+		err = fmt.Errorf("%s: %w", id, ErrShardHashMismatch)
+	}
+	if d != nil {
+		err = d.CloseWithError(err)
+	}
+	return err
+}
+
+// Delete 删除对象的清单和所有分片，对象不存在时不返回错误
+// 先删除清单，中途失败时不会留下可读但不完整的对象。
+func (s *ObjectStore) Delete(id string) error {
+	if err := s.store.Delete(id, ManifestIndex); err != nil {
+		return err
+	}
+	list, err := s.store.List(id)
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, i := range list {
+		if err := s.store.Delete(id, i); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// storeOpener 为 StreamReconstructShards 打开分片
+// 读取的分片补零到 ShardSize，重建结果写入临时文件并校验摘要。
+type storeOpener struct {
+	get   func(i int) (io.ReadCloser, error)
+	m     *Manifest
+	temps map[int]*os.File
+}
+
+func (o *storeOpener) OpenShard(i int) (io.ReadCloser, error) {
+	rc, err := o.get(i)
+	if err != nil {
+		return nil, err
+	}
+	pad := o.m.ShardSize - o.m.ShardLen(i)
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(rc, io.LimitReader(zeroReader{}, pad)), rc}, nil
+}
+
+func (o *storeOpener) CreateShard(i int) (io.WriteCloser, error) {
+	f, err := os.CreateTemp("", "reedsolomon-shard-*")
+	if err != nil {
+		return nil, err
+	}
+	if o.temps == nil {
+		o.temps = make(map[int]*os.File)
+	}
+	o.temps[i] = f
+	return &verifyWriter{f: f, h: sha256.New(), limit: o.m.ShardLen(i), want: o.m.ShardHashes[i]}, nil
+}
+
+// openData 打开数据分片，已重建的分片从临时文件读取
+func (o *storeOpener) openData(i int) (io.ReadCloser, error) {
+	f, ok := o.temps[i]
+	if !ok {
+		return o.get(i)
+	}
+	if err := f.Truncate(o.m.ShardLen(i)); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(f), nil
+}
+
+// cleanup 删除临时文件
+func (o *storeOpener) cleanup() {
+	for _, f := range o.temps {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+// verifyWriter 写入重建的分片，关闭时检查前 limit 字节的摘要
+// 文件在关闭后仍需读取，因此 Close 不关闭文件。
+type verifyWriter struct {
+	f     *os.File
+	h     hash.Hash
+	n     int64
+	limit int64
+	want  Digest
+}
+
+func (w *verifyWriter) Write(p []byte) (int, error) {
+	if rest := w.limit - w.n; rest > 0 {
+		w.h.Write(p[:min(int64(len(p)), rest)])
+	}
+	w.n += int64(len(p))
+	return w.f.Write(p)
+}
+
+func (w *verifyWriter) Close() error {
+	if w.n < w.limit || !bytes.Equal(w.h.Sum(nil), w.want[:]) {
+		return ErrShardHashMismatch
+	}
+	return nil
+}
+
+// zeroReader 无限输出0
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
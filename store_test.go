@@ -0,0 +1,343 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 测试目录分片存储：分散放置、原子写入、丢失目录后读取
+func TestObjectStore(t *testing.T) {
+	testObjectStore(t, 10, 4, false)
+	testObjectStore(t, 250, 20, true)
+}
+
+func testObjectStore(t *testing.T, dataShards, parityShards int, useFF16 bool) {
+	var enc ReedSolomon
+	var err error
+	if useFF16 {
+		enc, err = New16(dataShards, parityShards)
+	} else {
+		enc, err = New8(dataShards, parityShards)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := dataShards + parityShards
+
+	root := t.TempDir()
+	dirs := make([]string, total+2)
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, fmt.Sprintf("disk%d", i))
+		if err := os.Mkdir(dirs[i], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds, err := NewDirStore(dirs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewObjectStore(ds, enc)
+
+	data := make([]byte, 300000)
+	rand.New(rand.NewSource(int64(total))).Read(data)
+	m, err := s.Put("obj", bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.TotalShards() != total {
+		t.Fatalf("清单分片数量 %d", m.TotalShards())
+	}
+	if _, err := s.Put("obj", bytes.NewReader(data), int64(len(data))); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("期望 fs.ErrExist，实际 %v", err)
+	}
+
+	// 每个目录最多一个分片，每个目录都有清单
+	for _, d := range dirs {
+		entries, err := os.ReadDir(filepath.Join(d, "obj"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 2 || entries[len(entries)-1].Name() != manifestFile {
+			t.Fatalf("%s 中的文件: %v", d, entries)
+		}
+	}
+	list, err := ds.List("obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != total {
+		t.Fatalf("期望 %d 个分片，实际 %d", total, len(list))
+	}
+
+	get := func() ([]byte, error) {
+		t.Helper()
+		rc, err := s.Get("obj")
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	got, err := get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("读取的对象不一致")
+	}
+
+	// 丢失存放数据分片 0 和最后一个数据分片的整个目录以及若干其他目录
+	lost := map[string]bool{}
+	for _, i := range []int{0, dataShards - 1} {
+		d, err := ds.ShardDir("obj", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lost[d] = true
+	}
+	for i := 1; len(lost) < parityShards; i++ {
+		d, _ := ds.ShardDir("obj", i)
+		lost[d] = true
+	}
+	for d := range lost {
+		if err := os.RemoveAll(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("丢失目录后读取的对象不一致")
+	}
+
+	// 损坏一个用于重建的分片，重建结果校验失败
+	p := filepath.Join(must(ds.ShardDir("obj", dataShards)), "obj", fmt.Sprint(dataShards))
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[0] ^= 1
+	if err := os.WriteFile(p, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := get(); !errors.Is(err, ErrShardHashMismatch) {
+		t.Fatalf("期望 ErrShardHashMismatch，实际 %v", err)
+	}
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// 再丢失一个分片后无法恢复
+	for i := 0; i < total; i++ {
+		d, _ := ds.ShardDir("obj", i)
+		if !lost[d] && i != dataShards {
+			os.RemoveAll(filepath.Join(d, "obj", fmt.Sprint(i)))
+			break
+		}
+	}
+	if _, err := get(); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+
+	if err := s.Delete("obj"); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := ds.List("obj"); len(list) != 0 {
+		t.Fatalf("删除后仍有分片 %v", list)
+	}
+	if _, err := s.Stat("obj"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("期望 fs.ErrNotExist，实际 %v", err)
+	}
+}
+
+// errReader 读取若干字节后返回错误
+type errReader struct {
+	n int
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := len(p)
+	if n > r.n {
+		n = r.n
+	}
+	r.n -= n
+	return n, nil
+}
+
+// 测试并发写入同一对象只有一个成功，以及大小未知时的写入
+func TestObjectStoreCreate(t *testing.T) {
+	root := t.TempDir()
+	dirs := make([]string, 6)
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, fmt.Sprint(i))
+		if err := os.Mkdir(dirs[i], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds, err := NewDirStore(dirs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewObjectStore(ds, enc)
+	data := make([]byte, 50000)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	const n = 8
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := s.Put("race", bytes.NewReader(data), int64(len(data)))
+			errs <- err
+		}()
+	}
+	ok := 0
+	for i := 0; i < n; i++ {
+		err := <-errs
+		switch {
+		case err == nil:
+			ok++
+		case !errors.Is(err, fs.ErrExist):
+			t.Fatalf("期望 fs.ErrExist，实际 %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("%d 个并发写入成功", ok)
+	}
+	rc, err := s.Get("race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("读取的对象不一致: %v", err)
+	}
+
+	// 大小未知，压缩和不压缩
+	for _, c := range []Compressor{nil, NewGzipCompressor(0)} {
+		ws := s.WithCompressor(c)
+		m, err := ws.Put("unsized", io.MultiReader(bytes.NewReader(data[:100]), bytes.NewReader(data[100:])), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c == nil && m.ObjectSize != int64(len(data)) || c != nil && m.RawSize != int64(len(data)) {
+			t.Fatalf("清单中的大小 %d/%d", m.ObjectSize, m.RawSize)
+		}
+		rc, err := ws.Get("unsized")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("读取的对象不一致: %v", err)
+		}
+		if err := ws.Delete("unsized"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.Put("empty", bytes.NewReader(nil), -1); err != ErrSize {
+			t.Fatalf("期望 ErrSize，实际 %v", err)
+		}
+	}
+
+	// 正在写入的对象（只有占位的空清单）视为不存在
+	if err := ds.Create("pending", ManifestIndex, bytes.NewReader(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("pending"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("期望 fs.ErrNotExist，实际 %v", err)
+	}
+	if _, err := s.Put("pending", bytes.NewReader(data), int64(len(data))); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("期望 fs.ErrExist，实际 %v", err)
+	}
+}
+
+// 测试写入失败时不留下分片和临时文件，以及目录不足时拒绝写入
+func TestObjectStoreFailures(t *testing.T) {
+	root := t.TempDir()
+	dirs := make([]string, 6)
+	for i := range dirs {
+		dirs[i] = filepath.Join(root, fmt.Sprint(i))
+		if err := os.Mkdir(dirs[i], 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ds, err := NewDirStore(dirs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewObjectStore(ds, enc)
+
+	if _, err := s.Put("a", &errReader{n: 5000}, 10000); err == nil {
+		t.Fatal("读取失败时 Put 应返回错误")
+	}
+	for _, d := range dirs {
+		entries, _ := os.ReadDir(d)
+		if len(entries) != 0 {
+			t.Fatalf("%s 中残留文件 %v", d, entries)
+		}
+	}
+
+	enc, err = New(5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewObjectStore(ds, enc).Put("b", bytes.NewReader(make([]byte, 1000)), 1000)
+	if !errors.Is(err, ErrPlacement) {
+		t.Fatalf("期望 ErrPlacement，实际 %v", err)
+	}
+
+	for _, id := range []string{"", "..", "a/b"} {
+		if err := ds.Put(id, 0, bytes.NewReader(nil)); !errors.Is(err, ErrInvalidObjectID) {
+			t.Fatalf("%q: 期望 ErrInvalidObjectID，实际 %v", id, err)
+		}
+	}
+	if _, err := NewDirStore(dirs[0], dirs[0]); err == nil {
+		t.Fatal("重复目录应返回错误")
+	}
+
+	// 目录消失（例如磁盘被卸载）后拒绝写入，也不会重新创建目录
+	if err := os.Remove(dirs[2]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(dirs); i++ {
+		if d, _ := ds.ShardDir("c", i); d == dirs[2] {
+			if err := ds.Put("c", i, bytes.NewReader([]byte("x"))); !errors.Is(err, ErrDirChanged) {
+				t.Fatalf("期望 ErrDirChanged，实际 %v", err)
+			}
+		}
+	}
+	if err := ds.Put("c", ManifestIndex, bytes.NewReader([]byte("{}"))); !errors.Is(err, ErrDirChanged) {
+		t.Fatalf("期望 ErrDirChanged，实际 %v", err)
+	}
+	if _, err := os.Stat(dirs[2]); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("不应重新创建目录: %v", err)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -24,6 +24,7 @@ type rsStream16 struct {
 
 	blockPool sync.Pool     // 分片缓冲池
 	o         streamOptions // 选项
+	resume    *Checkpoint   // 恢复操作的起始检查点
 
 	// 并发控制
 	concurrentReads  bool // 是否并发读取
@@ -31,7 +32,7 @@ type rsStream16 struct {
 }
 
 // newStreamEncoderFF16 创建一个新的GF(2^16) Reed-Solomon流式编码器
-func newStreamEncoderFF16(dataShards, parityShards int) (*rsStream16, error) {
+func newStreamEncoderFF16(dataShards, parityShards int, o streamOptions) (*rsStream16, error) {
 	// 参数验证
 	if dataShards <= 0 {
 		return nil, ErrInvShardNum
@@ -45,9 +46,10 @@ func newStreamEncoderFF16(dataShards, parityShards int) (*rsStream16, error) {
 		dataShards:       dataShards,
 		parityShards:     parityShards,
 		totalShards:      dataShards + parityShards,
-		blockSize:        4 * 1024 * 1024, // 4MB 块大小
-		concurrentReads:  false,
-		concurrentWrites: false,
+		blockSize:        o.blockSize(),
+		o:                o,
+		concurrentReads:  o.concReads,
+		concurrentWrites: o.concWrites,
 	}
 
 	// 确保块大小是16位对齐的 (每两个字节为一个16位字)
@@ -325,10 +327,12 @@ func (r *rsStream16) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		return ErrTooFewShards
 	}
 
-	// 确保我们有足够的空间做重建，创建缓冲区
+	// 只为需要读取的分片创建缓冲区，丢失分片的空间由重建时分配
 	all := make([][]byte, r.totalShards)
 	for i := range all {
-		all[i] = make([]byte, r.blockSize)
+		if inputs[i] != nil {
+			all[i] = make([]byte, r.blockSize)
+		}
 	}
 
 	// 检查是否有冲突的输入输出
@@ -355,7 +359,10 @@ func (r *rsStream16) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		return nil
 	}
 
-	read := 0
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpReconstruct, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
+	read := t.resumedBytes()
 	for {
 		// 读取所有非缺失分片的数据
 		size := 0
@@ -404,8 +411,8 @@ func (r *rsStream16) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 
 		// 第二次遍历：调整所有非缺失分片的大小并填充，缺失分片保持长度为0
 		for i := range all {
-			if missingShards[i] {
-				// 这是需要重建的分片，设置为长度0的空片
+			if inputs[i] == nil {
+				// 这是丢失的分片（无论是否需要输出），设置为长度0的空片
 				all[i] = all[i][:0]
 			} else if len(all[i]) == 0 {
 				// 这是一个空的非缺失分片（不应该发生）
@@ -431,12 +438,12 @@ func (r *rsStream16) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		}
 
 		// 执行重建 - 调用基础库的重建函数
-		var err error
-		if reconDataOnly {
-			err = r.rs.ReconstructData(all)
-		} else {
-			err = r.rs.Reconstruct(all)
-		}
+		err := t.compute(func() error {
+			if reconDataOnly {
+				return r.rs.ReconstructData(all)
+			}
+			return r.rs.Reconstruct(all)
+		})
 		if err != nil {
 			return err
 		}
@@ -464,6 +471,10 @@ func (r *rsStream16) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		}
 
 		read += origSize
+
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
 
@@ -476,9 +487,6 @@ func (r *rsStream16) reconstructData(inputs []io.Reader, outputs []io.Writer) er
 		return ErrTooFewShards
 	}
 
-	all := r.createSlice()
-	defer r.blockPool.Put(all)
-
 	// 检查是否有冲突的输入输出
 	for i := range inputs {
 		if inputs[i] != nil && outputs[i] != nil {
@@ -486,15 +494,26 @@ func (r *rsStream16) reconstructData(inputs []io.Reader, outputs []io.Writer) er
 		}
 	}
 
-	// 创建一个跟踪缺失分片的映射
+	// 只为需要读取的分片创建缓冲区，分片很多时可以大幅减少内存占用
+	all := make([][]byte, r.totalShards)
+	for i := range all {
+		if inputs[i] != nil {
+			all[i] = make([]byte, r.blockSize)
+		}
+	}
+
+	// 创建一个跟踪缺失分片的映射，所有没有输入的分片都视为丢失
 	missingShards := make([]bool, r.totalShards)
-	for i := 0; i < r.dataShards; i++ {
-		if inputs[i] == nil && outputs[i] != nil {
+	for i := range inputs {
+		if inputs[i] == nil {
 			missingShards[i] = true // 标记此分片需要重建
 		}
 	}
 
-	read := 0
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpReconstruct, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
+	read := t.resumedBytes()
 	for {
 		// 读取所有分片数据
 		size := -1 // 初始化为-1表示尚未设置
@@ -597,8 +616,8 @@ func (r *rsStream16) reconstructData(inputs []io.Reader, outputs []io.Writer) er
 
 		read += size
 
-		// 为缺失分片准备空间，但保持长度为0
-		for i := range missingShards {
+		// 为缺失的数据分片准备空间，但保持长度为0
+		for i := 0; i < r.dataShards; i++ {
 			if missingShards[i] {
 				// 确保有足够的容量但长度为0
 				if cap(all[i]) < alignedSize {
@@ -610,7 +629,7 @@ func (r *rsStream16) reconstructData(inputs []io.Reader, outputs []io.Writer) er
 		}
 
 		// 只重建数据分片
-		if err := r.rs.ReconstructData(all); err != nil {
+		if err := t.compute(func() error { return r.rs.ReconstructData(all) }); err != nil {
 			return err
 		}
 
@@ -628,6 +647,10 @@ func (r *rsStream16) reconstructData(inputs []io.Reader, outputs []io.Writer) er
 				return StreamWriteError{Err: io.ErrShortWrite, Stream: i}
 			}
 		}
+
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
 
@@ -642,6 +665,11 @@ func (r *rsStream16) split(data io.Reader, dst []io.Writer, size int64) error {
 		return ErrShortData
 	}
 
+	t, in, dst := newStreamTracker(&r.o, StreamOpSplit, r.blockSize, []io.Reader{data}, dst, nil)
+	defer t.finish()
+	t.setTotal(size)
+	data = in[0]
+
 	// 确保大小是2字节对齐的
 	alignedSize := size
 	if size%2 != 0 {
@@ -656,8 +684,10 @@ func (r *rsStream16) split(data io.Reader, dst []io.Writer, size int64) error {
 	// 计算每个分片的大小 - 均匀分配
 	perShard := alignedSize / int64(r.dataShards)
 
-	// 确保分片大小是64字节对齐的
-	if perShard%64 != 0 {
+	// 确保分片大小是64字节对齐的，对象小于数据分片数时也不产生空分片
+	if perShard == 0 {
+		perShard = 64
+	} else if perShard%64 != 0 {
 		perShard = ((perShard + 63) / 64) * 64
 	}
 
@@ -669,7 +699,9 @@ func (r *rsStream16) split(data io.Reader, dst []io.Writer, size int64) error {
 		// 调整策略，重新计算每个分片大小，确保最后一个分片至少有1字节
 		perShard = (size - 1) / int64(r.dataShards-1)
 		// 确保分片大小是64字节对齐的
-		if perShard%64 != 0 {
+		if perShard == 0 {
+			perShard = 64
+		} else if perShard%64 != 0 {
 			perShard = ((perShard + 63) / 64) * 64
 		}
 		lastShardSize = size - perShard*int64(r.dataShards-1)
@@ -747,6 +779,9 @@ func (r *rsStream16) split(data io.Reader, dst []io.Writer, size int64) error {
 		if err != nil {
 			return err
 		}
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -891,6 +926,14 @@ func (r *rsStream16) join(dst io.Writer, shards []io.Reader, outSize int64) erro
 		return ErrSize
 	}
 
+	t, in, out := newStreamTracker(&r.o, StreamOpJoin, r.blockSize, shards, []io.Writer{dst}, nil)
+	defer t.finish()
+	t.setTotal(outSize)
+	t.reportWrites()
+	// 选择读取方式时需要检查原始分片是否支持 Seek
+	seekable := shards
+	shards, dst = in, out[0]
+
 	// 特殊处理：极小数据（少于或等于分片数）的特殊情况
 	if outSize <= int64(r.dataShards) {
 		// 对于极小数据，直接从第一个非nil的分片读取所有数据
@@ -961,11 +1004,11 @@ func (r *rsStream16) join(dst io.Writer, shards []io.Reader, outSize int64) erro
 
 	// 创建一个seeker检查器
 	allSeekable := true
-	for _, shard := range dataShards {
+	for i, shard := range dataShards {
 		if shard == nil {
 			continue
 		}
-		_, ok := shard.(io.Seeker)
+		_, ok := seekable[i].(io.Seeker)
 		if !ok {
 			allSeekable = false
 			break
@@ -1234,6 +1277,9 @@ func (r *rsStream16) encode(inputs []io.Reader, outputs []io.Writer) error {
 		return ErrTooFewShards
 	}
 
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpEncode, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
 	// 获取缓冲区
 	shards := r.createSlice()
 
@@ -1301,7 +1347,7 @@ func (r *rsStream16) encode(inputs []io.Reader, outputs []io.Writer) error {
 		}
 
 		// 编码
-		if err := r.rs.Encode(shards); err != nil {
+		if err := t.compute(func() error { return r.rs.Encode(shards) }); err != nil {
 			return err
 		}
 
@@ -1314,5 +1360,8 @@ func (r *rsStream16) encode(inputs []io.Reader, outputs []io.Writer) error {
 		if err != nil {
 			return err
 		}
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
@@ -30,6 +30,10 @@ func (e StreamReadError) Error() string {
 	return fmt.Sprintf("error reading stream %d: %v", e.Stream, e.Err)
 }
 
+func (e StreamReadError) Unwrap() error {
+	return e.Err
+}
+
 // 流写入错误
 type StreamWriteError struct {
 	Err    error
@@ -40,11 +44,8 @@ func (e StreamWriteError) Error() string {
 	return fmt.Sprintf("error writing to stream %d: %v", e.Stream, e.Err)
 }
 
-// 流式操作选项
-type streamOptions struct {
-	streamBS   int  // 流块大小
-	concReads  bool // 并发读取
-	concWrites bool // 并发写入
+func (e StreamWriteError) Unwrap() error {
+	return e.Err
 }
 
 // rsStreamFF8 是基于GF(2^8)的Reed-Solomon流式编码器的内部实现
@@ -59,6 +60,7 @@ type rsStreamFF8 struct {
 
 	blockPool sync.Pool     // 分片缓冲池
 	o         streamOptions // 选项
+	resume    *Checkpoint   // 恢复操作的起始检查点
 
 	// 并发控制
 	concurrentReads  bool // 是否并发读取
@@ -66,7 +68,7 @@ type rsStreamFF8 struct {
 }
 
 // newStreamEncoderFF8 创建一个新的GF(2^8) Reed-Solomon流式编码器
-func newStreamEncoderFF8(dataShards, parityShards int) (*rsStreamFF8, error) {
+func newStreamEncoderFF8(dataShards, parityShards int, o streamOptions) (*rsStreamFF8, error) {
 	// 参数验证
 	if dataShards <= 0 {
 		return nil, ErrInvShardNum
@@ -80,9 +82,10 @@ func newStreamEncoderFF8(dataShards, parityShards int) (*rsStreamFF8, error) {
 		dataShards:       dataShards,
 		parityShards:     parityShards,
 		totalShards:      dataShards + parityShards,
-		blockSize:        4 * 1024 * 1024, // 4MB 块大小
-		concurrentReads:  false,
-		concurrentWrites: false,
+		blockSize:        o.blockSize(),
+		o:                o,
+		concurrentReads:  o.concReads,
+		concurrentWrites: o.concWrites,
 	}
 
 	// 创建基础编码器
@@ -114,6 +117,9 @@ func (r *rsStreamFF8) encode(inputs []io.Reader, outputs []io.Writer) error {
 		return ErrTooFewShards
 	}
 
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpEncode, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
 	// 获取缓冲区
 	shards := r.createSlice()
 	defer r.blockPool.Put(shards)
@@ -164,7 +170,7 @@ func (r *rsStreamFF8) encode(inputs []io.Reader, outputs []io.Writer) error {
 		}
 
 		// 编码
-		if err := r.rs.Encode(shards); err != nil {
+		if err := t.compute(func() error { return r.rs.Encode(shards) }); err != nil {
 			return err
 		}
 
@@ -177,6 +183,9 @@ func (r *rsStreamFF8) encode(inputs []io.Reader, outputs []io.Writer) error {
 		if err != nil {
 			return err
 		}
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
 
@@ -466,7 +475,10 @@ func (r *rsStreamFF8) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		}
 	}
 
-	read := 0
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpReconstruct, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
+	read := t.resumedBytes()
 	for {
 		// 读取所有分片数据
 		size := -1 // 初始化为-1表示尚未设置
@@ -505,6 +517,10 @@ func (r *rsStreamFF8) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 
 		// 调整所有分片到统一大小
 		for i := range all {
+			if inputs[i] == nil {
+				// 丢失的分片保持长度为0，由重建填充
+				continue
+			}
 			currentSize := len(all[i])
 			if currentSize == 0 {
 				// 空分片扩展并填充0
@@ -573,12 +589,12 @@ func (r *rsStreamFF8) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 		}
 
 		// 重建
-		var err error
-		if reconDataOnly {
-			err = r.rs.ReconstructData(all)
-		} else {
-			err = r.rs.Reconstruct(all)
-		}
+		err := t.compute(func() error {
+			if reconDataOnly {
+				return r.rs.ReconstructData(all)
+			}
+			return r.rs.Reconstruct(all)
+		})
 		if err != nil {
 			return err
 		}
@@ -602,6 +618,10 @@ func (r *rsStreamFF8) reconstruct(inputs []io.Reader, outputs []io.Writer) error
 				return StreamWriteError{Err: io.ErrShortWrite, Stream: i}
 			}
 		}
+
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
 
@@ -624,15 +644,18 @@ func (r *rsStreamFF8) reconstructData(inputs []io.Reader, outputs []io.Writer) e
 		}
 	}
 
-	// 创建一个跟踪缺失分片的映射
+	// 创建一个跟踪缺失分片的映射，所有没有输入的分片都视为丢失
 	missingShards := make([]bool, r.totalShards)
-	for i := 0; i < r.dataShards; i++ {
-		if inputs[i] == nil && outputs[i] != nil {
+	for i := range inputs {
+		if inputs[i] == nil {
 			missingShards[i] = true // 标记此分片需要重建
 		}
 	}
 
-	read := 0
+	t, inputs, outputs := newStreamTracker(&r.o, StreamOpReconstruct, r.blockSize, inputs, outputs, r.resume)
+	defer t.finish()
+
+	read := t.resumedBytes()
 	for {
 		// 读取所有分片数据
 		size := -1 // 初始化为-1表示尚未设置
@@ -744,7 +767,7 @@ func (r *rsStreamFF8) reconstructData(inputs []io.Reader, outputs []io.Writer) e
 		}
 
 		// 只重建数据分片
-		if err := r.rs.ReconstructData(all); err != nil {
+		if err := t.compute(func() error { return r.rs.ReconstructData(all) }); err != nil {
 			return err
 		}
 
@@ -762,6 +785,10 @@ func (r *rsStreamFF8) reconstructData(inputs []io.Reader, outputs []io.Writer) e
 				return StreamWriteError{Err: io.ErrShortWrite, Stream: i}
 			}
 		}
+
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 }
 
@@ -776,6 +803,11 @@ func (r *rsStreamFF8) split(data io.Reader, dst []io.Writer, size int64) error {
 		return ErrShortData
 	}
 
+	t, in, dst := newStreamTracker(&r.o, StreamOpSplit, r.blockSize, []io.Reader{data}, dst, nil)
+	defer t.finish()
+	t.setTotal(size)
+	data = in[0]
+
 	// 确保大小是64字节对齐的
 	alignedSize := size
 	if alignedSize%64 != 0 {
@@ -785,8 +817,10 @@ func (r *rsStreamFF8) split(data io.Reader, dst []io.Writer, size int64) error {
 	// 计算每个分片的大小 - 均匀分配
 	perShard := alignedSize / int64(r.dataShards)
 
-	// 确保分片大小是64字节对齐的
-	if perShard%64 != 0 {
+	// 确保分片大小是64字节对齐的，对象小于数据分片数时也不产生空分片
+	if perShard == 0 {
+		perShard = 64
+	} else if perShard%64 != 0 {
 		perShard = ((perShard + 63) / 64) * 64
 	}
 
@@ -798,7 +832,9 @@ func (r *rsStreamFF8) split(data io.Reader, dst []io.Writer, size int64) error {
 		// 调整策略，重新计算每个分片大小，确保最后一个分片至少有1字节
 		perShard = (size - 1) / int64(r.dataShards-1)
 		// 确保分片大小是64字节对齐的
-		if perShard%64 != 0 {
+		if perShard == 0 {
+			perShard = 64
+		} else if perShard%64 != 0 {
 			perShard = ((perShard + 63) / 64) * 64
 		}
 		lastShardSize = size - perShard*int64(r.dataShards-1)
@@ -871,6 +907,9 @@ func (r *rsStreamFF8) split(data io.Reader, dst []io.Writer, size int64) error {
 		if err != nil {
 			return err
 		}
+		if err := t.blockDone(); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -1012,6 +1051,14 @@ func (r *rsStreamFF8) join(dst io.Writer, shards []io.Reader, outSize int64) err
 		return ErrSize
 	}
 
+	t, in, out := newStreamTracker(&r.o, StreamOpJoin, r.blockSize, shards, []io.Writer{dst}, nil)
+	defer t.finish()
+	t.setTotal(outSize)
+	t.reportWrites()
+	// 选择读取方式时需要检查原始分片是否支持 Seek
+	seekable := shards
+	shards, dst = in, out[0]
+
 	// 特殊处理：极小数据（少于或等于分片数）的特殊情况
 	if outSize <= int64(r.dataShards) {
 		// 对于极小数据，直接从第一个非nil的分片读取所有数据
@@ -1120,11 +1167,11 @@ func (r *rsStreamFF8) join(dst io.Writer, shards []io.Reader, outSize int64) err
 
 	// 创建一个seeker检查器
 	allSeekable := true
-	for _, shard := range dataShards {
+	for i, shard := range dataShards {
 		if shard == nil {
 			continue
 		}
-		_, ok := shard.(io.Seeker)
+		_, ok := seekable[i].(io.Seeker)
 		if !ok {
 			allSeekable = false
 			break
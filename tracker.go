@@ -0,0 +1,323 @@
+/**
+ * Reed-Solomon 编码库 - 流式操作进度跟踪
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"io"
+	"io/fs"
+	"time"
+)
+
+// 流式操作类型，用于检查点、进度和统计信息
+const (
+	StreamOpEncode      = "encode"      // StreamEncode
+	StreamOpReconstruct = "reconstruct" // StreamReconstruct / StreamReconstructData
+	StreamOpSplit       = "split"       // StreamSplit
+	StreamOpJoin        = "join"        // StreamJoin
+)
+
+// Progress 是流式操作每处理完一个块时报告的进度
+type Progress struct {
+	Op             string        // 操作类型
+	Block          int64         // 已完成的块数
+	BytesProcessed int64         // 已处理的字节数，合并操作为已写出的字节数
+	TotalBytes     int64         // 需要处理的总字节数，未知时为0
+	Elapsed        time.Duration // 本次调用已经过的时间
+}
+
+// StreamStats 是一次流式操作结束时的汇总信息
+// 时间为所有流的累计值，并发读写时可能大于 Elapsed。
+type StreamStats struct {
+	Op           string        // 操作类型
+	Blocks       int64         // 本次调用处理的块数
+	BytesRead    []int64       // 每个输入流读取的字节数，与输入一一对应
+	BytesWritten []int64       // 每个输出流写入的字节数，与输出一一对应
+	ReadTime     time.Duration // 读取输入所用的时间
+	ComputeTime  time.Duration // 编码/重建计算所用的时间
+	WriteTime    time.Duration // 写入输出所用的时间
+	Elapsed      time.Duration // 总耗时
+}
+
+// TotalRead 返回所有输入流读取的总字节数
+func (s *StreamStats) TotalRead() int64 {
+	var n int64
+	for _, v := range s.BytesRead {
+		n += v
+	}
+	return n
+}
+
+// TotalWritten 返回所有输出流写入的总字节数
+func (s *StreamStats) TotalWritten() int64 {
+	var n int64
+	for _, v := range s.BytesWritten {
+		n += v
+	}
+	return n
+}
+
+// Throughput 返回按读取字节数计算的吞吐量（字节/秒）
+func (s *StreamStats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.TotalRead()) / s.Elapsed.Seconds()
+}
+
+// countingReader 统计已读取的字节数和读取耗时
+type countingReader struct {
+	r io.Reader
+	n int64
+	d time.Duration
+}
+
+// Read 实现 io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := c.r.Read(p)
+	c.d += time.Since(start)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter 统计已写入的字节数和写入耗时
+type countingWriter struct {
+	w io.Writer
+	n int64
+	d time.Duration
+	t *streamTracker // 非nil时每次写入都报告进度
+}
+
+// Write 实现 io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := c.w.Write(p)
+	c.d += time.Since(start)
+	c.n += int64(n)
+	if err == nil && c.t != nil {
+		err = c.t.blockDone()
+	}
+	return n, err
+}
+
+// streamTracker 在流式操作的块循环中记录进度
+// nil 跟踪器的所有方法都是空操作。
+type streamTracker struct {
+	op        string
+	blockSize int
+	began     time.Time
+
+	// 检查点
+	every      int
+	checkpoint func(*Checkpoint) error
+
+	// 进度和统计
+	progress func(Progress)
+	stats    func(*StreamStats)
+	total    int64
+
+	computed   time.Duration     // 编码/重建计算所用的时间
+	block      int64             // 已完成的块数
+	startBlock int64             // 恢复前已完成的块数
+	start      []int64           // 恢复前每个输入流的偏移
+	startOut   []int64           // 恢复前每个输出流的偏移
+	in         []*countingReader // 与输入流一一对应，nil 表示该流不存在
+	out        []*countingWriter // 与输出流一一对应，nil 表示该流不存在
+}
+
+// newStreamTracker 创建跟踪器并返回包装后的输入输出流
+// 没有配置检查点、进度或统计回调且不是恢复操作时，返回 nil 跟踪器和原始流。
+func newStreamTracker(o *streamOptions, op string, blockSize int, inputs []io.Reader, outputs []io.Writer, resume *Checkpoint) (*streamTracker, []io.Reader, []io.Writer) {
+	if o.checkpoint == nil && o.progress == nil && o.stats == nil && resume == nil {
+		return nil, inputs, outputs
+	}
+
+	t := &streamTracker{
+		op:        op,
+		blockSize: blockSize,
+		began:     time.Now(),
+		progress:  o.progress,
+		stats:     o.stats,
+		start:     make([]int64, len(inputs)),
+		startOut:  make([]int64, len(outputs)),
+		in:        make([]*countingReader, len(inputs)),
+		out:       make([]*countingWriter, len(outputs)),
+	}
+	// 检查点只对编码和重建有意义
+	if op == StreamOpEncode || op == StreamOpReconstruct {
+		t.every = o.checkpointEvery
+		t.checkpoint = o.checkpoint
+	}
+	if resume != nil {
+		t.block = resume.Block
+		t.startBlock = resume.Block
+	}
+
+	known := true
+	wrappedIn := make([]io.Reader, len(inputs))
+	for i, r := range inputs {
+		if r == nil {
+			continue
+		}
+		c := &countingReader{r: r}
+		if resume != nil {
+			c.n = resume.Inputs[i]
+			t.start[i] = c.n
+		}
+		if size := streamSize(r, c.n); size >= 0 {
+			t.total += size
+		} else {
+			known = false
+		}
+		t.in[i] = c
+		wrappedIn[i] = c
+	}
+	if !known {
+		t.total = 0
+	}
+
+	wrappedOut := make([]io.Writer, len(outputs))
+	for i, w := range outputs {
+		if w == nil {
+			continue
+		}
+		c := &countingWriter{w: w}
+		if resume != nil {
+			c.n = resume.Outputs[i]
+			t.startOut[i] = c.n
+		}
+		t.out[i] = c
+		wrappedOut[i] = c
+	}
+	return t, wrappedIn, wrappedOut
+}
+
+// streamSize 尽量获取输入流的总大小，offset 是流当前已经读过的字节数
+// 无法得知时返回-1。
+func streamSize(r io.Reader, offset int64) int64 {
+	switch v := r.(type) {
+	case interface{ Stat() (fs.FileInfo, error) }:
+		fi, err := v.Stat()
+		if err == nil && fi.Mode().IsRegular() {
+			return fi.Size()
+		}
+	case interface{ Len() int }:
+		return offset + int64(v.Len())
+	}
+	return -1
+}
+
+// setTotal 设置已知的总字节数，用于拆分和合并这类大小由参数给出的操作
+func (t *streamTracker) setTotal(n int64) {
+	if t != nil {
+		t.total = n
+	}
+}
+
+// reportWrites 让输出流在每次写入后报告进度，用于没有块循环的合并操作
+func (t *streamTracker) reportWrites() {
+	if t == nil {
+		return
+	}
+	for _, c := range t.out {
+		if c != nil {
+			c.t = t
+		}
+	}
+}
+
+// resumedBytes 返回恢复前已经读取的字节数，非恢复操作返回0
+func (t *streamTracker) resumedBytes() int {
+	if t == nil {
+		return 0
+	}
+	var n int64
+	for _, v := range t.start {
+		n += v
+	}
+	return int(n)
+}
+
+// processed 返回已处理的字节数（包括恢复前的部分）
+// 合并操作按写出的字节数计算，其他操作按读取的字节数计算。
+func (t *streamTracker) processed() int64 {
+	var n int64
+	if t.op == StreamOpJoin {
+		for _, c := range t.out {
+			if c != nil {
+				n += c.n
+			}
+		}
+		return n
+	}
+	for _, c := range t.in {
+		if c != nil {
+			n += c.n
+		}
+	}
+	return n
+}
+
+// blockDone 在一个块的输出全部写入后调用
+func (t *streamTracker) blockDone() error {
+	if t == nil {
+		return nil
+	}
+	t.block++
+	if t.progress != nil {
+		t.progress(Progress{
+			Op:             t.op,
+			Block:          t.block,
+			BytesProcessed: t.processed(),
+			TotalBytes:     t.total,
+			Elapsed:        time.Since(t.began),
+		})
+	}
+	if t.checkpoint == nil || t.block%int64(t.every) != 0 {
+		return nil
+	}
+	return t.checkpoint(t.snapshot())
+}
+
+// compute 执行一次编码或重建计算并累计所用的时间
+func (t *streamTracker) compute(fn func() error) error {
+	if t == nil {
+		return fn()
+	}
+	start := time.Now()
+	err := fn()
+	t.computed += time.Since(start)
+	return err
+}
+
+// finish 在操作结束时报告汇总信息
+func (t *streamTracker) finish() {
+	if t == nil || t.stats == nil {
+		return
+	}
+	s := &StreamStats{
+		Op:           t.op,
+		Blocks:       t.block - t.startBlock,
+		BytesRead:    make([]int64, len(t.in)),
+		BytesWritten: make([]int64, len(t.out)),
+		Elapsed:      time.Since(t.began),
+		ComputeTime:  t.computed,
+	}
+	for i, c := range t.in {
+		if c != nil {
+			s.BytesRead[i] = c.n - t.start[i]
+			s.ReadTime += c.d
+		}
+	}
+	for i, c := range t.out {
+		if c != nil {
+			s.BytesWritten[i] = c.n - t.startOut[i]
+			s.WriteTime += c.d
+		}
+	}
+	t.stats(s)
+}
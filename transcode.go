@@ -0,0 +1,169 @@
+/**
+ * Reed-Solomon 编码库 - 转码
+ *
+ * Copyright 2024
+ */
+
+package reedsolomon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// Transcode 把清单 m 描述的分片集转换为 dstEnc 的分片集，返回新的清单
+// 两个编解码器可以是本包中任意的组合，包括 GF(2^8) 与 GF(2^16) 之间的转换。src 提供源分片，
+// present 标记哪些源分片可以读取，长度必须等于 m.TotalShards()；dst 的 CreateShard 接收新的分片，
+// 生成校验分片时再通过 dst 的 OpenShard 读回数据分片。
+//
+// 对象按顺序从源数据分片流向 dstEnc.StreamSplit，不需要在内存中保存整个对象：
+// 读取的每个源分片在读完时与清单中的摘要比较，合并结束时再比较对象摘要，不一致时返回
+// ErrShardHashMismatch（读取分片时出错包装在 StreamReadError 中）。丢失的源数据分片先用
+// StreamReconstructShards 重建到临时文件。出错时 dst 中可能留下不完整的分片，由调用方清理。
+//
+// 对象内容不变，新清单沿用原清单的对象摘要以及压缩信息。
+//
+// 源和目标都不是简单的读取器/写入器切片：源需要清单提供编解码参数和逐个分片的摘要，才能在读取时校验；
+// 目标需要能读回数据分片，因为 StreamSplit 把对象的连续区间放进各个数据分片，同一偏移的校验块
+// 依赖对象中相距一个分片大小的 k 个位置，只顺序读一遍对象就生成校验分片需要在内存中保存整个对象。
+// 先写数据分片再读回，内存占用只与块大小有关，也不需要额外的临时文件。
+func Transcode(m *Manifest, src ShardOpener, present []bool, dstEnc ReedSolomon, dst ShardOpener) (*Manifest, error) {
+	if src == nil || dst == nil {
+		return nil, ErrInvalidInput
+	}
+	srcEnc, err := m.NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+	if len(present) != m.TotalShards() {
+		return nil, ErrTooFewShards
+	}
+	if !srcEnc.CanReconstruct(present) {
+		return nil, ErrTooFewShards
+	}
+	b, err := NewManifestBuilder(dstEnc, m.ObjectSize)
+	if err != nil {
+		return nil, err
+	}
+	b.m.Compression, b.m.RawSize = m.Compression, m.RawSize
+
+	// 合并源分片，经过管道交给 StreamSplit
+	// 压缩的对象原样转换，清空压缩算法使 joinShards 不解压
+	raw := *m
+	raw.Compression = ""
+	get := func(i int) (io.ReadCloser, error) {
+		rc, err := src.OpenShard(i)
+		if err != nil {
+			return nil, err
+		}
+		return &verifyReader{rc: rc, h: sha256.New(), index: i, limit: m.ShardLen(i), want: m.ShardHashes[i]}, nil
+	}
+	pr, pw := io.Pipe()
+	joined := make(chan error, 1)
+	go func() {
+		err := joinShards("transcode", get, &raw, srcEnc, present, pw)
+		pw.CloseWithError(err)
+		joined <- err
+	}()
+
+	k := dstEnc.DataShards()
+	err = createShards(dst, 0, k, func(w []io.Writer) error {
+		return dstEnc.StreamSplit(b.Object(pr), b.DataWriters(w), m.ObjectSize)
+	})
+	// StreamSplit 出错时合并可能阻塞在管道上
+	pr.CloseWithError(err)
+	if jerr := <-joined; jerr != nil {
+		return nil, jerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 读回新的数据分片生成校验分片
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		rc, err := dst.OpenShard(i)
+		if err != nil {
+			return nil, StreamReadError{Err: err, Stream: i}
+		}
+		defer rc.Close()
+		readers[i] = rc
+	}
+	err = createShards(dst, k, dstEnc.ParityShards(), func(w []io.Writer) error {
+		return dstEnc.StreamEncode(readers, b.ParityWriters(w))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := b.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	// 合并时已经确认对象摘要与原清单一致
+	out.ObjectHash = m.ObjectHash
+	return out, nil
+}
+
+// createShards 通过 CreateShard 打开分片 first 到 first+n-1，调用 fn 写入后关闭
+func createShards(opener ShardOpener, first, n int, fn func(w []io.Writer) error) (err error) {
+	writers := make([]io.Writer, n)
+	closers := make([]io.Closer, 0, n)
+	defer func() {
+		for i, c := range closers {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = StreamWriteError{Err: cerr, Stream: first + i}
+			}
+		}
+	}()
+	for i := range writers {
+		w, err := opener.CreateShard(first + i)
+		if err != nil {
+			return StreamWriteError{Err: err, Stream: first + i}
+		}
+		closers = append(closers, w)
+		writers[i] = w
+	}
+	return fn(writers)
+}
+
+// verifyReader 读取分片的同时计算摘要，读满 limit 字节时与清单比较
+// 流式编解码器不一定读到 EOF，因此在读满时而不是 EOF 时检查。
+type verifyReader struct {
+	rc    io.ReadCloser
+	h     hash.Hash
+	index int
+	n     int64
+	limit int64
+	want  Digest
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	if r.n >= r.limit {
+		return 0, io.EOF
+	}
+	if rest := r.limit - r.n; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := r.rc.Read(p)
+	r.h.Write(p[:n])
+	r.n += int64(n)
+	if r.n == r.limit {
+		if !bytes.Equal(r.h.Sum(nil), r.want[:]) {
+			return n, StreamReadError{Err: ErrShardHashMismatch, Stream: r.index}
+		}
+		// 下一次读取返回 EOF，有的调用方会丢弃与 EOF 一起返回的数据
+		if err == io.EOF {
+			err = nil
+		}
+	} else if err == io.EOF {
+		return n, StreamReadError{Err: ErrShardHashMismatch, Stream: r.index}
+	}
+	return n, err
+}
+
+func (r *verifyReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,140 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// bufOpener 把写入的分片保存在内存中，之后可以再次打开读取
+type bufOpener map[int]*bytes.Buffer
+
+func (o bufOpener) OpenShard(i int) (io.ReadCloser, error) {
+	buf, ok := o[i]
+	if !ok {
+		return nil, errors.New("分片不存在")
+	}
+	return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+}
+
+func (o bufOpener) CreateShard(i int) (io.WriteCloser, error) {
+	buf := &bytes.Buffer{}
+	o[i] = buf
+	return nopWriteCloser{buf}, nil
+}
+
+// 测试在不同参数和有限域之间转码，源分片丢失时先重建
+func TestTranscode(t *testing.T) {
+	enc8, _ := New8(6, 3)
+	enc16, _ := New16(16, 4)
+	big, _ := New16(300, 20)
+	small, _ := New8(10, 4)
+	testTranscode(t, enc8, enc16, 100013)
+	testTranscode(t, enc16, enc8, 5000)
+	testTranscode(t, big, small, 300*64*3-100)
+}
+
+func testTranscode(t *testing.T, srcEnc, dstEnc ReedSolomon, size int) {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+
+	// 按 ObjectStore.Put 的方式生成源分片
+	src := bufOpener{}
+	b, err := NewManifestBuilder(srcEnc, int64(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := srcEnc.DataShards()
+	err = createShards(src, 0, k, func(w []io.Writer) error {
+		return srcEnc.StreamSplit(b.Object(bytes.NewReader(data)), b.DataWriters(w), int64(size))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readers := make([]io.Reader, k)
+	for i := range readers {
+		rc, _ := src.OpenShard(i)
+		readers[i] = rc
+	}
+	err = createShards(src, k, srcEnc.ParityShards(), func(w []io.Writer) error {
+		return srcEnc.StreamEncode(readers, b.ParityWriters(w))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := b.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 丢失一个数据分片和一个校验分片
+	present := make([]bool, m.TotalShards())
+	for i := range present {
+		present[i] = i != 1 && i != k
+	}
+	dst := bufOpener{}
+	out, err := Transcode(m, src, present, dstEnc, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.DataShards != dstEnc.DataShards() || out.ParityShards != dstEnc.ParityShards() ||
+		out.Field != fieldBits(dstEnc) || out.ObjectHash != m.ObjectHash {
+		t.Fatalf("清单不正确: %+v", out)
+	}
+	if len(dst) != dstEnc.TotalShards() {
+		t.Fatalf("写入 %d 个分片，期望 %d", len(dst), dstEnc.TotalShards())
+	}
+
+	// 新的分片通过清单校验，丢失数据分片后仍能恢复对象
+	shards := make([][]byte, out.TotalShards())
+	for i := range shards {
+		shards[i] = make([]byte, out.ShardSize)
+		copy(shards[i], dst[i].Bytes())
+	}
+	if bad, err := out.ValidateShards(shards); len(bad) != 0 || err != nil {
+		t.Fatalf("校验失败: %v %v", bad, err)
+	}
+	if ok, err := dstEnc.Verify(shards); !ok || err != nil {
+		t.Fatalf("校验分片不一致: %v", err)
+	}
+	shards[0] = nil
+	if err := dstEnc.ReconstructData(shards); err != nil {
+		t.Fatal(err)
+	}
+	var joined bytes.Buffer
+	dr := make([]io.Reader, dstEnc.DataShards())
+	for i := range dr {
+		dr[i] = bytes.NewReader(shards[i])
+	}
+	if err := dstEnc.StreamJoin(&joined, dr, out.ObjectSize); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(joined.Bytes(), data) {
+		t.Fatal("转码后的对象不一致")
+	}
+
+	// 篡改的源分片在读取时被发现
+	src[2].Bytes()[7] ^= 1
+	if _, err := Transcode(m, src, present, dstEnc, bufOpener{}); !errors.Is(err, ErrShardHashMismatch) {
+		t.Fatalf("期望 ErrShardHashMismatch，实际 %v", err)
+	}
+}
+
+// 测试无效的参数
+func TestTranscodeErrors(t *testing.T) {
+	enc, _ := New(4, 2)
+	m := &Manifest{Version: ManifestVersion, Field: 8, DataShards: 4, ParityShards: 2,
+		ObjectSize: 256, ShardSize: 64, Layout: LayoutStream, ShardHashes: make([]Digest, 6)}
+	if _, err := Transcode(m, bufOpener{}, make([]bool, 5), enc, bufOpener{}); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+	present := []bool{true, false, false, true, false, true}
+	if _, err := Transcode(m, bufOpener{}, present, enc, bufOpener{}); err != ErrTooFewShards {
+		t.Fatalf("期望 ErrTooFewShards，实际 %v", err)
+	}
+	if _, err := Transcode(m, nil, present, enc, bufOpener{}); err != ErrInvalidInput {
+		t.Fatalf("期望 ErrInvalidInput，实际 %v", err)
+	}
+}
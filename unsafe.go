@@ -1,4 +1,4 @@
-//go:build !noasm && !nounsafe && !gccgo && !appengine
+//go:build !nounsafe && !gccgo && !appengine
 
 /**
  * Reed-Solomon Coding over 8-bit values.
@@ -2,6 +2,6 @@
 
 package reedsolomon
 
-func sliceXor(in, out []byte, o *options) {
-	sliceXorGo(in, out, o)
+func sliceXor(in, out []byte) {
+	sliceXorGo(in, out)
 }